@@ -0,0 +1,209 @@
+// Package catalog reads and writes the file formats used to import and export
+// the catalog in bulk.
+package catalog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"literal/internal/data"
+)
+
+// Formats accepted by Read.
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+var ErrUnknownFormat = errors.New("format must be csv or json")
+
+// maxLine bounds a single JSON line, which is mostly description.
+const maxLine = 1 << 20
+
+// Read parses r as format. A line that can't be parsed becomes a row with
+// Problem set, so one bad line doesn't stop the rest of the file; the error
+// is for files that can't be read at all.
+func Read(r io.Reader, format string) ([]data.ImportRow, error) {
+	switch format {
+	case FormatCSV:
+		return ReadCSV(r)
+	case FormatJSON:
+		return ReadJSON(r)
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+// FormatFor maps a media type or file extension to a format, or "" when it
+// is neither.
+func FormatFor(s string) string {
+	switch strings.ToLower(strings.TrimPrefix(s, ".")) {
+	case "csv", "text/csv":
+		return FormatCSV
+	case "json", "jsonl", "ndjson", "application/json", "application/jsonl", "application/x-ndjson":
+		return FormatJSON
+	default:
+		return ""
+	}
+}
+
+// csvColumns maps the header names ReadCSV understands to their canonical
+// column.
+var csvColumns = map[string]string{
+	"title":            "title",
+	"author":           "author",
+	"author_name":      "author",
+	"publication_year": "publication_year",
+	"year":             "publication_year",
+	"description":      "description",
+	"genres":           "genres",
+	"genre":            "genres",
+}
+
+// ReadCSV parses a CSV file with a header row. The title and author columns
+// are required; publication_year, description and genres are optional, and
+// other columns are ignored. Genres are separated by ";" or "|". A file with
+// exactly the header of a books export is read as one, taking off the quotes
+// the export put in front of formula-like text.
+func ReadCSV(r io.Reader) ([]data.ImportRow, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, errors.New("the file is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	exported := len(header) == len(Books.Columns)
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		name = strings.NewReplacer(" ", "_", "-", "_").Replace(name)
+		// spreadsheet exports often start with a byte order mark
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+
+		if exported && name != Books.Columns[i] {
+			exported = false
+		}
+
+		if column, ok := csvColumns[name]; ok {
+			if _, dup := columns[column]; !dup {
+				columns[column] = i
+			}
+		}
+	}
+
+	for _, required := range []string{"title", "author"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("the header has no %s column", required)
+		}
+	}
+
+	field := func(record []string, column string) string {
+		i, ok := columns[column]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		value := strings.TrimSpace(record[i])
+		if exported {
+			value = unquoteCell(value)
+		}
+		return value
+	}
+
+	var rows []data.ImportRow
+
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := cr.FieldPos(0)
+		row := data.ImportRow{
+			Line:        line,
+			Title:       field(record, "title"),
+			Author:      field(record, "author"),
+			Description: field(record, "description"),
+			Genres:      splitGenres(field(record, "genres")),
+		}
+
+		if year := field(record, "publication_year"); year != "" {
+			row.PublicationYear, err = strconv.Atoi(year)
+			if err != nil {
+				row.Problem = fmt.Sprintf("publication year %q is not a number", year)
+			}
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// unquoteCell takes off the quote formatCSVCell puts in front of text that
+// looks like a formula, and leaves any other leading quote alone.
+func unquoteCell(s string) string {
+	if strings.HasPrefix(s, "'") && looksLikeFormula(strings.TrimLeft(s, "'")) {
+		return s[1:]
+	}
+	return s
+}
+
+func splitGenres(s string) []string {
+	var genres []string
+	for _, name := range strings.FieldsFunc(s, func(r rune) bool { return r == ';' || r == '|' }) {
+		if name = strings.TrimSpace(name); name != "" {
+			genres = append(genres, name)
+		}
+	}
+	return genres
+}
+
+// ReadJSON parses JSON lines: one object per line with the fields of
+// data.ImportRow, genres being an array of names. Blank lines are skipped.
+func ReadJSON(r io.Reader) ([]data.ImportRow, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLine)
+
+	var rows []data.ImportRow
+
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+
+		var row data.ImportRow
+		err := json.Unmarshal(text, &row)
+		if err != nil {
+			row = data.ImportRow{Problem: "invalid JSON: " + err.Error()}
+		}
+		row.Line = line
+
+		rows = append(rows, row)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return rows, nil
+}
@@ -0,0 +1,114 @@
+package catalog
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"literal/internal/data"
+)
+
+func TestReadCSV(t *testing.T) {
+	var tests = []struct {
+		name          string
+		input         string
+		expectedRows  []data.ImportRow
+		expectedError bool
+	}{
+		{
+			"all columns",
+			"title,author,publication_year,description,genres\n" +
+				"Dune,Frank Herbert,1965,\"Sand, and spice\",Science Fiction;Classic\n",
+			[]data.ImportRow{{Line: 2, Title: "Dune", Author: "Frank Herbert", PublicationYear: 1965, Description: "Sand, and spice",
+				Genres: []string{"Science Fiction", "Classic"}}},
+			false,
+		},
+		{
+			"aliases, extra columns and a byte order mark",
+			"\ufeffAuthor Name,Year,Title,ISBN,Genre\n" +
+				"Ursula K. Le Guin,1969,The Left Hand of Darkness,x,Science Fiction|Fantasy\n",
+			[]data.ImportRow{{Line: 2, Title: "The Left Hand of Darkness", Author: "Ursula K. Le Guin", PublicationYear: 1969,
+				Genres: []string{"Science Fiction", "Fantasy"}}},
+			false,
+		},
+		{
+			"bad year and short row",
+			"title,author,publication_year\nDune,Frank Herbert,soon\nEmma\n",
+			[]data.ImportRow{
+				{Line: 2, Title: "Dune", Author: "Frank Herbert", Problem: `publication year "soon" is not a number`},
+				{Line: 3, Title: "Emma"},
+			},
+			false,
+		},
+		{"missing author column", "title,year\nDune,1965\n", nil, true},
+		{"empty file", "", nil, true},
+	}
+
+	for _, e := range tests {
+		rows, err := ReadCSV(strings.NewReader(e.input))
+		if e.expectedError {
+			if err == nil {
+				t.Errorf("%s: expected an error", e.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", e.name, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(rows, e.expectedRows) {
+			t.Errorf("%s: expected %+v, got %+v", e.name, e.expectedRows, rows)
+		}
+	}
+}
+
+func TestReadJSON(t *testing.T) {
+	input := `{"title": "Dune", "author": "Frank Herbert", "publication_year": 1965, "genres": ["Science Fiction"]}
+
+{"title": "Emma", "author": "Jane Austen", "publication_year": "1815"}
+{"title": "Persuasion", "author": "Jane Austen", "slug": "ignored"}
+`
+
+	rows, err := ReadJSON(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 rows, got %d", len(rows))
+	}
+
+	expected := data.ImportRow{Line: 1, Title: "Dune", Author: "Frank Herbert", PublicationYear: 1965, Genres: []string{"Science Fiction"}}
+	if !reflect.DeepEqual(rows[0], expected) {
+		t.Errorf("expected %+v, got %+v", expected, rows[0])
+	}
+
+	if rows[1].Line != 3 || !strings.HasPrefix(rows[1].Problem, "invalid JSON") {
+		t.Errorf("expected line 3 to have a problem, got %+v", rows[1])
+	}
+
+	if rows[2].Line != 4 || rows[2].Title != "Persuasion" || rows[2].Problem != "" {
+		t.Errorf("expected line 4 to be read, got %+v", rows[2])
+	}
+}
+
+func TestFormatFor(t *testing.T) {
+	var tests = []struct {
+		input    string
+		expected string
+	}{
+		{".csv", FormatCSV},
+		{"text/csv", FormatCSV},
+		{".jsonl", FormatJSON},
+		{"application/x-ndjson", FormatJSON},
+		{"application/json", FormatJSON},
+		{"text/plain", ""},
+	}
+
+	for _, e := range tests {
+		if got := FormatFor(e.input); got != e.expected {
+			t.Errorf("%s: expected %q, got %q", e.input, e.expected, got)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package catalog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"literal/internal/data"
+)
+
+// FormatXLSX is only written, never read.
+const FormatXLSX = "xlsx"
+
+// Table names an exported table and its columns. Records written for it list
+// one value per column.
+type Table struct {
+	Name    string
+	Columns []string
+}
+
+// The exported tables. Books use the same column names that ReadCSV and
+// ReadJSON accept, so an export can be imported again.
+var (
+	Books   = Table{"books", []string{"id", "title", "slug", "author", "authors", "isbn", "publication_year", "description", "genres", "created_at", "updated_at"}}
+	Authors = Table{"authors", []string{"id", "author_name", "book_count", "created_at", "updated_at"}}
+	Genres  = Table{"genres", []string{"id", "genre_name", "book_count", "created_at", "updated_at"}}
+)
+
+func BookRecord(b *data.Book) []interface{} {
+	genres := make([]string, 0, len(b.Genres))
+	for _, g := range b.Genres {
+		genres = append(genres, g.GenreName)
+	}
+
+	authors := b.Authors
+	if authors == nil {
+		authors = []data.Contributor{}
+	}
+
+	return []interface{}{b.ID, b.Title, b.Slug, b.Author.AuthorName, authors, b.ISBN13, b.PublicationYear, b.Description, genres, b.CreatedAt, b.UpdatedAt}
+}
+
+func AuthorRecord(a *data.Author) []interface{} {
+	return []interface{}{a.ID, a.AuthorName, a.BookCount, a.CreatedAt, a.UpdatedAt}
+}
+
+func GenreRecord(g *data.Genre) []interface{} {
+	return []interface{}{g.ID, g.GenreName, g.BookCount, g.CreatedAt, g.UpdatedAt}
+}
+
+// ContentType is the media type of an export format.
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatJSON:
+		return "application/x-ndjson"
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+// Extension is the usual file extension for an export format.
+func Extension(format string) string {
+	if format == FormatJSON {
+		return ".jsonl"
+	}
+	return "." + format
+}
+
+// A Writer writes a table to an io.Writer one record at a time, buffering no
+// more than a few kilobytes. Values may be strings, ints, times, which are
+// written in RFC 3339, and string slices, which CSV and XLSX join with "; ",
+// as they do contributors, written as "name (role)". Close must be called to
+// finish the file.
+type Writer struct {
+	table Table
+	write func([]interface{}) error
+	close func() error
+}
+
+// NewWriter starts writing table to w in format, writing a header row where
+// the format has one.
+func NewWriter(w io.Writer, format string, table Table) (*Writer, error) {
+	out := &Writer{table: table}
+
+	switch format {
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		out.write = func(values []interface{}) error {
+			record := make([]string, len(values))
+			for i, v := range values {
+				record[i] = formatCSVCell(v)
+			}
+			return cw.Write(record)
+		}
+		out.close = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+
+		err := cw.Write(table.Columns)
+		if err != nil {
+			return nil, err
+		}
+
+	case FormatJSON:
+		bw := bufio.NewWriter(w)
+		out.write = func(values []interface{}) error {
+			return writeJSONLine(bw, table.Columns, values)
+		}
+		out.close = bw.Flush
+
+	case FormatXLSX:
+		xw, err := newXLSXWriter(w, table)
+		if err != nil {
+			return nil, err
+		}
+		out.write = xw.writeRow
+		out.close = xw.close
+
+	default:
+		return nil, fmt.Errorf("format must be csv, json or xlsx")
+	}
+
+	return out, nil
+}
+
+// Write adds one record, which must have a value for every column.
+func (w *Writer) Write(values ...interface{}) error {
+	if len(values) != len(w.table.Columns) {
+		return fmt.Errorf("%s record has %d values for %d columns", w.table.Name, len(values), len(w.table.Columns))
+	}
+
+	return w.write(values)
+}
+
+// Close finishes the file and flushes what is left of it to the underlying
+// writer, which it doesn't close.
+func (w *Writer) Close() error {
+	return w.close()
+}
+
+func formatText(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case time.Time:
+		return formatTime(v)
+	case []string:
+		return strings.Join(v, "; ")
+	case []data.Contributor:
+		names := make([]string, 0, len(v))
+		for _, c := range v {
+			names = append(names, fmt.Sprintf("%s (%s)", c.AuthorName, c.Role))
+		}
+		return strings.Join(names, "; ")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// formatCSVCell is formatText for a CSV cell. Text that a spreadsheet opening
+// the file would take for a formula, such as a title starting with "=", gets
+// a leading quote so it is shown rather than run; ReadCSV takes the quote off
+// again when it reads back an export. Text already quoted that way gets one
+// more, so it reads back unchanged. XLSX needs none of this, as its text cells
+// are never run.
+func formatCSVCell(v interface{}) string {
+	text := formatText(v)
+	if _, ok := v.(int); ok {
+		return text
+	}
+	if looksLikeFormula(strings.TrimLeft(text, "'")) {
+		return "'" + text
+	}
+	return text
+}
+
+// looksLikeFormula reports whether Excel, LibreOffice or Google Sheets would
+// run text as a formula. A leading "-" only counts when an operator or call
+// follows it, so titles such as "-ish" are left alone.
+func looksLikeFormula(text string) bool {
+	if text == "" {
+		return false
+	}
+	switch text[0] {
+	case '=', '+', '@', '\t', '\r':
+		return true
+	case '-':
+		return strings.ContainsAny(text[1:], "=+*/^&(!|")
+	}
+	return false
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// writeJSONLine writes values as one object, keeping the keys in column
+// order rather than the alphabetical order a map would give.
+func writeJSONLine(w *bufio.Writer, columns []string, values []interface{}) error {
+	var line bytes.Buffer
+	enc := json.NewEncoder(&line)
+	enc.SetEscapeHTML(false)
+
+	line.WriteByte('{')
+	for i, column := range columns {
+		if i > 0 {
+			line.WriteByte(',')
+		}
+
+		_ = enc.Encode(column)
+		line.Truncate(line.Len() - 1)
+		line.WriteByte(':')
+
+		v := values[i]
+		if t, ok := v.(time.Time); ok {
+			v = formatTime(t)
+		}
+
+		err := enc.Encode(v)
+		if err != nil {
+			return fmt.Errorf("%s: %w", column, err)
+		}
+		// Encode ends every value with a newline
+		line.Truncate(line.Len() - 1)
+	}
+	line.WriteString("}\n")
+
+	_, err := w.Write(line.Bytes())
+	return err
+}
@@ -0,0 +1,287 @@
+package catalog
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"literal/internal/data"
+)
+
+var exportedAt = time.Date(2022, 3, 5, 10, 30, 0, 0, time.UTC)
+
+var exportBooks = []*data.Book{
+	{ID: 1, Title: "Dune", Slug: "dune", Author: data.Author{AuthorName: "Frank Herbert"}, PublicationYear: 1965,
+		Authors: []data.Contributor{{AuthorID: 3, AuthorName: "Frank Herbert", Role: "author"}, {AuthorID: 4, AuthorName: "John Schoenherr", Role: "illustrator"}},
+		ISBN13:  "9780441172719", Description: `Sand, "spice" & <worms>`, Genres: []data.Genre{{GenreName: "Classic"}, {GenreName: "Science Fiction"}},
+		CreatedAt: exportedAt, UpdatedAt: exportedAt},
+	{ID: 2, Title: "Emma", Slug: "emma", Author: data.Author{AuthorName: "Jane Austen"}, CreatedAt: exportedAt, UpdatedAt: exportedAt},
+}
+
+func writeBooks(t *testing.T, format string) []byte {
+	var buf bytes.Buffer
+
+	w, err := NewWriter(&buf, format, Books)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, b := range exportBooks {
+		err := w.Write(BookRecord(b)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestWriter_csv(t *testing.T) {
+	got := string(writeBooks(t, FormatCSV))
+
+	expected := "id,title,slug,author,authors,isbn,publication_year,description,genres,created_at,updated_at\n" +
+		`1,Dune,dune,Frank Herbert,Frank Herbert (author); John Schoenherr (illustrator),9780441172719,1965,"Sand, ""spice"" & <worms>",Classic; Science Fiction,2022-03-05T10:30:00Z,2022-03-05T10:30:00Z` + "\n" +
+		"2,Emma,emma,Jane Austen,,,0,,,2022-03-05T10:30:00Z,2022-03-05T10:30:00Z\n"
+
+	if got != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, got)
+	}
+
+	// an export has to be something the import reads back
+	rows, err := ReadCSV(strings.NewReader(got))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedRow := data.ImportRow{Line: 2, Title: "Dune", Author: "Frank Herbert", PublicationYear: 1965,
+		Description: `Sand, "spice" & <worms>`, Genres: []string{"Classic", "Science Fiction"}}
+	if !reflect.DeepEqual(rows[0], expectedRow) {
+		t.Errorf("expected %+v to be read back, got %+v", expectedRow, rows[0])
+	}
+}
+
+func TestWriter_json(t *testing.T) {
+	got := string(writeBooks(t, FormatJSON))
+
+	expected := `{"id":1,"title":"Dune","slug":"dune","author":"Frank Herbert",` +
+		`"authors":[{"author_id":3,"author_name":"Frank Herbert","role":"author"},{"author_id":4,"author_name":"John Schoenherr","role":"illustrator"}],` +
+		`"isbn":"9780441172719","publication_year":1965,"description":"Sand, \"spice\" & <worms>",` +
+		`"genres":["Classic","Science Fiction"],"created_at":"2022-03-05T10:30:00Z","updated_at":"2022-03-05T10:30:00Z"}` + "\n" +
+		`{"id":2,"title":"Emma","slug":"emma","author":"Jane Austen","authors":[],"isbn":"","publication_year":0,"description":"",` +
+		`"genres":[],"created_at":"2022-03-05T10:30:00Z","updated_at":"2022-03-05T10:30:00Z"}` + "\n"
+
+	if got != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, got)
+	}
+
+	rows, err := ReadJSON(strings.NewReader(got))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedRow := data.ImportRow{Line: 1, Title: "Dune", Author: "Frank Herbert", PublicationYear: 1965,
+		Description: `Sand, "spice" & <worms>`, Genres: []string{"Classic", "Science Fiction"}}
+	if !reflect.DeepEqual(rows[0], expectedRow) {
+		t.Errorf("expected %+v to be read back, got %+v", expectedRow, rows[0])
+	}
+}
+
+func TestWriter_xlsx(t *testing.T) {
+	b := writeBooks(t, FormatXLSX)
+
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := make(map[string][]byte)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts[f.Name], _ = io.ReadAll(rc)
+		rc.Close()
+	}
+
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml"} {
+		if _, ok := parts[name]; !ok {
+			t.Errorf("expected the package to have %s", name)
+		}
+	}
+
+	var sheet struct {
+		Rows []struct {
+			Cells []struct {
+				Ref    string `xml:"r,attr"`
+				Type   string `xml:"t,attr"`
+				Value  string `xml:"v"`
+				Inline string `xml:"is>t"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+
+	err = xml.Unmarshal(parts["xl/worksheets/sheet1.xml"], &sheet)
+	if err != nil {
+		t.Fatalf("sheet is not valid XML: %v", err)
+	}
+
+	if len(sheet.Rows) != 3 {
+		t.Fatalf("expected 3 rows, got %d", len(sheet.Rows))
+	}
+
+	cells := make(map[string]string)
+	for _, row := range sheet.Rows {
+		for _, c := range row.Cells {
+			if c.Type == "inlineStr" {
+				cells[c.Ref] = c.Inline
+			} else {
+				cells[c.Ref] = c.Value
+			}
+		}
+	}
+
+	for ref, expected := range map[string]string{
+		"A1": "id",
+		"K1": "updated_at",
+		"A2": "1",
+		"E2": "Frank Herbert (author); John Schoenherr (illustrator)",
+		"F2": "9780441172719",
+		"G2": "1965",
+		"H2": `Sand, "spice" & <worms>`,
+		"I2": "Classic; Science Fiction",
+		"J3": "2022-03-05T10:30:00Z",
+	} {
+		if cells[ref] != expected {
+			t.Errorf("expected %s to be %q, got %q", ref, expected, cells[ref])
+		}
+	}
+
+	if _, ok := cells["H3"]; ok {
+		t.Error("expected an empty description to leave its cell out")
+	}
+}
+
+func TestWriter_Write(t *testing.T) {
+	w, _ := NewWriter(io.Discard, FormatCSV, Genres)
+
+	err := w.Write(1, "Fantasy")
+	if err == nil {
+		t.Error("expected a record with missing values to be refused")
+	}
+}
+
+func TestWriter_formulas(t *testing.T) {
+	var buf bytes.Buffer
+
+	var tests = []struct {
+		title    string
+		expected string
+	}{
+		{`=HYPERLINK("http://example.com")`, `"'=HYPERLINK(""http://example.com"")"`},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"+1", "'+1"},
+		{"-2+3+cmd|' /C calc'!A0", "'-2+3+cmd|' /C calc'!A0"},
+		{"-ish", "-ish"},
+		{"-1", "-1"},
+		{"'@home", "''@home"},
+		{"'quoted", "'quoted"},
+		{"Science Fiction", "Science Fiction"},
+	}
+
+	w, _ := NewWriter(&buf, FormatCSV, Books)
+	for i, e := range tests {
+		_ = w.Write(BookRecord(&data.Book{ID: i + 1, Title: e.title, Author: data.Author{AuthorName: "Anonymous"}})...)
+	}
+	_ = w.Close()
+
+	got := buf.String()
+	for i, e := range tests {
+		if !strings.Contains(got, fmt.Sprintf("\n%d,%s,", i+1, e.expected)) {
+			t.Errorf("%s: expected %s in\n%s", e.title, e.expected, got)
+		}
+	}
+
+	// reading the export back takes exactly the added quotes off
+	rows, err := ReadCSV(strings.NewReader(got))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, e := range tests {
+		if rows[i].Title != e.title {
+			t.Errorf("%s: expected the title back, got %q", e.title, rows[i].Title)
+		}
+	}
+
+	// a file the export didn't write keeps its quotes
+	rows, err = ReadCSV(strings.NewReader("title,author\n'=1+1,'-Anonymous\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows[0].Title != "'=1+1" || rows[0].Author != "'-Anonymous" {
+		t.Errorf("expected the quotes to be kept, got %+v", rows[0])
+	}
+}
+
+func TestWriter_xlsxText(t *testing.T) {
+	titles := []string{"-ish", "+1", "@home", "=1+1", "'quoted"}
+
+	var buf bytes.Buffer
+	w, _ := NewWriter(&buf, FormatXLSX, Genres)
+	for i, title := range titles {
+		_ = w.Write(i+1, title, 0, exportedAt, exportedAt)
+	}
+	_ = w.Close()
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sheet []byte
+	for _, f := range zr.File {
+		if f.Name == "xl/worksheets/sheet1.xml" {
+			rc, _ := f.Open()
+			sheet, _ = io.ReadAll(rc)
+			rc.Close()
+		}
+	}
+
+	for _, title := range titles {
+		if !bytes.Contains(sheet, []byte(`<t xml:space="preserve">`+escapeXML(title)+`</t>`)) {
+			t.Errorf("expected %q to be written as it is, got\n%s", title, sheet)
+		}
+	}
+}
+
+func Test_columnName(t *testing.T) {
+	var tests = []struct {
+		index    int
+		expected string
+	}{
+		{0, "A"},
+		{25, "Z"},
+		{26, "AA"},
+		{51, "AZ"},
+		{52, "BA"},
+		{701, "ZZ"},
+		{702, "AAA"},
+	}
+
+	for _, e := range tests {
+		if got := columnName(e.index); got != e.expected {
+			t.Errorf("%d: expected %s, got %s", e.index, e.expected, got)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package catalog
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// The limits of a worksheet. Text beyond maxCellText is cut off, since Excel
+// refuses to open a file with a longer cell.
+const (
+	maxRows     = 1 << 20
+	maxCellText = 32767
+)
+
+var ErrTooManyRows = errors.New("xlsx sheets are limited to 1048576 rows")
+
+// xlsxWriter writes a workbook with a single sheet. The fixed parts of the
+// package go first and the sheet is streamed into the last zip entry, with
+// strings stored inline so nothing has to be collected for a shared strings
+// table.
+type xlsxWriter struct {
+	zw   *zip.Writer
+	bw   *bufio.Writer
+	rows int
+}
+
+const xlsxHeader = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n"
+
+var xlsxParts = []struct {
+	name    string
+	content string
+}{
+	{"[Content_Types].xml", `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`</Types>`},
+	{"_rels/.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`},
+	{"xl/_rels/workbook.xml.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+		`</Relationships>`},
+	// style 1 is the bold header row
+	{"xl/styles.xml", `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+		`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+		`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+		`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+		`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+		`<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+		`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs>` +
+		`</styleSheet>`},
+}
+
+func newXLSXWriter(w io.Writer, table Table) (*xlsxWriter, error) {
+	zw := zip.NewWriter(w)
+
+	for _, part := range xlsxParts {
+		err := writePart(zw, part.name, part.content)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := writePart(zw, "xl/workbook.xml", `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" `+
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">`+
+		`<sheets><sheet name="`+escapeXML(table.Name)+`" sheetId="1" r:id="rId1"/></sheets></workbook>`)
+	if err != nil {
+		return nil, err
+	}
+
+	sheet, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+
+	xw := &xlsxWriter{zw: zw, bw: bufio.NewWriter(sheet)}
+
+	// keep the header row in view while scrolling
+	_, err = xw.bw.WriteString(xlsxHeader + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+		`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>` +
+		`<sheetData>`)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]interface{}, len(table.Columns))
+	for i, column := range table.Columns {
+		header[i] = column
+	}
+
+	err = xw.row(header, ` s="1"`)
+	if err != nil {
+		return nil, err
+	}
+
+	return xw, nil
+}
+
+func writePart(zw *zip.Writer, name, content string) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(f, xlsxHeader+content)
+	return err
+}
+
+func (xw *xlsxWriter) writeRow(values []interface{}) error {
+	return xw.row(values, "")
+}
+
+func (xw *xlsxWriter) row(values []interface{}, style string) error {
+	if xw.rows == maxRows {
+		return ErrTooManyRows
+	}
+	xw.rows++
+
+	fmt.Fprintf(xw.bw, `<row r="%d">`, xw.rows)
+
+	for i, v := range values {
+		ref := columnName(i) + strconv.Itoa(xw.rows)
+
+		switch v := v.(type) {
+		case int:
+			fmt.Fprintf(xw.bw, `<c r="%s"%s><v>%d</v></c>`, ref, style, v)
+		default:
+			text := formatText(v)
+			if text == "" {
+				continue
+			}
+			if runes := []rune(text); len(runes) > maxCellText {
+				text = string(runes[:maxCellText])
+			}
+			fmt.Fprintf(xw.bw, `<c r="%s"%s t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, style, escapeXML(text))
+		}
+	}
+
+	_, err := xw.bw.WriteString(`</row>`)
+	return err
+}
+
+func (xw *xlsxWriter) close() error {
+	_, err := xw.bw.WriteString(`</sheetData></worksheet>`)
+	if err != nil {
+		return err
+	}
+
+	err = xw.bw.Flush()
+	if err != nil {
+		return err
+	}
+
+	return xw.zw.Close()
+}
+
+// columnName turns a zero-based column index into its spreadsheet letters:
+// A to Z, then AA, AB and so on.
+func columnName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+// escapeXML escapes text for an element or attribute, replacing characters
+// XML can't hold at all with U+FFFD.
+func escapeXML(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
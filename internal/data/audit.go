@@ -0,0 +1,141 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// AuditEvent records one change made through the admin API. Before and After
+// are JSON snapshots of the target, either of which may be empty, as on a
+// create or a delete.
+type AuditEvent struct {
+	ID         int64           `json:"id"`
+	ActorID    int             `json:"actor_id"`
+	ActorEmail string          `json:"actor_email"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetID   int             `json:"target_id"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	IPAddress  string          `json:"ip_address"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+type AuditModel struct {
+	DB      *sql.DB
+	Timeout time.Duration
+}
+
+func (m AuditModel) Insert(ctx context.Context, e AuditEvent) error {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	stmt := `insert into audit_events (actor_id, actor_email, action, target_type, target_id, before, after, ip_address, created_at)
+	values ($1, $2, $3, $4, $5, $6::jsonb, $7::jsonb, $8, $9)`
+
+	_, err := m.DB.ExecContext(ctx, stmt, nullInt(e.ActorID), e.ActorEmail, e.Action, e.TargetType, nullInt(e.TargetID),
+		nullJSON(e.Before), nullJSON(e.After), e.IPAddress, time.Now())
+
+	return err
+}
+
+// AuditFilter narrows List to matching events. Zero values match everything.
+type AuditFilter struct {
+	ActorID    int
+	Action     string
+	TargetType string
+	TargetID   int
+	Since      time.Time
+	Until      time.Time
+	Page       int
+	PageSize   int
+}
+
+// List returns the events matching f, newest first, along with the total
+// number of matches across all pages.
+func (m AuditModel) List(ctx context.Context, f AuditFilter) ([]*AuditEvent, int, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	where := `where ($1 = 0 or actor_id = $1)
+			and ($2 = '' or action = $2)
+			and ($3 = '' or target_type = $3)
+			and ($4 = 0 or target_id = $4)
+			and ($5::timestamptz is null or created_at >= $5)
+			and ($6::timestamptz is null or created_at < $6)`
+
+	args := []interface{}{f.ActorID, f.Action, f.TargetType, f.TargetID, nullTime(f.Since), nullTime(f.Until)}
+
+	var total int
+	err := m.DB.QueryRowContext(ctx, `select count(id) from audit_events `+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var limit interface{}
+	offset := 0
+	if f.PageSize > 0 {
+		limit = f.PageSize
+		if f.Page > 1 {
+			offset = (f.Page - 1) * f.PageSize
+		}
+	}
+
+	query := `select id, coalesce(actor_id, 0), actor_email, action, target_type, coalesce(target_id, 0),
+			before, after, ip_address, created_at
+			from audit_events
+			` + where + `
+			order by created_at desc, id desc
+			limit $7 offset $8`
+
+	rows, err := m.DB.QueryContext(ctx, query, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var events []*AuditEvent
+
+	for rows.Next() {
+		var e AuditEvent
+		var before, after []byte
+		err := rows.Scan(&e.ID, &e.ActorID, &e.ActorEmail, &e.Action, &e.TargetType, &e.TargetID,
+			&before, &after, &e.IPAddress, &e.CreatedAt)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		e.Before, e.After = before, after
+		events = append(events, &e)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return events, total, nil
+}
+
+func nullInt(i int) interface{} {
+	if i == 0 {
+		return nil
+	}
+	return i
+}
+
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func nullJSON(b json.RawMessage) interface{} {
+	if len(b) == 0 {
+		return nil
+	}
+	return string(b)
+}
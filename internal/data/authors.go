@@ -0,0 +1,230 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	ErrAuthorHasBooks   = errors.New("author still has books")
+	ErrMergeSameAuthor  = errors.New("cannot merge an author into itself")
+	ErrAuthorNameNeeded = errors.New("author name is required")
+)
+
+type AuthorModel struct {
+	DB      *sql.DB
+	Timeout time.Duration
+}
+
+type Author struct {
+	ID         int       `json:"id"`
+	AuthorName string    `json:"author_name"`
+	BookCount  int       `json:"book_count,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+func (m AuthorModel) GetAllAuthors(ctx context.Context) ([]*Author, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	query := `select id, author_name, created_at, updated_at from authors order by author_name`
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var authors []*Author
+
+	for rows.Next() {
+		var author Author
+		err := rows.Scan(&author.ID, &author.AuthorName, &author.CreatedAt, &author.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		authors = append(authors, &author)
+	}
+	return authors, nil
+}
+
+func (m AuthorModel) GetByID(ctx context.Context, id int) (*Author, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	query := `select id, author_name, created_at, updated_at from authors where id = $1`
+
+	var author Author
+	row := m.DB.QueryRowContext(ctx, query, id)
+
+	err := row.Scan(&author.ID, &author.AuthorName, &author.CreatedAt, &author.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &author, nil
+}
+
+func (m AuthorModel) Insert(ctx context.Context, author Author) (int, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	if author.AuthorName == "" {
+		return 0, ErrAuthorNameNeeded
+	}
+
+	stmt := `insert into authors (author_name, created_at, updated_at) values ($1, $2, $3) returning id`
+
+	var id int
+	err := m.DB.QueryRowContext(ctx, stmt, author.AuthorName, time.Now(), time.Now()).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (m AuthorModel) Update(ctx context.Context, author Author) error {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	if author.AuthorName == "" {
+		return ErrAuthorNameNeeded
+	}
+
+	stmt := `update authors set author_name = $1, updated_at = $2 where id = $3`
+
+	res, err := m.DB.ExecContext(ctx, stmt, author.AuthorName, time.Now(), author.ID)
+	if err != nil {
+		return err
+	}
+
+	return expectRows(res)
+}
+
+// Delete removes an author, refusing with ErrAuthorHasBooks while any book
+// still credits them. Use Merge to move those books elsewhere first.
+func (m AuthorModel) Delete(ctx context.Context, id int) error {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// lock the author row so a book can't be assigned between the count and the delete
+	var lockedID int
+	err = tx.QueryRowContext(ctx, `select id from authors where id = $1 for update`, id).Scan(&lockedID)
+	if err != nil {
+		return err
+	}
+
+	var books int
+	err = tx.QueryRowContext(ctx, `select count(id) from books
+			where author_id = $1 or id in (select book_id from books_authors where author_id = $1)`, id).Scan(&books)
+	if err != nil {
+		return err
+	}
+
+	if books > 0 {
+		return ErrAuthorHasBooks
+	}
+
+	_, err = tx.ExecContext(ctx, `delete from authors where id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Merge repoints every book by duplicateID at keepID, in whatever role they
+// were credited, and then deletes the duplicate author, all in one
+// transaction. It returns the number of books that were moved.
+func (m AuthorModel) Merge(ctx context.Context, keepID, duplicateID int) (int, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	if keepID == duplicateID {
+		return 0, ErrMergeSameAuthor
+	}
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// lock both rows in id order so concurrent merges can't deadlock
+	rows, err := tx.QueryContext(ctx, `select id from authors where id in ($1, $2) order by id for update`, keepID, duplicateID)
+	if err != nil {
+		return 0, err
+	}
+
+	found := 0
+	for rows.Next() {
+		found++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if found != 2 {
+		return 0, sql.ErrNoRows
+	}
+
+	var moved int
+	err = tx.QueryRowContext(ctx, `select count(id) from books
+			where author_id = $1 or id in (select book_id from books_authors where author_id = $1)`, duplicateID).Scan(&moved)
+	if err != nil {
+		return 0, err
+	}
+
+	// a book crediting both in the same role keeps the first credit only
+	_, err = tx.ExecContext(ctx, `delete from books_authors d using books_authors k
+			where d.author_id = $1 and k.author_id = $2 and k.book_id = d.book_id and k.role = d.role`, duplicateID, keepID)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, `update books_authors set author_id = $1, updated_at = $2 where author_id = $3`, keepID, time.Now(), duplicateID)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, `update books set author_id = $1, updated_at = $2 where author_id = $3`, keepID, time.Now(), duplicateID)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, `delete from authors where id = $1`, duplicateID)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return moved, nil
+}
+
+// expectRows turns an update that matched nothing into sql.ErrNoRows, so
+// callers can treat a missing row the same way for reads and writes.
+func expectRows(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
@@ -4,109 +4,234 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/mozillazg/go-slugify"
 )
 
+type BookModel struct {
+	DB      *sql.DB
+	Timeout time.Duration
+}
+
 type Book struct {
-	ID              int       `json:"id"`
-	Title           string    `json:"title"`
-	AuthorID        int       `json:"author_id"`
-	PublicationYear int       `json:"publication_year"`
-	Slug            string    `json:"slug"`
-	Author          Author    `json:"author"`
-	Description     string    `json:"description"`
-	Genres          []Genre   `json:"genres"`
-	GenreIDs        []int     `json:"genre_ids,omitempty"`
-	CreatedAt       time.Time `json:"created_at"`
-	UpdatedAt       time.Time `json:"updated_at"`
+	ID              int             `json:"id"`
+	Title           string          `json:"title"`
+	AuthorID        int             `json:"author_id"`
+	PublicationYear int             `json:"publication_year"`
+	Slug            string          `json:"slug"`
+	Author          Author          `json:"author"`
+	Authors         []Contributor   `json:"authors"`
+	Description     string          `json:"description"`
+	ISBN10          string          `json:"isbn_10"`
+	ISBN13          string          `json:"isbn_13"`
+	Genres          []Genre         `json:"genres"`
+	GenreIDs        []int           `json:"genre_ids,omitempty"`
+	Covers          CoverRenditions `json:"covers"`
+	CreatedAt       time.Time       `json:"created_at"`
+	UpdatedAt       time.Time       `json:"updated_at"`
 }
 
-type Author struct {
-	ID         int       `json:"id"`
-	AuthorName string    `json:"author_name"`
-	CreatedAt  time.Time `json:"created_at"`
-	UpdatedAt  time.Time `json:"updated_at"`
+func (m BookModel) GetAll(ctx context.Context) ([]*Book, error) {
+	books, _, err := m.List(ctx, BookFilter{})
+	return books, err
 }
 
-type Genre struct {
-	ID        int       `json:"id"`
-	GenreName string    `json:"genre_name"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+// BookSearchResult is a book matched by Search, with its relevance and a
+// fragment of the description with the matching terms wrapped in <mark>.
+type BookSearchResult struct {
+	Book
+	Rank    float64 `json:"rank"`
+	Snippet string  `json:"snippet"`
 }
 
-func (b *Book) GetAll() ([]*Book, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+// Search runs a full-text query over title, author name and description,
+// best matches first. The query accepts web-search syntax (quoted phrases,
+// "or", leading "-" to exclude). It returns one page of results along with
+// the total number of matches.
+func (m BookModel) Search(ctx context.Context, q string, page, pageSize int) ([]*BookSearchResult, int, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
 	defer cancel()
 
-	query := `select b.id, b.title, b.author_id, b.publication_year, b.slug, b.description, b.created_at, b.updated_at,
-			a.id, a.author_name, a.created_at, a.updated_at
+	limit := pageSize
+	offset := (page - 1) * pageSize
+
+	// counted on its own, like List, so a page past the end still knows the total
+	var total int
+	row := m.DB.QueryRowContext(ctx, `select count(b.id) from books b
+			where b.search_vector @@ websearch_to_tsquery('english', $1)`, q)
+	err := row.Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := `select b.id, b.title, b.author_id, b.publication_year, b.slug, b.description,
+			coalesce(b.isbn_10, ''), coalesce(b.isbn_13, ''), b.covers, b.created_at, b.updated_at,
+			a.id, a.author_name, a.created_at, a.updated_at,
+			ts_rank(b.search_vector, q) as rank,
+			ts_headline('english', coalesce(b.description, ''), q, 'StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=30, MinWords=10')
 			from books b
 			left join authors a on (b.author_id = a.id)
-			order by b.title`
+			cross join websearch_to_tsquery('english', $1) q
+			where b.search_vector @@ q
+			order by rank desc, b.title
+			limit $2 offset $3`
 
-	var books []*Book
+	var results []*BookSearchResult
 
-	rows, err := db.QueryContext(ctx, query)
+	rows, err := m.DB.QueryContext(ctx, query, q, limit, offset)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var book Book
+		var result BookSearchResult
 		err := rows.Scan(
-			&book.ID,
-			&book.Title,
-			&book.AuthorID,
-			&book.PublicationYear,
-			&book.Slug,
-			&book.Description,
-			&book.CreatedAt,
-			&book.UpdatedAt,
-			&book.Author.ID,
-			&book.Author.AuthorName,
-			&book.Author.CreatedAt,
-			&book.Author.UpdatedAt)
+			&result.ID,
+			&result.Title,
+			&result.AuthorID,
+			&result.PublicationYear,
+			&result.Slug,
+			&result.Description,
+			&result.ISBN10,
+			&result.ISBN13,
+			&result.Covers,
+			&result.CreatedAt,
+			&result.UpdatedAt,
+			&result.Author.ID,
+			&result.Author.AuthorName,
+			&result.Author.CreatedAt,
+			&result.Author.UpdatedAt,
+			&result.Rank,
+			&result.Snippet)
 		if err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 
-		// get genres
-		genres, ids, err := b.genresForBook(book.ID)
-		if err != nil {
-			return nil, err
-		}
-		book.Genres = genres
-		book.GenreIDs = ids
+		results = append(results, &result)
+	}
 
-		books = append(books, &book)
+	err = rows.Err()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	books := make([]*Book, len(results))
+	for i := range results {
+		books[i] = &results[i].Book
+	}
+
+	err = m.loadGenres(ctx, books)
+	if err != nil {
+		return nil, 0, err
 	}
 
-	return books, nil
+	err = m.loadContributors(ctx, books)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return results, total, nil
+}
+
+func (m BookModel) GetAllPaginated(ctx context.Context, page, pageSize int) ([]*Book, error) {
+	books, _, err := m.List(ctx, BookFilter{Page: page, PageSize: pageSize})
+	return books, err
 }
 
-func (b *Book) GetAllPaginated(page, pageSize int) ([]*Book, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+// BookFilter narrows and orders a book listing. Zero values mean "no filter";
+// a zero PageSize returns every matching book.
+type BookFilter struct {
+	AuthorID int
+	GenreID  int
+	YearFrom int
+	YearTo   int
+	Sort     string
+	Page     int
+	PageSize int
+}
+
+// bookSortColumns maps the sort keys accepted by List to their columns. A
+// leading "-" on the key sorts descending.
+var bookSortColumns = map[string]string{
+	"title":      "b.title",
+	"year":       "b.publication_year",
+	"created_at": "b.created_at",
+}
+
+func (f BookFilter) orderBy() (string, error) {
+	key := f.Sort
+	if key == "" {
+		key = "title"
+	}
+
+	direction := "asc"
+	if strings.HasPrefix(key, "-") {
+		key = key[1:]
+		direction = "desc"
+	}
+
+	column, ok := bookSortColumns[key]
+	if !ok {
+		return "", fmt.Errorf("invalid sort key %q", f.Sort)
+	}
+
+	return fmt.Sprintf("%s %s, b.id %s", column, direction, direction), nil
+}
+
+// bookFilterWhere applies a BookFilter's AuthorID, GenreID, YearFrom and
+// YearTo, bound in that order as $1 to $4, to books aliased as b. AuthorID
+// matches a book in any of the author's roles.
+const bookFilterWhere = `where ($1 = 0 or b.id in (select book_id from books_authors where author_id = $1))
+			and ($2 = 0 or b.id in (select book_id from books_genres where genre_id = $2))
+			and ($3 = 0 or b.publication_year >= $3)
+			and ($4 = 0 or b.publication_year <= $4)`
+
+// List returns the books matching f along with the total number of matches
+// across all pages.
+func (m BookModel) List(ctx context.Context, f BookFilter) ([]*Book, int, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
 	defer cancel()
 
-	limit := pageSize
-	offset := (page - 1) * pageSize
+	orderBy, err := f.orderBy()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	where := bookFilterWhere
+
+	var total int
+	row := m.DB.QueryRowContext(ctx, `select count(b.id) from books b `+where, f.AuthorID, f.GenreID, f.YearFrom, f.YearTo)
+	err = row.Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
 
-	query := `select b.id, b.title, b.author_id, b.publication_year, b.slug, b.description, b.created_at, b.updated_at,
+	var limit interface{}
+	offset := 0
+	if f.PageSize > 0 {
+		limit = f.PageSize
+		if f.Page > 1 {
+			offset = (f.Page - 1) * f.PageSize
+		}
+	}
+
+	query := `select b.id, b.title, b.author_id, b.publication_year, b.slug, b.description,
+			coalesce(b.isbn_10, ''), coalesce(b.isbn_13, ''), b.covers, b.created_at, b.updated_at,
 			a.id, a.author_name, a.created_at, a.updated_at
 			from books b
 			left join authors a on (b.author_id = a.id)
-			order by b.title
-			limit $1 offset $2`
+			` + where + `
+			order by ` + orderBy + `
+			limit $5 offset $6`
 
 	var books []*Book
 
-	rows, err := db.QueryContext(ctx, query, limit, offset)
+	rows, err := m.DB.QueryContext(ctx, query, f.AuthorID, f.GenreID, f.YearFrom, f.YearTo, limit, offset)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	defer rows.Close()
 
@@ -119,6 +244,9 @@ func (b *Book) GetAllPaginated(page, pageSize int) ([]*Book, error) {
 			&book.PublicationYear,
 			&book.Slug,
 			&book.Description,
+			&book.ISBN10,
+			&book.ISBN13,
+			&book.Covers,
 			&book.CreatedAt,
 			&book.UpdatedAt,
 			&book.Author.ID,
@@ -126,34 +254,42 @@ func (b *Book) GetAllPaginated(page, pageSize int) ([]*Book, error) {
 			&book.Author.CreatedAt,
 			&book.Author.UpdatedAt)
 		if err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 
-		// get genres
-		genres, ids, err := b.genresForBook(book.ID)
-		if err != nil {
-			return nil, err
-		}
-		book.Genres = genres
-		book.GenreIDs = ids
-
 		books = append(books, &book)
 	}
 
-	return books, nil
+	err = rows.Err()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	err = m.loadGenres(ctx, books)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	err = m.loadContributors(ctx, books)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return books, total, nil
 }
 
-func (b *Book) GetBookById(id int) (*Book, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+func (m BookModel) GetBookById(ctx context.Context, id int) (*Book, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
 	defer cancel()
 
-	query := `select b.id, b.title, b.author_id, b.publication_year, b.slug, b.description, b.created_at, b.updated_at,
+	query := `select b.id, b.title, b.author_id, b.publication_year, b.slug, b.description,
+			coalesce(b.isbn_10, ''), coalesce(b.isbn_13, ''), b.covers, b.created_at, b.updated_at,
 			a.id, a.author_name, a.created_at, a.updated_at
 			from books b
 			left join authors a on (b.author_id = a.id)
 			where b.id = $1`
 
-	row := db.QueryRowContext(ctx, query, id)
+	row := m.DB.QueryRowContext(ctx, query, id)
 
 	var book Book
 
@@ -164,6 +300,9 @@ func (b *Book) GetBookById(id int) (*Book, error) {
 		&book.PublicationYear,
 		&book.Slug,
 		&book.Description,
+		&book.ISBN10,
+		&book.ISBN13,
+		&book.Covers,
 		&book.CreatedAt,
 		&book.UpdatedAt,
 		&book.Author.ID,
@@ -174,28 +313,31 @@ func (b *Book) GetBookById(id int) (*Book, error) {
 		return nil, err
 	}
 
-	// get genres
-	genres, ids, err := b.genresForBook(book.ID)
+	err = m.loadGenres(ctx, []*Book{&book})
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.loadContributors(ctx, []*Book{&book})
 	if err != nil {
 		return nil, err
 	}
-	book.Genres = genres
-	book.GenreIDs = ids
 
 	return &book, nil
 }
 
-func (b *Book) GetBookBySlug(slug string) (*Book, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+func (m BookModel) GetBookBySlug(ctx context.Context, slug string) (*Book, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
 	defer cancel()
 
-	query := `select b.id, b.title, b.author_id, b.publication_year, b.slug, b.description, b.created_at, b.updated_at,
+	query := `select b.id, b.title, b.author_id, b.publication_year, b.slug, b.description,
+			coalesce(b.isbn_10, ''), coalesce(b.isbn_13, ''), b.covers, b.created_at, b.updated_at,
 			a.id, a.author_name, a.created_at, a.updated_at
 			from books b
 			left join authors a on (b.author_id = a.id)
 			where b.slug = $1`
 
-	row := db.QueryRowContext(ctx, query, slug)
+	row := m.DB.QueryRowContext(ctx, query, slug)
 
 	var book Book
 
@@ -206,6 +348,9 @@ func (b *Book) GetBookBySlug(slug string) (*Book, error) {
 		&book.PublicationYear,
 		&book.Slug,
 		&book.Description,
+		&book.ISBN10,
+		&book.ISBN13,
+		&book.Covers,
 		&book.CreatedAt,
 		&book.UpdatedAt,
 		&book.Author.ID,
@@ -216,57 +361,157 @@ func (b *Book) GetBookBySlug(slug string) (*Book, error) {
 		return nil, err
 	}
 
-	// get genres
-	genres, ids, err := b.genresForBook(book.ID)
+	err = m.loadGenres(ctx, []*Book{&book})
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.loadContributors(ctx, []*Book{&book})
 	if err != nil {
 		return nil, err
 	}
-	book.Genres = genres
-	book.GenreIDs = ids
 
 	return &book, nil
 }
 
-func (b *Book) genresForBook(id int) ([]Genre, []int, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+// GetBookByISBN finds a book by its ISBN-13, which the caller has validated
+// and normalised with the isbn package.
+func (m BookModel) GetBookByISBN(ctx context.Context, isbn13 string) (*Book, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
 	defer cancel()
 
-	var genres []Genre
-	var genreIDs []int
+	query := `select b.id, b.title, b.author_id, b.publication_year, b.slug, b.description,
+			coalesce(b.isbn_10, ''), coalesce(b.isbn_13, ''), b.covers, b.created_at, b.updated_at,
+			a.id, a.author_name, a.created_at, a.updated_at
+			from books b
+			left join authors a on (b.author_id = a.id)
+			where b.isbn_13 = $1`
+
+	row := m.DB.QueryRowContext(ctx, query, isbn13)
+
+	var book Book
+
+	err := row.Scan(
+		&book.ID,
+		&book.Title,
+		&book.AuthorID,
+		&book.PublicationYear,
+		&book.Slug,
+		&book.Description,
+		&book.ISBN10,
+		&book.ISBN13,
+		&book.Covers,
+		&book.CreatedAt,
+		&book.UpdatedAt,
+		&book.Author.ID,
+		&book.Author.AuthorName,
+		&book.Author.CreatedAt,
+		&book.Author.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.loadGenres(ctx, []*Book{&book})
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.loadContributors(ctx, []*Book{&book})
+	if err != nil {
+		return nil, err
+	}
 
-	query := `select id, genre_name, created_at, updated_at from genres where id in
-  (select genre_id from books_genres where book_id = $1)`
+	return &book, nil
+}
 
-	genreRows, err := db.QueryContext(ctx, query, id)
-	if err != nil && err != sql.ErrNoRows {
-		return nil, nil, err
+// loadGenres fills in Genres and GenreIDs for every book in one query, so a
+// listing costs the same number of round trips however many books it holds.
+func (m BookModel) loadGenres(ctx context.Context, books []*Book) error {
+	if len(books) == 0 {
+		return nil
 	}
-	defer genreRows.Close()
 
-	var genre Genre
-	for genreRows.Next() {
-		err := genreRows.Scan(&genre.ID, &genre.GenreName, &genre.CreatedAt, &genre.UpdatedAt)
+	byID := make(map[int][]*Book, len(books))
+	ids := make([]int, 0, len(books))
+	for _, book := range books {
+		if _, ok := byID[book.ID]; !ok {
+			ids = append(ids, book.ID)
+		}
+		byID[book.ID] = append(byID[book.ID], book)
+	}
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	query := `select bg.book_id, g.id, g.genre_name, g.created_at, g.updated_at
+			from books_genres bg
+			join genres g on (g.id = bg.genre_id)
+			where bg.book_id = any($1)
+			order by bg.book_id, g.genre_name`
+
+	rows, err := m.DB.QueryContext(ctx, query, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bookID int
+		var genre Genre
+		err := rows.Scan(&bookID, &genre.ID, &genre.GenreName, &genre.CreatedAt, &genre.UpdatedAt)
 		if err != nil {
-			return nil, nil, err
+			return err
 		}
 
-		genres = append(genres, genre)
-		genreIDs = append(genreIDs, genre.ID)
+		for _, book := range byID[bookID] {
+			book.Genres = append(book.Genres, genre)
+			book.GenreIDs = append(book.GenreIDs, genre.ID)
+		}
 	}
 
-	return genres, genreIDs, nil
+	return rows.Err()
 }
 
-func (b *Book) Insert(book Book) (int, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+// Insert creates the book and its books_genres and books_authors rows in one
+// transaction. A book without Authors is credited to AuthorID alone.
+func (m BookModel) Insert(ctx context.Context, book Book) (int, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
 	defer cancel()
 
-	stmt := `insert into books (title, author_id, publication_year, slug, description, created_at, updated_at)
-  values ($1, $2, $3, $4, $5, $6, $7) returning id`
+	contributors := book.Authors
+	if contributors == nil && book.AuthorID != 0 {
+		contributors = []Contributor{{AuthorID: book.AuthorID, Role: ContributorAuthor}}
+	}
+	authorID := PrimaryAuthorID(contributors)
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt := `insert into books (title, author_id, publication_year, slug, description, isbn_10, isbn_13, created_at, updated_at)
+  values ($1, $2, $3, $4, $5, $6, $7, $8, $9) returning id`
 
 	var id int
-	err := db.QueryRowContext(ctx, stmt,
-		book.Title, book.AuthorID, book.PublicationYear, slugify.Slugify(book.Title), book.Description, time.Now(), time.Now()).Scan(&id)
+	err = tx.QueryRowContext(ctx, stmt,
+		book.Title, authorID, book.PublicationYear, slugify.Slugify(book.Title), book.Description,
+		nullString(book.ISBN10), nullString(book.ISBN13), time.Now(), time.Now()).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	err = setBookGenres(ctx, tx, id, book.GenreIDs)
+	if err != nil {
+		return 0, err
+	}
+
+	err = setBookContributors(ctx, tx, id, contributors)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
 	if err != nil {
 		return 0, err
 	}
@@ -274,70 +519,97 @@ func (b *Book) Insert(book Book) (int, error) {
 	return id, nil
 }
 
-func (b *Book) Update() error {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+// Update saves the book's columns and, when GenreIDs is non-nil, replaces its
+// genres. A nil GenreIDs leaves the existing genres alone; an empty one clears
+// them. Authors works the same way, and when it is set, AuthorID follows it.
+func (m BookModel) Update(ctx context.Context, book Book) error {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
 	defer cancel()
 
-	stmt := `update books set title = $1, author_id = $2, publication_year = $3, slug = $4, description = $5, updated_at = $6, where id = $7`
+	if book.Authors != nil {
+		book.AuthorID = PrimaryAuthorID(book.Authors)
+	}
 
-	_, err := db.ExecContext(ctx, stmt,
-		b.Title, b.AuthorID, b.PublicationYear, slugify.Slugify(b.Title), b.Description, time.Now(), b.ID)
+	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
+
+	stmt := `update books set title = $1, author_id = $2, publication_year = $3, slug = $4, description = $5,
+			isbn_10 = $6, isbn_13 = $7, updated_at = $8 where id = $9`
 
-	if len(b.Genres) > 0 {
-		stmt := `delete from books_genres where book_id = $1`
-		_, err := db.ExecContext(ctx, stmt, b.ID)
+	res, err := tx.ExecContext(ctx, stmt,
+		book.Title, book.AuthorID, book.PublicationYear, slugify.Slugify(book.Title), book.Description,
+		nullString(book.ISBN10), nullString(book.ISBN13), time.Now(), book.ID)
+	if err != nil {
+		return err
+	}
+
+	err = expectRows(res)
+	if err != nil {
+		return err
+	}
+
+	if book.GenreIDs != nil {
+		_, err := tx.ExecContext(ctx, `delete from books_genres where book_id = $1`, book.ID)
 		if err != nil {
-			return fmt.Errorf("book updated, but genres not updated: %s", err.Error())
+			return err
 		}
 
-		for _, x := range b.Genres {
-			stmt := `insert into books_genres (book_id, genre_id, created_at, updated_at) values ($1, $2, $3, $4)`
-			_, err := db.ExecContext(ctx, stmt, b.ID, x.ID, time.Now(), time.Now())
-			if err != nil {
-				return fmt.Errorf("book updated, but genres not updated: %s", err.Error())
-			}
+		err = setBookGenres(ctx, tx, book.ID, book.GenreIDs)
+		if err != nil {
+			return err
 		}
 	}
 
-	return nil
-}
+	if book.Authors != nil {
+		err = setBookContributors(ctx, tx, book.ID, book.Authors)
+		if err != nil {
+			return err
+		}
+	}
 
-func (b *Book) DeleteByID(id int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
-	defer cancel()
+	return tx.Commit()
+}
 
-	stmt := `delete from books where id = $1`
+func setBookGenres(ctx context.Context, tx *sql.Tx, bookID int, genreIDs []int) error {
+	stmt := `insert into books_genres (book_id, genre_id, created_at, updated_at) values ($1, $2, $3, $4)`
 
-	_, err := db.ExecContext(ctx, stmt, id)
-	if err != nil {
-		return err
+	for _, genreID := range genreIDs {
+		_, err := tx.ExecContext(ctx, stmt, bookID, genreID, time.Now(), time.Now())
+		if err != nil {
+			return fmt.Errorf("genre %d: %w", genreID, err)
+		}
 	}
 
 	return nil
 }
 
-func (a *Author) GetAllAuthors() ([]*Author, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+func (m BookModel) DeleteByID(ctx context.Context, id int) error {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
 	defer cancel()
 
-	query := `select id, author_name, created_at, updated_at from authors order by author_name`
-	rows, err := db.QueryContext(ctx, query)
+	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
-	var authors []*Author
+	defer tx.Rollback()
 
-	for rows.Next() {
-		var author Author
-		err := rows.Scan(&author.ID, &author.AuthorName, &author.CreatedAt, &author.UpdatedAt)
-		if err != nil {
-			return nil, err
-		}
-		authors = append(authors, &author)
+	_, err = tx.ExecContext(ctx, `delete from books_genres where book_id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `delete from books_authors where book_id = $1`, id)
+	if err != nil {
+		return err
 	}
-	return authors, nil
+
+	_, err = tx.ExecContext(ctx, `delete from books where id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
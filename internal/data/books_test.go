@@ -0,0 +1,76 @@
+package data
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// passThrough lets sqlmock accept the []int that loadGenres binds for any($1).
+type passThrough struct{}
+
+func (passThrough) ConvertValue(v interface{}) (driver.Value, error) {
+	return v, nil
+}
+
+// BenchmarkBookList_queries lists catalogs of growing size against a mock that
+// only expects a fixed number of statements, and reports how many were made.
+// A regression back to one genre or contributor query per book fails the
+// benchmark. It needs no database:
+//
+//	go test -tags nodocker -run '^$' -bench BookList ./internal/data
+func BenchmarkBookList_queries(b *testing.B) {
+	for _, size := range []int{10, 100, 500} {
+		b.Run(fmt.Sprintf("books=%d", size), func(b *testing.B) {
+			queries := 0
+			matcher := sqlmock.QueryMatcherFunc(func(expectedSQL, actualSQL string) error {
+				queries++
+				return sqlmock.QueryMatcherRegexp.Match(expectedSQL, actualSQL)
+			})
+
+			db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(matcher), sqlmock.ValueConverterOption(passThrough{}))
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer db.Close()
+
+			books := BookModel{DB: db}
+			now := time.Now()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				bookRows := sqlmock.NewRows([]string{"id", "title", "author_id", "publication_year", "slug", "description", "isbn_10", "isbn_13", "covers", "created_at", "updated_at",
+					"a_id", "author_name", "a_created_at", "a_updated_at"})
+				genreRows := sqlmock.NewRows([]string{"book_id", "id", "genre_name", "created_at", "updated_at"})
+				contributorRows := sqlmock.NewRows([]string{"book_id", "id", "author_name", "role"})
+				for id := 1; id <= size; id++ {
+					bookRows.AddRow(id, "Book", 1, 2020, "book", "", "", "", []byte("[]"), now, now, 1, "John Smith", now, now)
+					genreRows.AddRow(id, 3, "Romance", now, now)
+					contributorRows.AddRow(id, 1, "John Smith", "author")
+				}
+
+				mock.ExpectQuery("select count").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(size))
+				mock.ExpectQuery("from books b").WillReturnRows(bookRows)
+				mock.ExpectQuery("from books_genres bg").WillReturnRows(genreRows)
+				mock.ExpectQuery("from books_authors ba").WillReturnRows(contributorRows)
+				b.StartTimer()
+
+				list, _, err := books.List(context.Background(), BookFilter{})
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				if len(list) != size || len(list[size-1].Genres) != 1 || len(list[size-1].Authors) != 1 {
+					b.Fatalf("expected %d books with genres and authors, got %d", size, len(list))
+				}
+			}
+
+			b.ReportMetric(float64(queries)/float64(b.N), "queries/op")
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Roles an author can be credited in on a book.
+const (
+	ContributorAuthor      = "author"
+	ContributorEditor      = "editor"
+	ContributorTranslator  = "translator"
+	ContributorIllustrator = "illustrator"
+)
+
+var ErrInvalidContributorRole = errors.New("role must be author, editor, translator or illustrator")
+
+// Contributor credits an author on a book in one role. A book's contributors
+// are kept in order, and the first with the author role is also the book's
+// AuthorID.
+type Contributor struct {
+	AuthorID   int    `json:"author_id"`
+	AuthorName string `json:"author_name"`
+	Role       string `json:"role"`
+}
+
+// ValidContributorRole reports whether role is one the books_authors table
+// accepts.
+func ValidContributorRole(role string) bool {
+	switch role {
+	case ContributorAuthor, ContributorEditor, ContributorTranslator, ContributorIllustrator:
+		return true
+	}
+	return false
+}
+
+// PrimaryAuthorID is the author a book is filed under: its first contributor
+// in the author role, or for a book with none, such as an anthology credited
+// to its editor, its first contributor of any kind.
+func PrimaryAuthorID(contributors []Contributor) int {
+	for _, c := range contributors {
+		if c.Role == ContributorAuthor {
+			return c.AuthorID
+		}
+	}
+	if len(contributors) > 0 {
+		return contributors[0].AuthorID
+	}
+	return 0
+}
+
+// loadContributors fills in Authors for every book in one query, like
+// loadGenres.
+func (m BookModel) loadContributors(ctx context.Context, books []*Book) error {
+	if len(books) == 0 {
+		return nil
+	}
+
+	byID := make(map[int][]*Book, len(books))
+	ids := make([]int, 0, len(books))
+	for _, book := range books {
+		if _, ok := byID[book.ID]; !ok {
+			ids = append(ids, book.ID)
+		}
+		byID[book.ID] = append(byID[book.ID], book)
+	}
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	query := `select ba.book_id, a.id, a.author_name, ba.role
+			from books_authors ba
+			join authors a on (a.id = ba.author_id)
+			where ba.book_id = any($1)
+			order by ba.book_id, ba.position`
+
+	rows, err := m.DB.QueryContext(ctx, query, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bookID int
+		var c Contributor
+		err := rows.Scan(&bookID, &c.AuthorID, &c.AuthorName, &c.Role)
+		if err != nil {
+			return err
+		}
+
+		for _, book := range byID[bookID] {
+			book.Authors = append(book.Authors, c)
+		}
+	}
+
+	return rows.Err()
+}
+
+// setBookContributors replaces a book's contributors, numbering them in the
+// order given.
+func setBookContributors(ctx context.Context, tx *sql.Tx, bookID int, contributors []Contributor) error {
+	_, err := tx.ExecContext(ctx, `delete from books_authors where book_id = $1`, bookID)
+	if err != nil {
+		return err
+	}
+
+	stmt := `insert into books_authors (book_id, author_id, role, position, created_at, updated_at) values ($1, $2, $3, $4, $5, $6)`
+
+	for i, c := range contributors {
+		_, err := tx.ExecContext(ctx, stmt, bookID, c.AuthorID, c.Role, i, time.Now(), time.Now())
+		if err != nil {
+			return fmt.Errorf("author %d as %s: %w", c.AuthorID, c.Role, err)
+		}
+	}
+
+	return nil
+}
+
+// setPrimaryAuthor makes authorID the book's first author, leaving its other
+// contributors where they are, for writers such as Import that only know
+// about one author.
+func setPrimaryAuthor(ctx context.Context, tx *sql.Tx, bookID, authorID int) error {
+	var current int
+	err := tx.QueryRowContext(ctx, `select author_id from books_authors where book_id = $1 and role = $2 order by position limit 1`,
+		bookID, ContributorAuthor).Scan(&current)
+
+	switch {
+	case err == nil && current == authorID:
+		return nil
+	case err == nil:
+		// the new first author may already be credited further down
+		_, err = tx.ExecContext(ctx, `delete from books_authors where book_id = $1 and author_id = $2 and role = $3`,
+			bookID, authorID, ContributorAuthor)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `update books_authors set author_id = $3, updated_at = $5
+				where book_id = $1 and author_id = $2 and role = $4`,
+			bookID, current, authorID, ContributorAuthor, time.Now())
+		return err
+	case errors.Is(err, sql.ErrNoRows):
+		_, err = tx.ExecContext(ctx, `update books_authors set position = position + 1 where book_id = $1`, bookID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `insert into books_authors (book_id, author_id, role, position, created_at, updated_at)
+				values ($1, $2, $3, 0, $4, $4)`, bookID, authorID, ContributorAuthor, time.Now())
+		return err
+	default:
+		return err
+	}
+}
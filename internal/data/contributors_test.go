@@ -0,0 +1,21 @@
+package data
+
+import "testing"
+
+func TestPrimaryAuthorID(t *testing.T) {
+	var tests = []struct {
+		name         string
+		contributors []Contributor
+		expected     int
+	}{
+		{"first author", []Contributor{{AuthorID: 4, Role: "translator"}, {AuthorID: 5, Role: "author"}, {AuthorID: 6, Role: "author"}}, 5},
+		{"no author", []Contributor{{AuthorID: 7, Role: "editor"}, {AuthorID: 8, Role: "illustrator"}}, 7},
+		{"nobody", nil, 0},
+	}
+
+	for _, e := range tests {
+		if got := PrimaryAuthorID(e.contributors); got != e.expected {
+			t.Errorf("%s: expected %d, got %d", e.name, e.expected, got)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// CoverRendition is one stored size of a book's cover. Key is its name in the
+// cover store, which is also its path under /static/covers.
+type CoverRendition struct {
+	Name   string `json:"name"`
+	Key    string `json:"key"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// CoverRenditions is stored as a JSON array in books.covers.
+type CoverRenditions []CoverRendition
+
+func (c *CoverRenditions) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*c = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, c)
+	case string:
+		return json.Unmarshal([]byte(v), c)
+	default:
+		return fmt.Errorf("cannot scan %T into CoverRenditions", src)
+	}
+}
+
+// SetCovers records which cover renditions are stored for a book. An empty
+// list means the book has no cover.
+func (m BookModel) SetCovers(ctx context.Context, id int, covers CoverRenditions) error {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	if covers == nil {
+		covers = CoverRenditions{}
+	}
+
+	b, err := json.Marshal(covers)
+	if err != nil {
+		return err
+	}
+
+	stmt := `update books set covers = $1::jsonb, updated_at = $2 where id = $3`
+	res, err := m.DB.ExecContext(ctx, stmt, string(b), time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return expectRows(res)
+}
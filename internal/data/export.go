@@ -0,0 +1,144 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// The Each methods read a whole table one row at a time, for exports that
+// shouldn't have to hold the catalog in memory. They run for as long as fn
+// takes to consume the rows, so only ctx bounds them, not the model's
+// timeout. An error from fn stops the iteration and is returned.
+
+// Each calls fn with every book matching f, in f's order, with its author,
+// contributors and genres filled in. Paging in f is ignored.
+func (m BookModel) Each(ctx context.Context, f BookFilter, fn func(*Book) error) error {
+	orderBy, err := f.orderBy()
+	if err != nil {
+		return err
+	}
+
+	query := `select b.id, b.title, b.author_id, b.publication_year, b.slug, b.description,
+			coalesce(b.isbn_10, ''), coalesce(b.isbn_13, ''), b.covers, b.created_at, b.updated_at,
+			a.id, a.author_name, a.created_at, a.updated_at,
+			coalesce((select json_agg(json_build_object('author_id', ca.id, 'author_name', ca.author_name, 'role', ba.role) order by ba.position)
+				from books_authors ba join authors ca on (ca.id = ba.author_id)
+				where ba.book_id = b.id), '[]'),
+			coalesce((select json_agg(json_build_object('id', g.id, 'genre_name', g.genre_name) order by g.genre_name)
+				from books_genres bg join genres g on (g.id = bg.genre_id)
+				where bg.book_id = b.id), '[]')
+			from books b
+			left join authors a on (b.author_id = a.id)
+			` + bookFilterWhere + `
+			order by ` + orderBy
+
+	rows, err := m.DB.QueryContext(ctx, query, f.AuthorID, f.GenreID, f.YearFrom, f.YearTo)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var book Book
+		var contributors, genres []byte
+		err := rows.Scan(
+			&book.ID,
+			&book.Title,
+			&book.AuthorID,
+			&book.PublicationYear,
+			&book.Slug,
+			&book.Description,
+			&book.ISBN10,
+			&book.ISBN13,
+			&book.Covers,
+			&book.CreatedAt,
+			&book.UpdatedAt,
+			&book.Author.ID,
+			&book.Author.AuthorName,
+			&book.Author.CreatedAt,
+			&book.Author.UpdatedAt,
+			&contributors,
+			&genres)
+		if err != nil {
+			return err
+		}
+
+		err = json.Unmarshal(contributors, &book.Authors)
+		if err != nil {
+			return err
+		}
+
+		err = json.Unmarshal(genres, &book.Genres)
+		if err != nil {
+			return err
+		}
+		for _, genre := range book.Genres {
+			book.GenreIDs = append(book.GenreIDs, genre.ID)
+		}
+
+		err = fn(&book)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// Each calls fn with every author, by name, with the number of books they
+// are credited on.
+func (m AuthorModel) Each(ctx context.Context, fn func(*Author) error) error {
+	query := `select a.id, a.author_name, a.created_at, a.updated_at,
+			(select count(distinct ba.book_id) from books_authors ba where ba.author_id = a.id)
+			from authors a order by a.author_name, a.id`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var author Author
+		err := rows.Scan(&author.ID, &author.AuthorName, &author.CreatedAt, &author.UpdatedAt, &author.BookCount)
+		if err != nil {
+			return err
+		}
+
+		err = fn(&author)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// Each calls fn with every genre, by name, with the number of books filed
+// under it.
+func (m GenreModel) Each(ctx context.Context, fn func(*Genre) error) error {
+	query := `select g.id, g.genre_name, g.created_at, g.updated_at,
+			(select count(bg.book_id) from books_genres bg where bg.genre_id = g.id)
+			from genres g order by g.genre_name, g.id`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var genre Genre
+		err := rows.Scan(&genre.ID, &genre.GenreName, &genre.CreatedAt, &genre.UpdatedAt, &genre.BookCount)
+		if err != nil {
+			return err
+		}
+
+		err = fn(&genre)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
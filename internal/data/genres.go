@@ -0,0 +1,139 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrGenreNameNeeded = errors.New("genre name is required")
+
+type GenreModel struct {
+	DB      *sql.DB
+	Timeout time.Duration
+}
+
+type Genre struct {
+	ID        int       `json:"id"`
+	GenreName string    `json:"genre_name"`
+	BookCount int       `json:"book_count,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// GetAll returns every genre with the number of books filed under it.
+func (m GenreModel) GetAll(ctx context.Context) ([]*Genre, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	query := `select g.id, g.genre_name, g.created_at, g.updated_at, count(bg.book_id)
+			from genres g
+			left join books_genres bg on (bg.genre_id = g.id)
+			group by g.id, g.genre_name, g.created_at, g.updated_at
+			order by g.genre_name`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var genres []*Genre
+
+	for rows.Next() {
+		var genre Genre
+		err := rows.Scan(&genre.ID, &genre.GenreName, &genre.CreatedAt, &genre.UpdatedAt, &genre.BookCount)
+		if err != nil {
+			return nil, err
+		}
+		genres = append(genres, &genre)
+	}
+
+	return genres, rows.Err()
+}
+
+func (m GenreModel) GetByID(ctx context.Context, id int) (*Genre, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	query := `select g.id, g.genre_name, g.created_at, g.updated_at,
+			(select count(bg.book_id) from books_genres bg where bg.genre_id = g.id)
+			from genres g where g.id = $1`
+
+	var genre Genre
+	row := m.DB.QueryRowContext(ctx, query, id)
+
+	err := row.Scan(&genre.ID, &genre.GenreName, &genre.CreatedAt, &genre.UpdatedAt, &genre.BookCount)
+	if err != nil {
+		return nil, err
+	}
+
+	return &genre, nil
+}
+
+func (m GenreModel) Insert(ctx context.Context, genre Genre) (int, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	if genre.GenreName == "" {
+		return 0, ErrGenreNameNeeded
+	}
+
+	stmt := `insert into genres (genre_name, created_at, updated_at) values ($1, $2, $3) returning id`
+
+	var id int
+	err := m.DB.QueryRowContext(ctx, stmt, genre.GenreName, time.Now(), time.Now()).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (m GenreModel) Update(ctx context.Context, genre Genre) error {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	if genre.GenreName == "" {
+		return ErrGenreNameNeeded
+	}
+
+	stmt := `update genres set genre_name = $1, updated_at = $2 where id = $3`
+
+	res, err := m.DB.ExecContext(ctx, stmt, genre.GenreName, time.Now(), genre.ID)
+	if err != nil {
+		return err
+	}
+
+	return expectRows(res)
+}
+
+// Delete removes the genre and untags every book that was filed under it.
+func (m GenreModel) Delete(ctx context.Context, id int) error {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `delete from books_genres where genre_id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.ExecContext(ctx, `delete from genres where id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	err = expectRows(res)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,428 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/mozillazg/go-slugify"
+)
+
+// queryCanceled is the SQLSTATE of a statement cancelled by statement_timeout.
+const queryCanceled = "57014"
+
+// Outcomes of an imported row.
+const (
+	ImportCreated = "created"
+	ImportUpdated = "updated"
+	ImportSkipped = "skipped"
+	ImportFailed  = "failed"
+)
+
+// ImportRow is one book read from an import file. The author and genres are
+// given by name, and are created when the catalog doesn't have them yet.
+type ImportRow struct {
+	Line            int      `json:"line"`
+	Title           string   `json:"title"`
+	Author          string   `json:"author"`
+	PublicationYear int      `json:"publication_year"`
+	Description     string   `json:"description"`
+	Genres          []string `json:"genres"`
+
+	// Problem is set when the line itself couldn't be read. Import reports
+	// such rows as failed without touching the database.
+	Problem string `json:"-"`
+}
+
+// ImportOptions controls how Import treats the catalog.
+type ImportOptions struct {
+	// DryRun rolls the whole import back once every row has been tried, so
+	// the report shows what would happen without changing anything.
+	DryRun bool
+
+	// SkipExisting leaves books that are already in the catalog alone
+	// instead of updating them from the row.
+	SkipExisting bool
+}
+
+// ImportResult says what happened to one row. Reason explains a skipped or
+// failed row.
+type ImportResult struct {
+	Line      int      `json:"line"`
+	Status    string   `json:"status"`
+	Slug      string   `json:"slug,omitempty"`
+	BookID    int      `json:"book_id,omitempty"`
+	Reason    string   `json:"reason,omitempty"`
+	NewAuthor bool     `json:"new_author,omitempty"`
+	NewGenres []string `json:"new_genres,omitempty"`
+}
+
+type ImportReport struct {
+	DryRun  bool           `json:"dry_run"`
+	Created int            `json:"created"`
+	Updated int            `json:"updated"`
+	Skipped int            `json:"skipped"`
+	Failed  int            `json:"failed"`
+	Rows    []ImportResult `json:"rows"`
+}
+
+func (r *ImportReport) add(result ImportResult) {
+	switch result.Status {
+	case ImportCreated:
+		r.Created++
+	case ImportUpdated:
+		r.Updated++
+	case ImportSkipped:
+		r.Skipped++
+	case ImportFailed:
+		r.Failed++
+	}
+
+	r.Rows = append(r.Rows, result)
+}
+
+// Import adds rows to the catalog in a single transaction. Books are matched
+// on slug: a new slug creates a book, and an existing one is updated unless
+// nothing changed or opts.SkipExisting is set. A row that fails is rolled
+// back on its own and reported, and the rest of the import carries on; the
+// returned error is for failures that end the whole import.
+//
+// Each statement, rather than the whole import, is bounded by the model's
+// timeout, so large files aren't cut short; only ctx bounds the import as a
+// whole. Postgres enforces the timeout itself, as a statement_timeout, so a
+// row that runs out of time fails on its own and the connection survives,
+// which a cancelled ctx doesn't allow.
+func (m BookModel) Import(ctx context.Context, rows []ImportRow, opts ImportOptions) (*ImportReport, error) {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if m.Timeout > 0 {
+		// like set local, it lasts until the end of the transaction
+		_, err = tx.ExecContext(ctx, `select set_config('statement_timeout', $1, true)`, strconv.FormatInt(m.Timeout.Milliseconds(), 10))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	imp := bookImport{tx: tx, timeout: m.Timeout, opts: opts, seen: make(map[string]int)}
+	report := &ImportReport{DryRun: opts.DryRun, Rows: make([]ImportResult, 0, len(rows))}
+
+	for _, row := range rows {
+		result, err := imp.row(ctx, row)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", row.Line, err)
+		}
+
+		// ids from a transaction that is rolled back don't mean anything
+		if opts.DryRun {
+			result.BookID = 0
+		}
+
+		report.add(result)
+	}
+
+	if opts.DryRun {
+		return report, nil
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+type bookImport struct {
+	tx      *sql.Tx
+	timeout time.Duration
+	opts    ImportOptions
+
+	// seen maps the slugs imported so far to the line they came from
+	seen map[string]int
+}
+
+// row imports one row inside a savepoint, so that its failure only undoes its
+// own changes. The error is only for failures of the savepoint itself.
+func (imp *bookImport) row(ctx context.Context, row ImportRow) (ImportResult, error) {
+	result := ImportResult{Line: row.Line, Status: ImportFailed}
+
+	row.Title = strings.TrimSpace(row.Title)
+	row.Author = strings.TrimSpace(row.Author)
+	result.Slug = slugify.Slugify(row.Title)
+
+	switch {
+	case row.Problem != "":
+		result.Reason = row.Problem
+		return result, nil
+	case row.Title == "":
+		result.Reason = "title is required"
+		return result, nil
+	case row.Author == "":
+		result.Reason = ErrAuthorNameNeeded.Error()
+		return result, nil
+	case row.PublicationYear < 0:
+		result.Reason = "publication year can't be negative"
+		return result, nil
+	}
+
+	if line, ok := imp.seen[result.Slug]; ok {
+		result.Status = ImportSkipped
+		result.Reason = fmt.Sprintf("same book as line %d", line)
+		return result, nil
+	}
+
+	_, err := imp.tx.ExecContext(ctx, `savepoint import_row`)
+	if err != nil {
+		return result, err
+	}
+
+	err = imp.save(ctx, row, &result)
+	if err != nil {
+		_, rbErr := imp.tx.ExecContext(ctx, `rollback to savepoint import_row`)
+		if rbErr != nil {
+			return result, rbErr
+		}
+
+		_, rbErr = imp.tx.ExecContext(ctx, `release savepoint import_row`)
+		if rbErr != nil {
+			return result, rbErr
+		}
+
+		result.Status = ImportFailed
+		result.BookID = 0
+		result.NewAuthor = false
+		result.NewGenres = nil
+		result.Reason = err.Error()
+
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == queryCanceled {
+			result.Reason = fmt.Sprintf("took longer than %s", imp.timeout)
+		}
+		return result, nil
+	}
+
+	_, err = imp.tx.ExecContext(ctx, `release savepoint import_row`)
+	if err != nil {
+		return result, err
+	}
+
+	imp.seen[result.Slug] = row.Line
+
+	return result, nil
+}
+
+func (imp *bookImport) save(ctx context.Context, row ImportRow, result *ImportResult) error {
+	var existing Book
+	err := imp.tx.QueryRowContext(ctx,
+		`select id, title, coalesce(author_id, 0), coalesce(publication_year, 0), coalesce(description, '')
+		from books where slug = $1 order by id limit 1 for update`, result.Slug).
+		Scan(&existing.ID, &existing.Title, &existing.AuthorID, &existing.PublicationYear, &existing.Description)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	found := err == nil
+
+	if found && imp.opts.SkipExisting {
+		result.Status = ImportSkipped
+		result.BookID = existing.ID
+		result.Reason = "already in the catalog"
+		return nil
+	}
+
+	authorID, newAuthor, err := imp.authorID(ctx, row.Author)
+	if err != nil {
+		return err
+	}
+	result.NewAuthor = newAuthor
+
+	genreIDs, newGenres, err := imp.genreIDs(ctx, row.Genres)
+	if err != nil {
+		return err
+	}
+	result.NewGenres = newGenres
+
+	if !found {
+		stmt := `insert into books (title, author_id, publication_year, slug, description, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7) returning id`
+
+		var id int
+		err = imp.tx.QueryRowContext(ctx, stmt,
+			row.Title, authorID, row.PublicationYear, result.Slug, row.Description, time.Now(), time.Now()).Scan(&id)
+		if err != nil {
+			return err
+		}
+
+		err = setBookGenres(ctx, imp.tx, id, genreIDs)
+		if err != nil {
+			return err
+		}
+
+		if authorID != 0 {
+			err = setBookContributors(ctx, imp.tx, id, []Contributor{{AuthorID: authorID, Role: ContributorAuthor}})
+			if err != nil {
+				return err
+			}
+		}
+
+		result.Status = ImportCreated
+		result.BookID = id
+		return nil
+	}
+
+	result.BookID = existing.ID
+
+	// like Update, a row without genres leaves the book's genres alone
+	genresChanged := false
+	if len(genreIDs) > 0 {
+		current, err := imp.bookGenreIDs(ctx, existing.ID)
+		if err != nil {
+			return err
+		}
+		genresChanged = !sameIDs(current, genreIDs)
+	}
+
+	changed := existing.Title != row.Title || existing.AuthorID != authorID ||
+		existing.PublicationYear != row.PublicationYear || existing.Description != row.Description
+	if !changed && !genresChanged {
+		result.Status = ImportSkipped
+		result.Reason = "no changes"
+		return nil
+	}
+
+	if changed {
+		stmt := `update books set title = $1, author_id = $2, publication_year = $3, description = $4, updated_at = $5 where id = $6`
+		_, err = imp.tx.ExecContext(ctx, stmt, row.Title, authorID, row.PublicationYear, row.Description, time.Now(), existing.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	// an import row names one author, so co-authors and editors stay put
+	if authorID != 0 && authorID != existing.AuthorID {
+		err = setPrimaryAuthor(ctx, imp.tx, existing.ID, authorID)
+		if err != nil {
+			return err
+		}
+	}
+
+	if genresChanged {
+		_, err = imp.tx.ExecContext(ctx, `delete from books_genres where book_id = $1`, existing.ID)
+		if err != nil {
+			return err
+		}
+
+		err = setBookGenres(ctx, imp.tx, existing.ID, genreIDs)
+		if err != nil {
+			return err
+		}
+	}
+
+	result.Status = ImportUpdated
+	return nil
+}
+
+// authorID finds the author by name, ignoring case, and creates them when
+// there is no match. The bool reports whether the author is new.
+func (imp *bookImport) authorID(ctx context.Context, name string) (int, bool, error) {
+	var id int
+	err := imp.tx.QueryRowContext(ctx,
+		`select id from authors where lower(author_name) = lower($1) order by id limit 1`, name).Scan(&id)
+	if err == nil {
+		return id, false, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, false, err
+	}
+
+	err = imp.tx.QueryRowContext(ctx,
+		`insert into authors (author_name, created_at, updated_at) values ($1, $2, $3) returning id`,
+		name, time.Now(), time.Now()).Scan(&id)
+	if err != nil {
+		return 0, false, err
+	}
+
+	return id, true, nil
+}
+
+// genreIDs is authorID for a list of genres. It returns the ids of all of
+// them and the names of the ones it had to create.
+func (imp *bookImport) genreIDs(ctx context.Context, names []string) ([]int, []string, error) {
+	var ids []int
+	var created []string
+	seen := make(map[string]bool)
+
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[strings.ToLower(name)] {
+			continue
+		}
+		seen[strings.ToLower(name)] = true
+
+		var id int
+		err := imp.tx.QueryRowContext(ctx,
+			`select id from genres where lower(genre_name) = lower($1) order by id limit 1`, name).Scan(&id)
+		if errors.Is(err, sql.ErrNoRows) {
+			err = imp.tx.QueryRowContext(ctx,
+				`insert into genres (genre_name, created_at, updated_at) values ($1, $2, $3) returning id`,
+				name, time.Now(), time.Now()).Scan(&id)
+			created = append(created, name)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("genre %q: %w", name, err)
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, created, nil
+}
+
+func (imp *bookImport) bookGenreIDs(ctx context.Context, bookID int) ([]int, error) {
+	rows, err := imp.tx.QueryContext(ctx, `select genre_id from books_genres where book_id = $1`, bookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// sameIDs reports whether a and b hold the same ids in any order.
+func sameIDs(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	a = append([]int(nil), a...)
+	b = append([]int(nil), b...)
+	sort.Ints(a)
+	sort.Ints(b)
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,51 @@
+package data
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jackc/pgconn"
+)
+
+func TestBookModel_Import_rowTimeout(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	timedOut := &pgconn.PgError{Severity: "ERROR", Code: queryCanceled, Message: "canceling statement due to statement timeout"}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("set_config\\('statement_timeout'").WithArgs("3000").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("^savepoint import_row").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("from books where slug").WillReturnError(timedOut)
+	mock.ExpectExec("rollback to savepoint import_row").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("release savepoint import_row").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	books := BookModel{DB: db, Timeout: 3 * time.Second}
+	report, err := books.Import(context.Background(), []ImportRow{
+		{Line: 2, Title: "Dune", Author: "Frank Herbert"},
+		{Line: 3, Author: "Jane Austen"},
+	}, ImportOptions{})
+	if err != nil {
+		t.Fatalf("expected the import to carry on, got %v", err)
+	}
+
+	if report.Failed != 2 || len(report.Rows) != 2 {
+		t.Fatalf("expected both rows to fail, got %+v", report)
+	}
+	if report.Rows[0].Reason != "took longer than 3s" {
+		t.Errorf("expected the timed out row to say so, got %q", report.Rows[0].Reason)
+	}
+	if report.Rows[1].Reason != "title is required" {
+		t.Errorf("expected the next row to be tried, got %q", report.Rows[1].Reason)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
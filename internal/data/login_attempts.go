@@ -0,0 +1,125 @@
+package data
+
+import (
+	"context"
+	"time"
+)
+
+// LoginPolicy decides how long an account has to wait before the next login
+// attempt after a run of failures. The first FreeAttempts failures cost
+// nothing; after that the wait starts at BaseDelay and doubles each time, up
+// to MaxDelay. LockoutAttempts failures lock the account for LockoutDuration,
+// or until an admin unlocks it.
+type LoginPolicy struct {
+	FreeAttempts    int
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	LockoutAttempts int
+	LockoutDuration time.Duration
+}
+
+var DefaultLoginPolicy = LoginPolicy{
+	FreeAttempts:    3,
+	BaseDelay:       time.Second,
+	MaxDelay:        time.Minute,
+	LockoutAttempts: 10,
+	LockoutDuration: 15 * time.Minute,
+}
+
+// Delay returns how long to refuse logins after the given number of
+// consecutive failures. A zero policy never delays.
+func (p LoginPolicy) Delay(failures int) time.Duration {
+	if p.LockoutAttempts > 0 && failures >= p.LockoutAttempts {
+		return p.LockoutDuration
+	}
+
+	if p.BaseDelay <= 0 || failures <= p.FreeAttempts {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := p.FreeAttempts + 1; i < failures; i++ {
+		delay *= 2
+		if p.MaxDelay > 0 && delay >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+
+	return delay
+}
+
+// failuresAfter is the failure count to carry on from at now: the count is
+// dropped once a full lockout has expired, but kept through the shorter
+// delays so they keep doubling.
+func (p LoginPolicy) failuresAfter(failures int, lockedUntil *time.Time, now time.Time) int {
+	if p.LockoutAttempts > 0 && failures >= p.LockoutAttempts && lockedUntil != nil && !lockedUntil.After(now) {
+		return 0
+	}
+	return failures
+}
+
+// LockedAt reports whether the user still has to wait at now before trying to
+// log in again.
+func (u *User) LockedAt(now time.Time) bool {
+	return u.LockedUntil != nil && u.LockedUntil.After(now)
+}
+
+// RecordFailedLogin counts a failed login against the user and returns the
+// time until which further attempts are refused, which is zero when p allows
+// another attempt straight away. Once a lockout has run out the count starts
+// again, so the next failure doesn't lock the account straight back.
+func (m UserModel) RecordFailedLogin(ctx context.Context, id int, p LoginPolicy) (time.Time, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer tx.Rollback()
+
+	// the row lock keeps concurrent failures from losing a count
+	var failures int
+	var previous *time.Time
+	err = tx.QueryRowContext(ctx, `select failed_logins, locked_until from users where id = $1 for update`, id).Scan(&failures, &previous)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	failures = p.failuresAfter(failures, previous, time.Now()) + 1
+
+	var lockedUntil time.Time
+	if delay := p.Delay(failures); delay > 0 {
+		lockedUntil = time.Now().Add(delay)
+	}
+
+	_, err = tx.ExecContext(ctx, `update users set failed_logins = $1, locked_until = $2 where id = $3`,
+		failures, nullTime(lockedUntil), id)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return lockedUntil, tx.Commit()
+}
+
+// ClearFailedLogins resets the failure count and lifts any lock. It runs on a
+// successful login and when an admin unlocks an account.
+func (m UserModel) ClearFailedLogins(ctx context.Context, id int) error {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	stmt := `update users set failed_logins = 0, locked_until = null where id = $1`
+	res, err := m.DB.ExecContext(ctx, stmt, id)
+	if err != nil {
+		return err
+	}
+
+	return expectRows(res)
+}
+
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
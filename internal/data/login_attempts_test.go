@@ -0,0 +1,64 @@
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginPolicy_Delay(t *testing.T) {
+	p := LoginPolicy{
+		FreeAttempts:    3,
+		BaseDelay:       time.Second,
+		MaxDelay:        10 * time.Second,
+		LockoutAttempts: 10,
+		LockoutDuration: 15 * time.Minute,
+	}
+
+	var tests = []struct {
+		failures int
+		expected time.Duration
+	}{
+		{1, 0},
+		{3, 0},
+		{4, time.Second},
+		{5, 2 * time.Second},
+		{7, 8 * time.Second},
+		{8, 10 * time.Second},
+		{9, 10 * time.Second},
+		{10, 15 * time.Minute},
+		{25, 15 * time.Minute},
+	}
+
+	for _, e := range tests {
+		if got := p.Delay(e.failures); got != e.expected {
+			t.Errorf("%d failures: expected %s, got %s", e.failures, e.expected, got)
+		}
+	}
+
+	if got := (LoginPolicy{}).Delay(100); got != 0 {
+		t.Errorf("zero policy: expected no delay, got %s", got)
+	}
+}
+
+func TestLoginPolicy_failuresAfter(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Minute)
+
+	var tests = []struct {
+		name        string
+		failures    int
+		lockedUntil *time.Time
+		expected    int
+	}{
+		{"never locked", 2, nil, 2},
+		{"short delay has passed", 5, &past, 5},
+		{"still locked out", 10, &future, 10},
+		{"lockout has run out", 12, &past, 0},
+	}
+
+	for _, e := range tests {
+		if got := DefaultLoginPolicy.failuresAfter(e.failures, e.lockedUntil, now); got != e.expected {
+			t.Errorf("%s: expected %d, got %d", e.name, e.expected, got)
+		}
+	}
+}
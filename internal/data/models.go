@@ -2,23 +2,106 @@ package data
 
 import (
 	"context"
-	"crypto/rand"
-	"crypto/sha256"
 	"database/sql"
-	"encoding/base32"
 	"errors"
 	"net/http"
-	"strings"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
+// Models groups the repositories backed by a single database handle. Fields
+// are interfaces so callers can swap in fakes, and several Models can point at
+// different databases in the same process.
 type Models struct {
-	User   User
-	Token  Token
-	Book   Book
-	Author Author
+	DB     *sql.DB
+	User   UserRepository
+	Token  TokenRepository
+	Book   BookRepository
+	Author AuthorRepository
+	Genre  GenreRepository
+
+	OneTimeToken OneTimeTokenRepository
+	Settings     SettingsRepository
+	Audit        AuditRepository
+}
+
+type UserRepository interface {
+	GetAll(ctx context.Context) ([]*User, error)
+	GetByEmail(ctx context.Context, email string) (*User, error)
+	GetUserById(ctx context.Context, id int) (*User, error)
+	Update(ctx context.Context, user User) error
+	Delete(ctx context.Context, user User) error
+	DeleteByID(ctx context.Context, id int) error
+	Insert(ctx context.Context, user User) (int, error)
+	ResetPassword(ctx context.Context, id int, password string) error
+	RecordFailedLogin(ctx context.Context, id int, p LoginPolicy) (time.Time, error)
+	ClearFailedLogins(ctx context.Context, id int) error
+}
+
+type TokenRepository interface {
+	GetByToken(ctx context.Context, plainText string) (*Token, error)
+	GetUserForToken(ctx context.Context, token Token) (*User, error)
+	GenerateToken(userID int, ttl time.Duration) (*Token, error)
+	AuthenticateToken(r *http.Request) (*User, error)
+	Insert(ctx context.Context, token Token, u User) error
+	InsertWithRefresh(ctx context.Context, access, refresh Token, u User) error
+	Refresh(ctx context.Context, plainText string, accessTTL, refreshTTL time.Duration) (*Token, *Token, error)
+	DeleteByToken(ctx context.Context, token string) error
+	ValidToken(ctx context.Context, plainText string) (bool, error)
+	DeleteTokensForUser(ctx context.Context, id int) error
+	SessionsForUser(ctx context.Context, userID int) ([]*Token, error)
+	DeleteSession(ctx context.Context, userID, id int) error
+}
+
+type BookRepository interface {
+	GetAll(ctx context.Context) ([]*Book, error)
+	GetAllPaginated(ctx context.Context, page, pageSize int) ([]*Book, error)
+	List(ctx context.Context, f BookFilter) ([]*Book, int, error)
+	Search(ctx context.Context, q string, page, pageSize int) ([]*BookSearchResult, int, error)
+	GetBookById(ctx context.Context, id int) (*Book, error)
+	GetBookBySlug(ctx context.Context, slug string) (*Book, error)
+	GetBookByISBN(ctx context.Context, isbn13 string) (*Book, error)
+	Insert(ctx context.Context, book Book) (int, error)
+	Update(ctx context.Context, book Book) error
+	SetCovers(ctx context.Context, id int, covers CoverRenditions) error
+	Import(ctx context.Context, rows []ImportRow, opts ImportOptions) (*ImportReport, error)
+	Each(ctx context.Context, f BookFilter, fn func(*Book) error) error
+	DeleteByID(ctx context.Context, id int) error
+}
+
+type AuthorRepository interface {
+	GetAllAuthors(ctx context.Context) ([]*Author, error)
+	GetByID(ctx context.Context, id int) (*Author, error)
+	Insert(ctx context.Context, author Author) (int, error)
+	Update(ctx context.Context, author Author) error
+	Delete(ctx context.Context, id int) error
+	Merge(ctx context.Context, keepID, duplicateID int) (int, error)
+	Each(ctx context.Context, fn func(*Author) error) error
+}
+
+type OneTimeTokenRepository interface {
+	Create(ctx context.Context, userID int, scope string, ttl time.Duration) (string, error)
+	Consume(ctx context.Context, scope, plainText string) (int, error)
+}
+
+type AuditRepository interface {
+	Insert(ctx context.Context, e AuditEvent) error
+	List(ctx context.Context, f AuditFilter) ([]*AuditEvent, int, error)
+}
+
+type SettingsRepository interface {
+	RegistrationOpen(ctx context.Context) (bool, error)
+	SetRegistrationOpen(ctx context.Context, open bool) error
+}
+
+type GenreRepository interface {
+	GetAll(ctx context.Context) ([]*Genre, error)
+	GetByID(ctx context.Context, id int) (*Genre, error)
+	Insert(ctx context.Context, genre Genre) (int, error)
+	Update(ctx context.Context, genre Genre) error
+	Delete(ctx context.Context, id int) error
+	Each(ctx context.Context, fn func(*Genre) error) error
 }
 
 type User struct {
@@ -28,50 +111,70 @@ type User struct {
 	Email     string    `json:"email"`
 	Password  string    `json:"password"`
 	Active    int       `json:"active"`
+	Role      string    `json:"role"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 	Token     Token     `json:"token"`
-}
 
-type Token struct {
-	ID        int       `json:"id"`
-	UserID    int       `json:"user_id"`
-	Email     string    `json:"email"`
-	Token     string    `json:"token"`
-	TokenHash []byte    `json:"-"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Expiry    time.Time `json:"expiry"`
+	FailedLogins int        `json:"failed_logins"`
+	LockedUntil  *time.Time `json:"locked_until"`
+	Locked       bool       `json:"locked"`
 }
 
+// dbTimeout is the per-query deadline used when a model has no Timeout set.
 const dbTimeout = time.Second * 3
 
-var db *sql.DB
-
 func New(dbPool *sql.DB) Models {
-	db = dbPool
+	return NewWithTimeout(dbPool, dbTimeout)
+}
 
+// NewWithTimeout is like New, but bounds every query by timeout instead of the
+// default. The caller's context can still cancel a query sooner.
+func NewWithTimeout(dbPool *sql.DB, timeout time.Duration) Models {
 	return Models{
-		User:   User{},
-		Token:  Token{},
-		Book:   Book{},
-		Author: Author{},
+		DB:     dbPool,
+		User:   UserModel{DB: dbPool, Timeout: timeout},
+		Token:  TokenModel{DB: dbPool, Timeout: timeout},
+		Book:   BookModel{DB: dbPool, Timeout: timeout},
+		Author: AuthorModel{DB: dbPool, Timeout: timeout},
+		Genre:  GenreModel{DB: dbPool, Timeout: timeout},
+
+		OneTimeToken: OneTimeTokenModel{DB: dbPool, Timeout: timeout},
+		Settings:     SettingsModel{DB: dbPool, Timeout: timeout},
+		Audit:        AuditModel{DB: dbPool, Timeout: timeout},
 	}
 }
 
-func (u *User) GetAll() ([]*User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+// withTimeout derives a query context from ctx, falling back to dbTimeout when
+// the model was built without one.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		timeout = dbTimeout
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+type UserModel struct {
+	DB      *sql.DB
+	Timeout time.Duration
+}
+
+func (m UserModel) GetAll(ctx context.Context) ([]*User, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
 	defer cancel()
 
 	query := `select id, first_name, last_name, email, password, user_active, created_at, updated_at,
+	(select role_name from roles where roles.id = users.role_id) as role,
 	case
 		when (select count(id) from tokens t where user_id = users.id and t.expiry > now()) > 0 then 1
 		else 0
-	end as has_token
+	end as has_token,
+	failed_logins, locked_until
 
 	from users order by last_name`
 
-	rows, err := db.QueryContext(ctx, query)
+	rows, err := m.DB.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -82,71 +185,90 @@ func (u *User) GetAll() ([]*User, error) {
 
 	for rows.Next() {
 		var user User
-		err := rows.Scan(&user.ID, &user.FirstName, &user.LastName, &user.Email, &user.Password, &user.Active, &user.CreatedAt, &user.UpdatedAt, &user.Token.ID)
+		err := rows.Scan(&user.ID, &user.FirstName, &user.LastName, &user.Email, &user.Password, &user.Active, &user.CreatedAt, &user.UpdatedAt, &user.Role, &user.Token.ID,
+			&user.FailedLogins, &user.LockedUntil)
 		if err != nil {
 			return nil, err
 		}
 
+		user.Locked = user.LockedAt(time.Now())
+
 		users = append(users, &user)
 	}
 
 	return users, nil
 }
 
-func (u *User) GetByEmail(email string) (*User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+func (m UserModel) GetByEmail(ctx context.Context, email string) (*User, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
 	defer cancel()
 
-	query := `select id, first_name, last_name, email, password, user_active,  created_at, updated_at from users where email = $1`
+	query := `select id, first_name, last_name, email, password, user_active, created_at, updated_at,
+	(select role_name from roles where roles.id = users.role_id) as role, failed_logins, locked_until
+	from users where email = $1`
 
-	row := db.QueryRowContext(ctx, query, email)
+	row := m.DB.QueryRowContext(ctx, query, email)
 	var user User
-	err := row.Scan(&user.ID, &user.FirstName, &user.LastName, &user.Email, &user.Password, &user.Active, &user.CreatedAt, &user.UpdatedAt)
+	err := row.Scan(&user.ID, &user.FirstName, &user.LastName, &user.Email, &user.Password, &user.Active, &user.CreatedAt, &user.UpdatedAt, &user.Role,
+		&user.FailedLogins, &user.LockedUntil)
 	if err != nil {
 		return nil, err
 	}
 
+	user.Locked = user.LockedAt(time.Now())
+
 	return &user, nil
 }
 
-func (u *User) GetUserById(id int) (*User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+func (m UserModel) GetUserById(ctx context.Context, id int) (*User, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
 	defer cancel()
 
-	query := `select id, first_name, last_name, email, password, user_active, created_at, updated_at from users where id = $1`
+	query := `select id, first_name, last_name, email, password, user_active, created_at, updated_at,
+	(select role_name from roles where roles.id = users.role_id) as role, failed_logins, locked_until
+	from users where id = $1`
 
 	var user User
-	row := db.QueryRowContext(ctx, query, id)
+	row := m.DB.QueryRowContext(ctx, query, id)
 
-	err := row.Scan(&user.ID, &user.FirstName, &user.LastName, &user.Email, &user.Password, &user.Active, &user.CreatedAt, &user.UpdatedAt)
+	err := row.Scan(&user.ID, &user.FirstName, &user.LastName, &user.Email, &user.Password, &user.Active, &user.CreatedAt, &user.UpdatedAt, &user.Role,
+		&user.FailedLogins, &user.LockedUntil)
 	if err != nil {
 		return nil, err
 	}
 
+	user.Locked = user.LockedAt(time.Now())
+
 	return &user, nil
 }
 
-func (u *User) Update() error {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+func (m UserModel) Update(ctx context.Context, user User) error {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
 	defer cancel()
 
-	stmt := `update users set first_name = $1, last_name = $2, email = $3, user_active = $4, updated_at = $5 where id = $6`
+	if !ValidRole(user.Role) {
+		return ErrInvalidRole
+	}
+
+	stmt := `update users set first_name = $1, last_name = $2, email = $3, user_active = $4, updated_at = $5,
+	role_id = (select id from roles where role_name = $6)
+	where id = $7`
 
-	_, err := db.ExecContext(ctx, stmt, u.FirstName, u.LastName, u.Email, u.Active, time.Now(), u.ID)
+	_, err := m.DB.ExecContext(ctx, stmt, user.FirstName, user.LastName, user.Email, user.Active, time.Now(), user.Role, user.ID)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
 	return nil
 }
 
-func (u *User) Delete() error {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+func (m UserModel) Delete(ctx context.Context, user User) error {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
 	defer cancel()
 
 	stmt := `delete from users where id = $1`
 
-	_, err := db.ExecContext(ctx, stmt, u.ID)
+	_, err := m.DB.ExecContext(ctx, stmt, user.ID)
 	if err != nil {
 		return err
 	}
@@ -154,13 +276,13 @@ func (u *User) Delete() error {
 	return nil
 }
 
-func (u *User) DeleteByID(id int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+func (m UserModel) DeleteByID(ctx context.Context, id int) error {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
 	defer cancel()
 
 	stmt := `delete from users where id = $1`
 
-	_, err := db.ExecContext(ctx, stmt, id)
+	_, err := m.DB.ExecContext(ctx, stmt, id)
 	if err != nil {
 		return err
 	}
@@ -168,10 +290,18 @@ func (u *User) DeleteByID(id int) error {
 	return nil
 }
 
-func (u *User) Insert(user User) (int, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+func (m UserModel) Insert(ctx context.Context, user User) (int, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
 	defer cancel()
 
+	if user.Role == "" {
+		user.Role = RoleViewer
+	}
+
+	if !ValidRole(user.Role) {
+		return 0, ErrInvalidRole
+	}
+
 	hashedPass, err := bcrypt.GenerateFromPassword([]byte(user.Password), 12)
 	if err != nil {
 		return 0, err
@@ -179,9 +309,10 @@ func (u *User) Insert(user User) (int, error) {
 	var id int
 	user.Password = string(hashedPass)
 
-	stmt := `insert into users (first_name, last_name, email, password, user_active, created_at, updated_at) values ($1, $2, $3, $4, $5, $6, $7) returning id`
+	stmt := `insert into users (first_name, last_name, email, password, user_active, created_at, updated_at, role_id)
+	values ($1, $2, $3, $4, $5, $6, $7, (select id from roles where role_name = $8)) returning id`
 
-	row := db.QueryRowContext(ctx, stmt, user.FirstName, user.LastName, user.Email, user.Password, user.Active, time.Now(), time.Now())
+	row := m.DB.QueryRowContext(ctx, stmt, user.FirstName, user.LastName, user.Email, user.Password, user.Active, time.Now(), time.Now(), user.Role)
 	err = row.Scan(&id)
 	if err != nil {
 		return 0, err
@@ -190,19 +321,18 @@ func (u *User) Insert(user User) (int, error) {
 	return id, nil
 }
 
-func (u *User) ResetPassword(password string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+func (m UserModel) ResetPassword(ctx context.Context, id int, password string) error {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
 	defer cancel()
 
 	hashedPass, err := bcrypt.GenerateFromPassword([]byte(password), 12)
 	if err != nil {
 		return err
 	}
-	u.Password = string(hashedPass)
 
 	stmt := `update users set password = $1, updated_at = $2 where id = $3`
 
-	_, err = db.ExecContext(ctx, stmt, u.Password, time.Now(), u.ID)
+	_, err = m.DB.ExecContext(ctx, stmt, string(hashedPass), time.Now(), id)
 	if err != nil {
 		return err
 	}
@@ -223,171 +353,3 @@ func (u *User) PasswordMatch(password string) (bool, error) {
 
 	return true, nil
 }
-
-func (t *Token) GetByToken(plainText string) (*Token, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
-	defer cancel()
-
-	query := `select id, user_id, email, token, token_hash, created_at, updated_at, expiry
-			from tokens where token = $1`
-
-	var token Token
-
-	row := db.QueryRowContext(ctx, query, plainText)
-	err := row.Scan(
-		&token.ID,
-		&token.UserID,
-		&token.Email,
-		&token.Token,
-		&token.TokenHash,
-		&token.CreatedAt,
-		&token.UpdatedAt,
-		&token.Expiry,
-	)
-	if err != nil {
-		return nil, err
-	}
-
-	return &token, nil
-}
-
-func (t *Token) GetUserForToken(token Token) (*User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
-	defer cancel()
-
-	var user User
-	query := `select id, first_name, last_name, email, password, user_active, created_at, updated_at from users where id = $1`
-
-	row := db.QueryRowContext(ctx, query, token.UserID)
-	err := row.Scan(&user.ID, &user.FirstName, &user.LastName, &user.Email, &user.Password, &user.Active, &user.CreatedAt, &user.UpdatedAt)
-	if err != nil {
-		return nil, err
-	}
-
-	return &user, nil
-}
-
-func (t *Token) GenerateToken(userID int, ttl time.Duration) (*Token, error) {
-	token := &Token{
-		UserID: userID,
-		Expiry: time.Now().Add(ttl),
-	}
-
-	randomBytes := make([]byte, 16)
-	_, err := rand.Read(randomBytes)
-	if err != nil {
-		return nil, err
-	}
-
-	token.Token = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
-
-	hash := sha256.Sum256(([]byte(token.Token)))
-
-	token.TokenHash = hash[:]
-
-	return token, nil
-}
-
-func (t *Token) AuthenticateToken(r *http.Request) (*User, error) {
-	authorizationHeader := r.Header.Get("Authorization")
-
-	if authorizationHeader == "" {
-		return nil, errors.New("authorization header is empty")
-	}
-
-	bearerToken := strings.Split(authorizationHeader, " ")
-	if len(bearerToken) != 2 || bearerToken[0] != "Bearer" {
-		return nil, errors.New("authorization header format is invalid")
-	}
-
-	token := bearerToken[1]
-
-	if len(token) != 26 {
-		return nil, errors.New("token length is invalid")
-	}
-
-	tkn, err := t.GetByToken(token)
-	if err != nil {
-		return nil, errors.New("token match failed")
-	}
-
-	if tkn.Expiry.Before(time.Now()) {
-		return nil, errors.New("token is expired")
-	}
-
-	user, err := t.GetUserForToken(*tkn)
-	if err != nil {
-		return nil, errors.New("no user found for token")
-	}
-
-	if user.Active == 0 {
-		return nil, errors.New("user is not active")
-	}
-
-	return user, nil
-}
-
-func (t *Token) Insert(token Token, u User) error {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
-	defer cancel()
-
-	stmt := `delete from tokens where user_id = $1`
-	_, err := db.ExecContext(ctx, stmt, u.ID)
-	if err != nil {
-		return err
-	}
-
-	token.Email = u.Email
-
-	stmt = `insert into tokens (user_id, email, token, token_hash, created_at, updated_at, expiry) values ($1, $2, $3, $4, $5, $6, $7)`
-	_, err = db.ExecContext(ctx, stmt, token.UserID, token.Email, token.Token, token.TokenHash, time.Now(), time.Now(), token.Expiry)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func (t *Token) DeleteByToken(token string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
-	defer cancel()
-
-	stmt := `delete from tokens where token = $1`
-	_, err := db.ExecContext(ctx, stmt, token)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func (t *Token) ValidToken(plainText string) (bool, error) {
-	token, err := t.GetByToken(plainText)
-	if err != nil {
-		return false, errors.New("no matching token found")
-	}
-
-	_, err = t.GetUserForToken(*token)
-	if err != nil {
-		return false, errors.New("no matching user found")
-	}
-
-	if token.Expiry.Before(time.Now()) {
-		return false, errors.New("expired token")
-	}
-
-	return true, nil
-}
-
-func (t *Token) DeleteTokensForUser(id int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
-	defer cancel()
-
-	stmt := `delete from tokens where user_id = $1`
-	_, err := db.ExecContext(ctx, stmt, id)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
@@ -0,0 +1,82 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrInvalidOneTimeToken = errors.New("link is invalid or has expired")
+
+// Scopes keep a token issued for one purpose from being accepted for another.
+const (
+	ScopePasswordReset = "password-reset"
+	ScopeVerifyEmail   = "verify-email"
+)
+
+// OneTimeTokenModel manages the single-use tokens sent out in emails, such as
+// password reset and email verification links.
+type OneTimeTokenModel struct {
+	DB      *sql.DB
+	Timeout time.Duration
+}
+
+// Create issues a token for the user, replacing any earlier one in the same
+// scope that has not been used yet, and returns the plaintext to put in the
+// email.
+func (m OneTimeTokenModel) Create(ctx context.Context, userID int, scope string, ttl time.Duration) (string, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	plainText, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `delete from one_time_tokens where user_id = $1 and scope = $2 and used_at is null`, userID, scope)
+	if err != nil {
+		return "", err
+	}
+
+	stmt := `insert into one_time_tokens (user_id, scope, token_hash, expiry, created_at) values ($1, $2, $3, $4, $5)`
+	_, err = tx.ExecContext(ctx, stmt, userID, scope, hashToken(plainText), time.Now().Add(ttl), time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return "", err
+	}
+
+	return plainText, nil
+}
+
+// Consume marks a token as used and returns the user it was issued to. A
+// token only works once, only in its own scope, and never after it expires.
+func (m OneTimeTokenModel) Consume(ctx context.Context, scope, plainText string) (int, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	stmt := `update one_time_tokens set used_at = $1
+		where token_hash = $2 and scope = $3 and used_at is null and expiry > $1
+		returning user_id`
+
+	var userID int
+	err := m.DB.QueryRowContext(ctx, stmt, time.Now(), hashToken(plainText), scope).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrInvalidOneTimeToken
+		}
+		return 0, err
+	}
+
+	return userID, nil
+}
@@ -0,0 +1,117 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+func insertRefreshToken(ctx context.Context, tx *sql.Tx, sessionID int, refresh Token) error {
+	stmt := `insert into refresh_tokens (session_id, user_id, token_hash, expiry, created_at) values ($1, $2, $3, $4, $5)`
+	_, err := tx.ExecContext(ctx, stmt, sessionID, refresh.UserID, refresh.TokenHash, refresh.Expiry, time.Now())
+
+	return err
+}
+
+// Refresh exchanges a refresh token for a new access token and a new refresh
+// token on the same session. Each refresh token works once: presenting one
+// that was already exchanged means it leaked, so the whole session (every
+// access and refresh token descended from the same login) is revoked and
+// ErrRefreshTokenReused is returned. A user who was deactivated loses the
+// session, and gets ErrInvalidRefreshToken.
+func (m TokenModel) Refresh(ctx context.Context, plainText string, accessTTL, refreshTTL time.Duration) (*Token, *Token, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	var id, sessionID, userID int
+	var expiry time.Time
+	var usedAt sql.NullTime
+	var active int
+
+	query := `select rt.id, rt.session_id, rt.user_id, rt.expiry, rt.used_at, u.user_active
+			from refresh_tokens rt
+			join users u on (u.id = rt.user_id)
+			where rt.token_hash = $1 for update of rt`
+	err = tx.QueryRowContext(ctx, query, hashToken(plainText)).Scan(&id, &sessionID, &userID, &expiry, &usedAt, &active)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil, ErrInvalidRefreshToken
+		}
+		return nil, nil, err
+	}
+
+	if usedAt.Valid {
+		// refresh_tokens cascade from the session
+		_, err = tx.ExecContext(ctx, `delete from tokens where id = $1`, sessionID)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return nil, nil, ErrRefreshTokenReused
+	}
+
+	if active == 0 {
+		_, err = tx.ExecContext(ctx, `delete from tokens where id = $1`, sessionID)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	if expiry.Before(time.Now()) {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	_, err = tx.ExecContext(ctx, `update refresh_tokens set used_at = $1 where id = $2`, time.Now(), id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	access, err := m.GenerateToken(userID, accessTTL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	refresh, err := m.GenerateToken(userID, refreshTTL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stmt := `update tokens set token_hash = $1, expiry = $2, last_used_at = $3, updated_at = $4 where id = $5`
+	_, err = tx.ExecContext(ctx, stmt, access.TokenHash, access.Expiry, time.Now(), time.Now(), sessionID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = insertRefreshToken(ctx, tx, sessionID, *refresh)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	access.ID = sessionID
+
+	return access, refresh, nil
+}
@@ -0,0 +1,58 @@
+package data
+
+import "errors"
+
+var ErrInvalidRole = errors.New("role must be admin, editor or viewer")
+
+const (
+	RoleAdmin  = "admin"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+)
+
+// Permission names an action on the admin API. Routes declare the permission
+// they need, and roles grant a fixed set of them.
+type Permission string
+
+const (
+	PermUsersRead    Permission = "users:read"
+	PermUsersWrite   Permission = "users:write"
+	PermBooksRead    Permission = "books:read"
+	PermBooksWrite   Permission = "books:write"
+	PermAuthorsWrite Permission = "authors:write"
+	PermGenresWrite  Permission = "genres:write"
+	PermAuditRead    Permission = "audit:read"
+)
+
+var rolePermissions = map[string][]Permission{
+	RoleAdmin: {
+		PermUsersRead, PermUsersWrite,
+		PermBooksRead, PermBooksWrite,
+		PermAuthorsWrite, PermGenresWrite,
+		PermAuditRead,
+	},
+	RoleEditor: {
+		PermBooksRead, PermBooksWrite,
+		PermAuthorsWrite, PermGenresWrite,
+	},
+	RoleViewer: {
+		PermBooksRead,
+	},
+}
+
+// ValidRole reports whether role is one of the roles seeded by the migrations.
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// Can reports whether the user's role grants p.
+func (u *User) Can(p Permission) bool {
+	for _, granted := range rolePermissions[u.Role] {
+		if granted == p {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,42 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+)
+
+// SettingsModel stores site-wide switches that admins can change at runtime.
+type SettingsModel struct {
+	DB      *sql.DB
+	Timeout time.Duration
+}
+
+const settingRegistrationOpen = "registration_open"
+
+// RegistrationOpen reports whether anyone may sign up through /users/register.
+func (m SettingsModel) RegistrationOpen(ctx context.Context) (bool, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	var value string
+	err := m.DB.QueryRowContext(ctx, `select value from settings where name = $1`, settingRegistrationOpen).Scan(&value)
+	if err != nil {
+		return false, err
+	}
+
+	return strconv.ParseBool(value)
+}
+
+func (m SettingsModel) SetRegistrationOpen(ctx context.Context, open bool) error {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	stmt := `insert into settings (name, value, updated_at) values ($1, $2, $3)
+		on conflict (name) do update set value = excluded.value, updated_at = excluded.updated_at`
+
+	_, err := m.DB.ExecContext(ctx, stmt, settingRegistrationOpen, strconv.FormatBool(open), time.Now())
+
+	return err
+}
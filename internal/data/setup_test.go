@@ -1,3 +1,9 @@
+//go:build !nodocker
+
+// The tests of this package that need a database run against Postgres in a
+// Docker container started here. Build with -tags nodocker to run the rest,
+// such as the sqlmock benchmarks, without Docker.
+
 package data
 
 import (
@@ -8,6 +14,7 @@ import (
 	_ "github.com/jackc/pgx/v4/stdlib"
 	"github.com/ory/dockertest/v3"
 	"github.com/ory/dockertest/v3/docker"
+	"literal/internal/migrations"
 	"log"
 	"os"
 	"testing"
@@ -75,9 +82,9 @@ func TestMain(m *testing.M) {
 	// get our models
 	models = New(testDB)
 
-	err = createTables(testDB)
+	err = migrations.Up(testDB)
 	if err != nil {
-		log.Fatalf("could not create tables: %v", err)
+		log.Fatalf("could not run migrations: %v", err)
 	}
 
 	err = insertData(testDB)
@@ -94,186 +101,6 @@ func TestMain(m *testing.M) {
 	os.Exit(code)
 }
 
-// createTables will create all the tables in our test database, duplicating the structure
-// of the production environment
-func createTables(db *sql.DB) error {
-	stmt := `
-	--
--- Name: authors; Type: TABLE; Schema: public; Owner: -
---
-
-CREATE TABLE public.authors (
-    id integer NOT NULL,
-    author_name character varying(512),
-    created_at timestamp without time zone,
-    updated_at timestamp without time zone
-);
-
-
---
--- Name: authors_id_seq; Type: SEQUENCE; Schema: public; Owner: -
---
-
-ALTER TABLE public.authors ALTER COLUMN id ADD GENERATED ALWAYS AS IDENTITY (
-    SEQUENCE NAME public.authors_id_seq
-    START WITH 1
-    INCREMENT BY 1
-    NO MINVALUE
-    NO MAXVALUE
-    CACHE 1
-);
-
-
---
--- Name: books; Type: TABLE; Schema: public; Owner: -
---
-
-CREATE TABLE public.books (
-    id integer NOT NULL,
-    title character varying(512),
-    author_id integer,
-    publication_year integer,
-    created_at timestamp without time zone,
-    updated_at timestamp without time zone,
-    slug character varying(512),
-    description text
-);
-
-
---
--- Name: books_genres; Type: TABLE; Schema: public; Owner: -
---
-
-CREATE TABLE public.books_genres (
-    id integer NOT NULL,
-    book_id integer,
-    genre_id integer,
-    created_at timestamp without time zone,
-    updated_at timestamp without time zone
-);
-
-
---
--- Name: books_genres_id_seq; Type: SEQUENCE; Schema: public; Owner: -
---
-
-ALTER TABLE public.books_genres ALTER COLUMN id ADD GENERATED ALWAYS AS IDENTITY (
-    SEQUENCE NAME public.books_genres_id_seq
-    START WITH 1
-    INCREMENT BY 1
-    NO MINVALUE
-    NO MAXVALUE
-    CACHE 1
-);
-
-
---
--- Name: books_id_seq; Type: SEQUENCE; Schema: public; Owner: -
---
-
-ALTER TABLE public.books ALTER COLUMN id ADD GENERATED ALWAYS AS IDENTITY (
-    SEQUENCE NAME public.books_id_seq
-    START WITH 1
-    INCREMENT BY 1
-    NO MINVALUE
-    NO MAXVALUE
-    CACHE 1
-);
-
-
---
--- Name: genres; Type: TABLE; Schema: public; Owner: -
---
-
-CREATE TABLE public.genres (
-    id integer NOT NULL,
-    genre_name character varying(255),
-    created_at timestamp without time zone,
-    updated_at timestamp without time zone
-);
-
-
---
--- Name: genres_id_seq; Type: SEQUENCE; Schema: public; Owner: -
---
-
-ALTER TABLE public.genres ALTER COLUMN id ADD GENERATED ALWAYS AS IDENTITY (
-    SEQUENCE NAME public.genres_id_seq
-    START WITH 1
-    INCREMENT BY 1
-    NO MINVALUE
-    NO MAXVALUE
-    CACHE 1
-);
-
-
---
--- Name: tokens; Type: TABLE; Schema: public; Owner: -
---
-
-CREATE TABLE public.tokens (
-    id integer NOT NULL,
-    user_id integer,
-    email character varying(255) NOT NULL,
-    token character varying(255) NOT NULL,
-    token_hash bytea NOT NULL,
-    expiry timestamp with time zone NOT NULL,
-    created_at timestamp without time zone NOT NULL,
-    updated_at timestamp without time zone NOT NULL
-);
-
-
---
--- Name: tokens_id_seq; Type: SEQUENCE; Schema: public; Owner: -
---
-
-ALTER TABLE public.tokens ALTER COLUMN id ADD GENERATED ALWAYS AS IDENTITY (
-    SEQUENCE NAME public.tokens_id_seq
-    START WITH 1
-    INCREMENT BY 1
-    NO MINVALUE
-    NO MAXVALUE
-    CACHE 1
-);
-
-
---
--- Name: users; Type: TABLE; Schema: public; Owner: -
---
-
-CREATE TABLE public.users (
-    id integer NOT NULL,
-    email character varying(255),
-    first_name character varying(255) NOT NULL,
-    last_name character varying(255) NOT NULL,
-    password character varying(60) NOT NULL,
-    created_at timestamp without time zone NOT NULL,
-    updated_at timestamp without time zone NOT NULL,
-    user_active integer DEFAULT 0
-);
-
-
---
--- Name: users_id_seq; Type: SEQUENCE; Schema: public; Owner: -
---
-
-ALTER TABLE public.users ALTER COLUMN id ADD GENERATED ALWAYS AS IDENTITY (
-    SEQUENCE NAME public.users_id_seq
-    START WITH 1
-    INCREMENT BY 1
-    NO MINVALUE
-    NO MAXVALUE
-    CACHE 1
-);
-`
-
-	_, err := db.Exec(stmt)
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
 // insertData inserts a minimal amout of test data into the test database
 func insertData(db *sql.DB) error {
 
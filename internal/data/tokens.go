@@ -0,0 +1,365 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("refresh token is invalid or expired")
+	ErrRefreshTokenReused  = errors.New("refresh token has already been used")
+)
+
+type TokenModel struct {
+	DB      *sql.DB
+	Timeout time.Duration
+
+	// SlidingExpiry, when set, makes AuthenticateToken push an access token's
+	// expiry out to this long from now once less than half of it remains.
+	SlidingExpiry time.Duration
+}
+
+// Token is a bearer token, and each one is a separate login session: a user
+// can hold several at once, one per device.
+type Token struct {
+	ID         int       `json:"id"`
+	UserID     int       `json:"user_id"`
+	Email      string    `json:"email"`
+	Token      string    `json:"token,omitempty"`
+	TokenHash  []byte    `json:"-"`
+	Name       string    `json:"name"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	Expiry     time.Time `json:"expiry"`
+}
+
+// sessionAlive matches tokens rows whose access token or an unused refresh
+// token is still valid at $2.
+const sessionAlive = `(expiry > $2 or exists (select 1 from refresh_tokens rt
+	where rt.session_id = tokens.id and rt.used_at is null and rt.expiry > $2))`
+
+// lastUsedResolution limits how often AuthenticateToken writes last_used_at,
+// so a busy client does not turn every request into an update.
+const lastUsedResolution = time.Minute
+
+func (m TokenModel) GetByToken(ctx context.Context, plainText string) (*Token, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	query := `select id, user_id, email, token_hash, name, user_agent, ip_address, last_used_at, created_at, updated_at, expiry
+			from tokens where token_hash = $1`
+
+	var token Token
+
+	row := m.DB.QueryRowContext(ctx, query, hashToken(plainText))
+	err := row.Scan(
+		&token.ID,
+		&token.UserID,
+		&token.Email,
+		&token.TokenHash,
+		&token.Name,
+		&token.UserAgent,
+		&token.IPAddress,
+		&token.LastUsedAt,
+		&token.CreatedAt,
+		&token.UpdatedAt,
+		&token.Expiry,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+func (m TokenModel) GetUserForToken(ctx context.Context, token Token) (*User, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	var user User
+	query := `select id, first_name, last_name, email, password, user_active, created_at, updated_at,
+	(select role_name from roles where roles.id = users.role_id) as role
+	from users where id = $1`
+
+	row := m.DB.QueryRowContext(ctx, query, token.UserID)
+	err := row.Scan(&user.ID, &user.FirstName, &user.LastName, &user.Email, &user.Password, &user.Active, &user.CreatedAt, &user.UpdatedAt, &user.Role)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (m TokenModel) GenerateToken(userID int, ttl time.Duration) (*Token, error) {
+	token := &Token{
+		UserID: userID,
+		Expiry: time.Now().Add(ttl),
+	}
+
+	plainText, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	token.Token = plainText
+	token.TokenHash = hashToken(token.Token)
+
+	return token, nil
+}
+
+// randomToken returns 128 random bits as a 26 character base32 string.
+func randomToken() (string, error) {
+	randomBytes := make([]byte, 16)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes), nil
+}
+
+// hashToken is the only form of a token that is stored or queried; the
+// plaintext exists just long enough to hand it to the client.
+func hashToken(plainText string) []byte {
+	hash := sha256.Sum256([]byte(plainText))
+	return hash[:]
+}
+
+func (m TokenModel) AuthenticateToken(r *http.Request) (*User, error) {
+	authorizationHeader := r.Header.Get("Authorization")
+
+	if authorizationHeader == "" {
+		return nil, errors.New("authorization header is empty")
+	}
+
+	bearerToken := strings.Split(authorizationHeader, " ")
+	if len(bearerToken) != 2 || bearerToken[0] != "Bearer" {
+		return nil, errors.New("authorization header format is invalid")
+	}
+
+	token := bearerToken[1]
+
+	if len(token) != 26 {
+		return nil, errors.New("token length is invalid")
+	}
+
+	tkn, err := m.GetByToken(r.Context(), token)
+	if err != nil {
+		return nil, errors.New("token match failed")
+	}
+
+	if tkn.Expiry.Before(time.Now()) {
+		return nil, errors.New("token is expired")
+	}
+
+	user, err := m.GetUserForToken(r.Context(), *tkn)
+	if err != nil {
+		return nil, errors.New("no user found for token")
+	}
+
+	if user.Active == 0 {
+		return nil, errors.New("user is not active")
+	}
+
+	extend := m.SlidingExpiry > 0 && time.Until(tkn.Expiry) < m.SlidingExpiry/2
+	if extend {
+		tkn.Expiry = time.Now().Add(m.SlidingExpiry)
+	}
+
+	// last_used_at is informational, so a failed write shouldn't fail the request
+	if extend || time.Since(tkn.LastUsedAt) > lastUsedResolution {
+		_ = m.touch(r.Context(), tkn.ID, tkn.Expiry)
+	}
+
+	user.Token = *tkn
+
+	return user, nil
+}
+
+func (m TokenModel) touch(ctx context.Context, id int, expiry time.Time) error {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	stmt := `update tokens set last_used_at = $1, expiry = $2 where id = $3`
+	_, err := m.DB.ExecContext(ctx, stmt, time.Now(), expiry, id)
+
+	return err
+}
+
+func (m TokenModel) Insert(ctx context.Context, token Token, u User) error {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = insertSession(ctx, tx, token, u)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// InsertWithRefresh starts a session for u with an access token and the
+// refresh token that can later be exchanged for a new pair.
+func (m TokenModel) InsertWithRefresh(ctx context.Context, access, refresh Token, u User) error {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	sessionID, err := insertSession(ctx, tx, access, u)
+	if err != nil {
+		return err
+	}
+
+	err = insertRefreshToken(ctx, tx, sessionID, refresh)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func insertSession(ctx context.Context, tx *sql.Tx, token Token, u User) (int, error) {
+	// other sessions stay signed in; only clear out the ones that have lapsed
+	stmt := `delete from tokens where user_id = $1 and not ` + sessionAlive
+	_, err := tx.ExecContext(ctx, stmt, u.ID, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	token.Email = u.Email
+
+	stmt = `insert into tokens (user_id, email, token_hash, name, user_agent, ip_address, last_used_at, created_at, updated_at, expiry)
+	values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) returning id`
+
+	var id int
+	err = tx.QueryRowContext(ctx, stmt, token.UserID, token.Email, token.TokenHash, token.Name, token.UserAgent, token.IPAddress,
+		time.Now(), time.Now(), time.Now(), token.Expiry).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (m TokenModel) DeleteByToken(ctx context.Context, token string) error {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	stmt := `delete from tokens where token_hash = $1`
+	_, err := m.DB.ExecContext(ctx, stmt, hashToken(token))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m TokenModel) ValidToken(ctx context.Context, plainText string) (bool, error) {
+	token, err := m.GetByToken(ctx, plainText)
+	if err != nil {
+		return false, errors.New("no matching token found")
+	}
+
+	_, err = m.GetUserForToken(ctx, *token)
+	if err != nil {
+		return false, errors.New("no matching user found")
+	}
+
+	if token.Expiry.Before(time.Now()) {
+		return false, errors.New("expired token")
+	}
+
+	return true, nil
+}
+
+func (m TokenModel) DeleteTokensForUser(ctx context.Context, id int) error {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	stmt := `delete from tokens where user_id = $1`
+	_, err := m.DB.ExecContext(ctx, stmt, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SessionsForUser returns the user's unexpired sessions, most recently used
+// first.
+func (m TokenModel) SessionsForUser(ctx context.Context, userID int) ([]*Token, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	query := `select id, user_id, email, name, user_agent, ip_address, last_used_at, created_at, updated_at, expiry
+			from tokens where user_id = $1 and ` + sessionAlive + `
+			order by last_used_at desc`
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []*Token
+
+	for rows.Next() {
+		var token Token
+		err := rows.Scan(
+			&token.ID,
+			&token.UserID,
+			&token.Email,
+			&token.Name,
+			&token.UserAgent,
+			&token.IPAddress,
+			&token.LastUsedAt,
+			&token.CreatedAt,
+			&token.UpdatedAt,
+			&token.Expiry,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, &token)
+	}
+
+	return sessions, rows.Err()
+}
+
+// DeleteSession revokes one session. The user id is part of the match so a
+// user can only ever revoke their own sessions; sql.ErrNoRows means there was
+// no such session for that user.
+func (m TokenModel) DeleteSession(ctx context.Context, userID, id int) error {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	stmt := `delete from tokens where id = $1 and user_id = $2`
+	res, err := m.DB.ExecContext(ctx, stmt, id, userID)
+	if err != nil {
+		return err
+	}
+
+	return expectRows(res)
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"time"
 
+	"literal/internal/migrations"
+
 	_ "github.com/jackc/pgconn"
 	_ "github.com/jackc/pgx/v4"
 	_ "github.com/jackc/pgx/v4/stdlib"
@@ -14,15 +16,32 @@ type DB struct {
 	SQL *sql.DB
 }
 
-var dbConn = &DB{}
-
 const (
 	maxOpenDbConn = 10
 	maxIdleDbConn = 5
 	maxDbLifetime = 5 * time.Minute
 )
 
+// ConnectPostgres opens the pool and refuses to hand it out unless every
+// embedded migration has been applied.
 func ConnectPostgres(dsn string) (*DB, error) {
+	conn, err := OpenPostgres(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	err = migrations.Check(conn.SQL)
+	if err != nil {
+		conn.SQL.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// OpenPostgres opens and pings the pool without looking at the schema, for
+// tools such as the migrate command that need to run against an old database.
+func OpenPostgres(dsn string) (*DB, error) {
 	d, err := sql.Open("pgx", dsn)
 	if err != nil {
 		return nil, err
@@ -37,9 +56,7 @@ func ConnectPostgres(dsn string) (*DB, error) {
 		return nil, err
 	}
 
-	dbConn.SQL = d
-
-	return dbConn, nil
+	return &DB{SQL: d}, nil
 }
 
 func testDB(d *sql.DB) error {
@@ -0,0 +1,152 @@
+// Package enrich looks books up in outside bibliographic catalogs, so a
+// librarian can start from what a service such as Open Library already knows
+// about a book instead of typing in every field.
+package enrich
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNotFound     = errors.New("no matching book found")
+	ErrEmptyQuery   = errors.New("a lookup needs an ISBN or a title")
+	ErrForeignCover = errors.New("cover is not one the provider returned")
+)
+
+// Query asks for a book by ISBN, or failing that by title and author. An ISBN
+// is expected in ISBN-13 form, as the isbn package returns it.
+type Query struct {
+	ISBN   string
+	Title  string
+	Author string
+}
+
+// key identifies the query for caching, ignoring case and surrounding space.
+func (q Query) key() string {
+	if q.ISBN != "" {
+		return "isbn:" + q.ISBN
+	}
+	return "title:" + strings.ToLower(strings.TrimSpace(q.Title)) + "\x00" + strings.ToLower(strings.TrimSpace(q.Author))
+}
+
+// Record is what a provider knows about a book. Fields it doesn't know are
+// left empty.
+type Record struct {
+	Source          string   `json:"source"`
+	SourceURL       string   `json:"source_url,omitempty"`
+	Title           string   `json:"title"`
+	Authors         []string `json:"authors"`
+	Description     string   `json:"description"`
+	PublicationYear int      `json:"publication_year"`
+	ISBN10          string   `json:"isbn_10"`
+	ISBN13          string   `json:"isbn_13"`
+	Subjects        []string `json:"subjects"`
+	CoverURL        string   `json:"cover_url,omitempty"`
+}
+
+// MetadataProvider is a bibliographic catalog books can be looked up in.
+type MetadataProvider interface {
+	// Lookup returns the best match for q, or ErrNotFound.
+	Lookup(ctx context.Context, q Query) (*Record, error)
+
+	// FetchCover downloads a cover from a Record's CoverURL. It refuses, with
+	// ErrForeignCover, URLs that don't point at the provider, so a client
+	// can't use it to make the server fetch whatever it likes. The caller
+	// must close the cover.
+	FetchCover(ctx context.Context, url string) (io.ReadCloser, error)
+}
+
+// Cache remembers a MetadataProvider's answers, including ErrNotFound, for a
+// while. Other errors aren't kept, so a provider that was briefly down is
+// asked again next time.
+type Cache struct {
+	MetadataProvider
+
+	ttl     time.Duration
+	size    int
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	now     func() time.Time
+}
+
+type cacheEntry struct {
+	record  *Record
+	err     error
+	expires time.Time
+}
+
+// NewCache keeps up to size answers from p, each for ttl.
+func NewCache(p MetadataProvider, ttl time.Duration, size int) *Cache {
+	return &Cache{
+		MetadataProvider: p,
+		ttl:              ttl,
+		size:             size,
+		entries:          make(map[string]cacheEntry),
+		now:              time.Now,
+	}
+}
+
+func (c *Cache) Lookup(ctx context.Context, q Query) (*Record, error) {
+	key := q.key()
+
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	c.mu.Unlock()
+
+	if ok && c.now().Before(e.expires) {
+		return e.record.clone(), e.err
+	}
+
+	record, err := c.MetadataProvider.Lookup(ctx, q)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.makeRoom()
+	c.entries[key] = cacheEntry{record: record.clone(), err: err, expires: c.now().Add(c.ttl)}
+	c.mu.Unlock()
+
+	return record, err
+}
+
+// makeRoom drops expired answers once the cache is full, and if that isn't
+// enough, the one closest to expiring. c.mu must be held.
+func (c *Cache) makeRoom() {
+	if len(c.entries) < c.size {
+		return
+	}
+
+	now := c.now()
+	oldest := ""
+	for key, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, key)
+			continue
+		}
+		if oldest == "" || e.expires.Before(c.entries[oldest].expires) {
+			oldest = key
+		}
+	}
+
+	if len(c.entries) >= c.size && oldest != "" {
+		delete(c.entries, oldest)
+	}
+}
+
+// clone copies r so a caller editing its Record can't change the cached one.
+func (r *Record) clone() *Record {
+	if r == nil {
+		return nil
+	}
+
+	c := *r
+	c.Authors = append([]string(nil), r.Authors...)
+	c.Subjects = append([]string(nil), r.Subjects...)
+	return &c
+}
@@ -0,0 +1,96 @@
+package enrich
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+type countingProvider struct {
+	calls *int
+	err   error
+}
+
+func (p countingProvider) Lookup(ctx context.Context, q Query) (*Record, error) {
+	*p.calls++
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &Record{Title: q.Title, Authors: []string{"Frank Herbert"}}, nil
+}
+
+func (p countingProvider) FetchCover(ctx context.Context, url string) (io.ReadCloser, error) {
+	return nil, ErrForeignCover
+}
+
+func TestCache(t *testing.T) {
+	var tests = []struct {
+		name          string
+		err           error
+		expectedCalls int
+	}{
+		{"found", nil, 1},
+		{"not found", ErrNotFound, 1},
+		{"provider down", errors.New("connection refused"), 2},
+	}
+
+	for _, e := range tests {
+		calls := 0
+		c := NewCache(countingProvider{calls: &calls, err: e.err}, time.Hour, 10)
+
+		first, err1 := c.Lookup(context.Background(), Query{Title: "Dune"})
+		second, err2 := c.Lookup(context.Background(), Query{Title: " dune "})
+
+		if calls != e.expectedCalls {
+			t.Errorf("%s: expected %d calls to the provider, got %d", e.name, e.expectedCalls, calls)
+		}
+		if !errors.Is(err1, e.err) || !errors.Is(err2, e.err) {
+			t.Errorf("%s: expected error %v both times, got %v and %v", e.name, e.err, err1, err2)
+		}
+
+		if e.err == nil {
+			first.Authors[0] = "Somebody Else"
+			if second.Authors[0] != "Frank Herbert" {
+				t.Errorf("%s: editing one answer changed the cached one", e.name)
+			}
+		}
+	}
+}
+
+func TestCache_expiry(t *testing.T) {
+	calls := 0
+	now := time.Now()
+
+	c := NewCache(countingProvider{calls: &calls}, time.Hour, 2)
+	c.now = func() time.Time { return now }
+
+	lookup := func(title string) {
+		_, err := c.Lookup(context.Background(), Query{Title: title})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lookup("Dune")
+	now = now.Add(time.Minute)
+	lookup("Emma")
+	lookup("Dune")
+	if calls != 2 {
+		t.Errorf("expected Dune to be cached, got %d calls", calls)
+	}
+
+	// a third title pushes out the answer closest to expiring, Dune's
+	lookup("Persuasion")
+	lookup("Emma")
+	if calls != 3 || len(c.entries) != 2 {
+		t.Errorf("expected Emma to stay cached, got %d calls and %d entries", calls, len(c.entries))
+	}
+
+	now = now.Add(2 * time.Hour)
+	lookup("Emma")
+	if calls != 4 {
+		t.Errorf("expected an expired answer to be looked up again, got %d calls", calls)
+	}
+}
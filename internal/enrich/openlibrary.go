@@ -0,0 +1,199 @@
+package enrich
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"literal/internal/isbn"
+)
+
+// maxSubjects caps the subjects taken from Open Library, whose works often
+// carry dozens of them, most too specific to be useful as genres.
+const maxSubjects = 10
+
+// OpenLibrary looks books up with the Open Library search API, and fetches a
+// match's description from its work record.
+type OpenLibrary struct {
+	// BaseURL defaults to "https://openlibrary.org".
+	BaseURL string
+
+	// CoversURL defaults to "https://covers.openlibrary.org".
+	CoversURL string
+
+	// UserAgent identifies the site to Open Library, which asks heavy users
+	// to say who they are.
+	UserAgent string
+
+	// Client defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+type openLibrarySearch struct {
+	Docs []struct {
+		Key              string   `json:"key"`
+		Title            string   `json:"title"`
+		AuthorName       []string `json:"author_name"`
+		FirstPublishYear int      `json:"first_publish_year"`
+		Subject          []string `json:"subject"`
+		CoverID          int      `json:"cover_i"`
+	} `json:"docs"`
+}
+
+type openLibraryWork struct {
+	// Description is either a plain string or {"type": ..., "value": ...}.
+	Description json.RawMessage `json:"description"`
+}
+
+func (o OpenLibrary) Lookup(ctx context.Context, q Query) (*Record, error) {
+	qs := url.Values{}
+	qs.Set("fields", "key,title,author_name,first_publish_year,subject,cover_i")
+	qs.Set("limit", "1")
+
+	switch {
+	case q.ISBN != "":
+		qs.Set("isbn", q.ISBN)
+	case q.Title != "":
+		qs.Set("title", q.Title)
+		if q.Author != "" {
+			qs.Set("author", q.Author)
+		}
+	default:
+		return nil, ErrEmptyQuery
+	}
+
+	var search openLibrarySearch
+	err := o.getJSON(ctx, o.baseURL()+"/search.json?"+qs.Encode(), &search)
+	if err != nil {
+		return nil, err
+	}
+	if len(search.Docs) == 0 {
+		return nil, ErrNotFound
+	}
+
+	doc := search.Docs[0]
+	record := &Record{
+		Source:          "Open Library",
+		Title:           doc.Title,
+		Authors:         doc.AuthorName,
+		PublicationYear: doc.FirstPublishYear,
+		Subjects:        doc.Subject,
+	}
+	if len(record.Subjects) > maxSubjects {
+		record.Subjects = record.Subjects[:maxSubjects]
+	}
+	if doc.CoverID > 0 {
+		record.CoverURL = fmt.Sprintf("%s/b/id/%d-L.jpg", o.coversURL(), doc.CoverID)
+	}
+
+	// a work spans every edition, so only an ISBN that was asked for is
+	// known to be the right one
+	if q.ISBN != "" {
+		record.ISBN13, record.ISBN10, _ = isbn.Parse(q.ISBN)
+	}
+
+	if strings.HasPrefix(doc.Key, "/works/") {
+		record.SourceURL = o.baseURL() + doc.Key
+
+		var work openLibraryWork
+		err := o.getJSON(ctx, record.SourceURL+".json", &work)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return nil, err
+		}
+		record.Description = description(work.Description)
+	}
+
+	return record, nil
+}
+
+func (o OpenLibrary) FetchCover(ctx context.Context, coverURL string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(coverURL, o.coversURL()+"/") {
+		return nil, ErrForeignCover
+	}
+
+	resp, err := o.get(ctx, coverURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+func description(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return strings.TrimSpace(s)
+	}
+
+	var text struct {
+		Value string `json:"value"`
+	}
+	if json.Unmarshal(raw, &text) == nil {
+		return strings.TrimSpace(text.Value)
+	}
+
+	return ""
+}
+
+func (o OpenLibrary) getJSON(ctx context.Context, u string, dst interface{}) error {
+	resp, err := o.get(ctx, u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return json.NewDecoder(io.LimitReader(resp.Body, 4<<20)).Decode(dst)
+}
+
+func (o OpenLibrary) get(ctx context.Context, u string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if o.UserAgent != "" {
+		req.Header.Set("User-Agent", o.UserAgent)
+	}
+
+	client := o.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, ErrNotFound
+		}
+
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("open library %s %s: %s: %s", req.Method, req.URL.Path, resp.Status, bytes.TrimSpace(msg))
+	}
+
+	return resp, nil
+}
+
+func (o OpenLibrary) baseURL() string {
+	if o.BaseURL == "" {
+		return "https://openlibrary.org"
+	}
+	return strings.TrimSuffix(o.BaseURL, "/")
+}
+
+func (o OpenLibrary) coversURL() string {
+	if o.CoversURL == "" {
+		return "https://covers.openlibrary.org"
+	}
+	return strings.TrimSuffix(o.CoversURL, "/")
+}
@@ -0,0 +1,146 @@
+package enrich
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// openLibraryStandIn answers the requests OpenLibrary makes with canned
+// responses, and records the search queries it was sent.
+func openLibraryStandIn(t *testing.T, searches *[]string) *httptest.Server {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/search.json", func(w http.ResponseWriter, r *http.Request) {
+		*searches = append(*searches, r.URL.RawQuery)
+
+		if r.Header.Get("User-Agent") != "Literal test" {
+			t.Errorf("expected the configured user agent, got %q", r.Header.Get("User-Agent"))
+		}
+
+		qs := r.URL.Query()
+		if qs.Get("isbn") == "9780441172719" || strings.EqualFold(qs.Get("title"), "dune") {
+			_, _ = io.WriteString(w, `{"numFound": 1, "docs": [{
+				"key": "/works/OL893415W",
+				"title": "Dune",
+				"author_name": ["Frank Herbert"],
+				"first_publish_year": 1965,
+				"subject": ["Science Fiction", "Fiction", "Desert", "Ecology", "Politics", "Religion", "Spice", "Sand", "Worms", "Prophecy", "Empire", "Arrakis"],
+				"cover_i": 11481354
+			}]}`)
+			return
+		}
+
+		_, _ = io.WriteString(w, `{"numFound": 0, "docs": []}`)
+	})
+
+	mux.HandleFunc("/works/OL893415W.json", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `{"description": {"type": "/type/text", "value": " Set on the desert planet Arrakis. "}}`)
+	})
+
+	mux.HandleFunc("/b/id/11481354-L.jpg", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "jpeg bytes")
+	})
+
+	return httptest.NewServer(mux)
+}
+
+func TestOpenLibrary_Lookup(t *testing.T) {
+	var searches []string
+	srv := openLibraryStandIn(t, &searches)
+	defer srv.Close()
+
+	ol := OpenLibrary{BaseURL: srv.URL, CoversURL: srv.URL, UserAgent: "Literal test"}
+
+	var tests = []struct {
+		name           string
+		query          Query
+		expectedSearch string
+		expectedISBN10 string
+		expectedErr    error
+	}{
+		{"by isbn", Query{ISBN: "9780441172719"}, "isbn=9780441172719", "0441172717", nil},
+		{"by title and author", Query{Title: "Dune", Author: "Herbert"}, "author=Herbert", "", nil},
+		{"no match", Query{Title: "Nothing Like It"}, "title=Nothing+Like+It", "", ErrNotFound},
+		{"empty query", Query{}, "", "", ErrEmptyQuery},
+	}
+
+	for _, e := range tests {
+		searches = nil
+
+		record, err := ol.Lookup(context.Background(), e.query)
+		if !errors.Is(err, e.expectedErr) {
+			t.Errorf("%s: expected error %v, got %v", e.name, e.expectedErr, err)
+			continue
+		}
+
+		if e.expectedSearch != "" && (len(searches) != 1 || !strings.Contains(searches[0], e.expectedSearch)) {
+			t.Errorf("%s: expected a search with %s, got %v", e.name, e.expectedSearch, searches)
+		}
+
+		if err != nil {
+			continue
+		}
+
+		if record.Title != "Dune" || record.PublicationYear != 1965 || len(record.Authors) != 1 || record.Authors[0] != "Frank Herbert" {
+			t.Errorf("%s: unexpected record %+v", e.name, record)
+		}
+		if record.Description != "Set on the desert planet Arrakis." {
+			t.Errorf("%s: expected the work's description, got %q", e.name, record.Description)
+		}
+		if len(record.Subjects) != maxSubjects || record.Subjects[0] != "Science Fiction" {
+			t.Errorf("%s: expected the first %d subjects, got %v", e.name, maxSubjects, record.Subjects)
+		}
+		if record.CoverURL != srv.URL+"/b/id/11481354-L.jpg" {
+			t.Errorf("%s: unexpected cover %s", e.name, record.CoverURL)
+		}
+		if record.SourceURL != srv.URL+"/works/OL893415W" {
+			t.Errorf("%s: unexpected source %s", e.name, record.SourceURL)
+		}
+		if record.ISBN10 != e.expectedISBN10 {
+			t.Errorf("%s: expected ISBN-10 %q, got %q", e.name, e.expectedISBN10, record.ISBN10)
+		}
+	}
+}
+
+func TestOpenLibrary_LookupError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down for maintenance", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	_, err := OpenLibrary{BaseURL: srv.URL}.Lookup(context.Background(), Query{Title: "Dune"})
+	if err == nil || errors.Is(err, ErrNotFound) || !strings.Contains(err.Error(), "down for maintenance") {
+		t.Errorf("expected the provider's error, got %v", err)
+	}
+}
+
+func TestOpenLibrary_FetchCover(t *testing.T) {
+	var searches []string
+	srv := openLibraryStandIn(t, &searches)
+	defer srv.Close()
+
+	ol := OpenLibrary{BaseURL: srv.URL, CoversURL: srv.URL, UserAgent: "Literal test"}
+
+	cover, err := ol.FetchCover(context.Background(), srv.URL+"/b/id/11481354-L.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(cover)
+	cover.Close()
+
+	if string(b) != "jpeg bytes" {
+		t.Errorf("unexpected cover %q", b)
+	}
+
+	for _, u := range []string{"http://169.254.169.254/latest/meta-data", srv.URL + ".evil.com/b/id/1-L.jpg"} {
+		_, err := ol.FetchCover(context.Background(), u)
+		if !errors.Is(err, ErrForeignCover) {
+			t.Errorf("expected %s to be refused, got %v", u, err)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// Package imaging checks uploaded cover images and turns them into the JPEG
+// renditions that are stored and served.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/webp"
+)
+
+var (
+	ErrTooLarge          = errors.New("cover image file is too large")
+	ErrUnsupportedFormat = errors.New("cover must be a JPEG, PNG, WebP or GIF image")
+	ErrDimensions        = errors.New("cover image is too large or too small")
+	ErrCorrupt           = errors.New("cover image could not be read")
+)
+
+// Limits bound what Process accepts. Images are checked against MaxDimension
+// before they are decoded, so a small file that claims huge dimensions is
+// turned away without allocating for it.
+type Limits struct {
+	MaxBytes     int64
+	MaxDimension int
+	MinDimension int
+}
+
+var DefaultLimits = Limits{
+	MaxBytes:     10 << 20,
+	MaxDimension: 6000,
+	MinDimension: 16,
+}
+
+// Size is a thumbnail Process makes by scaling the cover down to Width,
+// keeping its aspect ratio. Sizes at least as wide as the cover are skipped.
+type Size struct {
+	Name  string
+	Width int
+}
+
+var DefaultSizes = []Size{
+	{"large", 600},
+	{"medium", 300},
+	{"small", 120},
+}
+
+// Rendition is one JPEG-encoded size of a cover.
+type Rendition struct {
+	Name   string
+	Width  int
+	Height int
+	Data   []byte
+}
+
+// Result is a processed cover. Renditions starts with the full-size
+// "original", followed by the thumbnails from largest to smallest.
+type Result struct {
+	SourceType string
+	Renditions []Rendition
+}
+
+const jpegQuality = 85
+
+type format struct {
+	decode       func(io.Reader) (image.Image, error)
+	decodeConfig func(io.Reader) (image.Config, error)
+}
+
+// formats are keyed by the content type http.DetectContentType sniffs, so an
+// upload is decoded as what it is rather than what it is called.
+var formats = map[string]format{
+	"image/jpeg": {jpeg.Decode, jpeg.DecodeConfig},
+	"image/png":  {png.Decode, png.DecodeConfig},
+	"image/gif":  {gif.Decode, gif.DecodeConfig},
+	"image/webp": {webp.Decode, webp.DecodeConfig},
+}
+
+// Process reads an uploaded cover and re-encodes it, along with a thumbnail
+// for each of sizes. Re-encoding drops EXIF and any other metadata, after
+// applying a JPEG's EXIF orientation so the cover stays upright.
+func Process(r io.Reader, limits Limits, sizes []Size) (*Result, error) {
+	data, err := io.ReadAll(io.LimitReader(r, limits.MaxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(data)) > limits.MaxBytes {
+		return nil, ErrTooLarge
+	}
+
+	contentType := http.DetectContentType(data)
+	f, ok := formats[contentType]
+	if !ok {
+		return nil, ErrUnsupportedFormat
+	}
+
+	cfg, err := f.decodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+
+	if !within(cfg.Width, limits) || !within(cfg.Height, limits) {
+		return nil, fmt.Errorf("%w: %dx%d, each side must be %d to %d pixels",
+			ErrDimensions, cfg.Width, cfg.Height, limits.MinDimension, limits.MaxDimension)
+	}
+
+	img, err := f.decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+
+	cover := flatten(img)
+	if contentType == "image/jpeg" {
+		cover = orient(cover, jpegOrientation(data))
+	}
+
+	result := &Result{SourceType: contentType}
+
+	original, err := encode("original", cover)
+	if err != nil {
+		return nil, err
+	}
+	result.Renditions = append(result.Renditions, original)
+
+	w, h := cover.Bounds().Dx(), cover.Bounds().Dy()
+	for _, size := range sizes {
+		if size.Width >= w {
+			continue
+		}
+
+		height := (h*size.Width + w/2) / w
+		if height < 1 {
+			height = 1
+		}
+
+		thumb := image.NewRGBA(image.Rect(0, 0, size.Width, height))
+		draw.CatmullRom.Scale(thumb, thumb.Bounds(), cover, cover.Bounds(), draw.Src, nil)
+
+		rendition, err := encode(size.Name, thumb)
+		if err != nil {
+			return nil, err
+		}
+		result.Renditions = append(result.Renditions, rendition)
+	}
+
+	return result, nil
+}
+
+func within(n int, limits Limits) bool {
+	return n >= limits.MinDimension && n <= limits.MaxDimension
+}
+
+// flatten draws img onto white, since JPEG has no transparency.
+func flatten(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Over)
+	return dst
+}
+
+func encode(name string, img *image.RGBA) (Rendition, error) {
+	var buf bytes.Buffer
+
+	err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+	if err != nil {
+		return Rendition{}, err
+	}
+
+	return Rendition{
+		Name:   name,
+		Width:  img.Bounds().Dx(),
+		Height: img.Bounds().Dy(),
+		Data:   buf.Bytes(),
+	}, nil
+}
@@ -0,0 +1,182 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func testImage(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 200, A: 255})
+		}
+	}
+	return img
+}
+
+func encodePNG(img image.Image) []byte {
+	var buf bytes.Buffer
+	_ = png.Encode(&buf, img)
+	return buf.Bytes()
+}
+
+// withOrientation inserts an EXIF segment carrying orientation o straight
+// after a JPEG's start-of-image marker.
+func withOrientation(jpg []byte, o uint16) []byte {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x01")
+	entry := make([]byte, 12)
+	binary.BigEndian.PutUint16(entry[0:], 0x0112)
+	binary.BigEndian.PutUint16(entry[2:], 3)
+	binary.BigEndian.PutUint32(entry[4:], 1)
+	binary.BigEndian.PutUint16(entry[8:], o)
+	tiff = append(tiff, entry...)
+	tiff = append(tiff, 0, 0, 0, 0)
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	header := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(header[2:], uint16(len(segment)+2))
+
+	out := append([]byte{}, jpg[:2]...)
+	out = append(out, header...)
+	out = append(out, segment...)
+	return append(out, jpg[2:]...)
+}
+
+func TestProcess(t *testing.T) {
+	var jpg bytes.Buffer
+	_ = jpeg.Encode(&jpg, testImage(800, 400), nil)
+
+	var gifImage bytes.Buffer
+	_ = gif.Encode(&gifImage, testImage(40, 40), nil)
+	hugeGIF := append([]byte{}, gifImage.Bytes()...)
+	binary.LittleEndian.PutUint16(hugeGIF[6:], 60000)
+	binary.LittleEndian.PutUint16(hugeGIF[8:], 60000)
+
+	transparent := image.NewNRGBA(image.Rect(0, 0, 50, 50))
+
+	limits := Limits{MaxBytes: 1 << 20, MaxDimension: 1000, MinDimension: 16}
+
+	var tests = []struct {
+		name        string
+		data        []byte
+		expectedErr error
+		expected    []string
+		width       int
+		height      int
+	}{
+		{"png", encodePNG(testImage(700, 1000)), nil, []string{"original", "large", "medium", "small"}, 700, 1000},
+		{"jpeg", jpg.Bytes(), nil, []string{"original", "large", "medium", "small"}, 800, 400},
+		{"rotated jpeg", withOrientation(jpg.Bytes(), 6), nil, []string{"original", "medium", "small"}, 400, 800},
+		{"gif smaller than every thumbnail", gifImage.Bytes(), nil, []string{"original"}, 40, 40},
+		{"transparent png", encodePNG(transparent), nil, []string{"original"}, 50, 50},
+		{"not an image", []byte("<html><body>hello</body></html>"), ErrUnsupportedFormat, nil, 0, 0},
+		{"svg", []byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`), ErrUnsupportedFormat, nil, 0, 0},
+		{"truncated webp", []byte("RIFF\x24\x00\x00\x00WEBPVP8 \x18\x00\x00\x00"), ErrCorrupt, nil, 0, 0},
+		{"truncated png", encodePNG(testImage(700, 1000))[:200], ErrCorrupt, nil, 0, 0},
+		{"too many pixels", hugeGIF, ErrDimensions, nil, 0, 0},
+		{"too small", encodePNG(testImage(8, 8)), ErrDimensions, nil, 0, 0},
+		{"too many bytes", append(encodePNG(testImage(20, 20)), make([]byte, 1<<20)...), ErrTooLarge, nil, 0, 0},
+	}
+
+	for _, e := range tests {
+		result, err := Process(bytes.NewReader(e.data), limits, DefaultSizes)
+		if !errors.Is(err, e.expectedErr) {
+			t.Errorf("%s: expected error %v, got %v", e.name, e.expectedErr, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		var names []string
+		for _, r := range result.Renditions {
+			names = append(names, r.Name)
+
+			decoded, format, err := image.Decode(bytes.NewReader(r.Data))
+			if err != nil || format != "jpeg" {
+				t.Errorf("%s: %s is not a JPEG: %v", e.name, r.Name, err)
+				continue
+			}
+			if decoded.Bounds().Dx() != r.Width || decoded.Bounds().Dy() != r.Height {
+				t.Errorf("%s: %s is %v, reported as %dx%d", e.name, r.Name, decoded.Bounds(), r.Width, r.Height)
+			}
+			if bytes.Contains(r.Data, []byte("Exif")) {
+				t.Errorf("%s: %s still carries EXIF data", e.name, r.Name)
+			}
+		}
+
+		if len(names) != len(e.expected) {
+			t.Errorf("%s: expected renditions %v, got %v", e.name, e.expected, names)
+			continue
+		}
+		for i := range names {
+			if names[i] != e.expected[i] {
+				t.Errorf("%s: expected renditions %v, got %v", e.name, e.expected, names)
+				break
+			}
+		}
+
+		original := result.Renditions[0]
+		if original.Width != e.width || original.Height != e.height {
+			t.Errorf("%s: expected original %dx%d, got %dx%d", e.name, e.width, e.height, original.Width, original.Height)
+		}
+	}
+}
+
+func TestProcess_transparencyOnWhite(t *testing.T) {
+	result, err := Process(bytes.NewReader(encodePNG(image.NewNRGBA(image.Rect(0, 0, 20, 20)))), DefaultLimits, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, _ := jpeg.Decode(bytes.NewReader(result.Renditions[0].Data))
+	r, g, b, _ := img.At(10, 10).RGBA()
+	if r>>8 < 250 || g>>8 < 250 || b>>8 < 250 {
+		t.Errorf("expected transparent pixels to become white, got %d,%d,%d", r>>8, g>>8, b>>8)
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// a 3x2 image whose pixels record their own position
+	src := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 3; x++ {
+			src.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), A: 255})
+		}
+	}
+
+	// where the top-left pixel of the stored image ends up for each orientation
+	var tests = []struct {
+		orientation int
+		w, h        int
+		x, y        int
+	}{
+		{1, 3, 2, 0, 0},
+		{2, 3, 2, 2, 0},
+		{3, 3, 2, 2, 1},
+		{4, 3, 2, 0, 1},
+		{5, 2, 3, 0, 0},
+		{6, 2, 3, 1, 0},
+		{7, 2, 3, 1, 2},
+		{8, 2, 3, 0, 2},
+	}
+
+	for _, e := range tests {
+		dst := orient(src, e.orientation)
+		if dst.Bounds().Dx() != e.w || dst.Bounds().Dy() != e.h {
+			t.Errorf("orientation %d: expected %dx%d, got %v", e.orientation, e.w, e.h, dst.Bounds())
+			continue
+		}
+		if c := dst.RGBAAt(e.x, e.y); c.R != 0 || c.G != 0 {
+			t.Errorf("orientation %d: expected the top-left pixel at %d,%d, found pixel %d,%d there", e.orientation, e.x, e.y, c.R, c.G)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+// Package isbn validates International Standard Book Numbers and converts
+// between their ten and thirteen digit forms.
+package isbn
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrInvalid is returned for a string that isn't shaped like an ISBN.
+	ErrInvalid = errors.New("isbn: must be 10 or 13 digits")
+
+	// ErrChecksum is returned when the check digit doesn't match the rest.
+	ErrChecksum = errors.New("isbn: check digit does not match")
+
+	// ErrNoISBN10 is returned when converting an ISBN-13 with the 979 prefix,
+	// which has no ten digit form.
+	ErrNoISBN10 = errors.New("isbn: only 978 ISBNs have an ISBN-10")
+)
+
+// Clean strips the separators and optional "ISBN" label people write ISBNs
+// with, so "ISBN-13: 978-0-441-17271-9" becomes "9780441172719". It doesn't
+// validate what is left.
+func Clean(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) >= 4 && strings.EqualFold(s[:4], "ISBN") {
+		s = s[4:]
+		for _, label := range []string{"-10", "-13", "10", "13"} {
+			if strings.HasPrefix(s, label) {
+				s = s[len(label):]
+				break
+			}
+		}
+		s = strings.TrimLeft(s, ": ")
+	}
+
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '-', ' ':
+			return -1
+		case 'x':
+			return 'X'
+		}
+		return r
+	}, s)
+}
+
+// Parse validates an ISBN in either form, written any way Clean accepts, and
+// returns it as an ISBN-13 along with its ISBN-10, which is empty for a 979
+// ISBN.
+func Parse(s string) (isbn13, isbn10 string, err error) {
+	s = Clean(s)
+
+	switch len(s) {
+	case 10:
+		err = check10(s)
+		if err != nil {
+			return "", "", err
+		}
+		return from10(s), s, nil
+	case 13:
+		err = check13(s)
+		if err != nil {
+			return "", "", err
+		}
+		isbn10, err = To10(s)
+		if errors.Is(err, ErrNoISBN10) {
+			err = nil
+		}
+		return s, isbn10, err
+	default:
+		return "", "", ErrInvalid
+	}
+}
+
+// To13 converts a valid ISBN-10 to its ISBN-13.
+func To13(isbn10 string) (string, error) {
+	isbn10 = Clean(isbn10)
+
+	err := check10(isbn10)
+	if err != nil {
+		return "", err
+	}
+
+	return from10(isbn10), nil
+}
+
+// To10 converts a valid ISBN-13 to its ISBN-10, for the 978 prefix that has
+// one.
+func To10(isbn13 string) (string, error) {
+	isbn13 = Clean(isbn13)
+
+	err := check13(isbn13)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(isbn13, "978") {
+		return "", ErrNoISBN10
+	}
+
+	body := isbn13[3:12]
+	return body + string(checkDigit10(body)), nil
+}
+
+func from10(isbn10 string) string {
+	body := "978" + isbn10[:9]
+	return body + string(checkDigit13(body))
+}
+
+func check10(s string) error {
+	if len(s) != 10 || !digits(s[:9]) || !(digits(s[9:]) || s[9] == 'X') {
+		return ErrInvalid
+	}
+	if checkDigit10(s[:9]) != s[9] {
+		return ErrChecksum
+	}
+	return nil
+}
+
+// check13 also requires one of the two prefixes reserved for books, so an
+// EAN for something else isn't taken for an ISBN.
+func check13(s string) error {
+	if len(s) != 13 || !digits(s) || !(strings.HasPrefix(s, "978") || strings.HasPrefix(s, "979")) {
+		return ErrInvalid
+	}
+	if checkDigit13(s[:12]) != s[12] {
+		return ErrChecksum
+	}
+	return nil
+}
+
+// checkDigit10 weights the nine digits 10 down to 2, and picks the digit that
+// makes the sum a multiple of 11, with X standing for 10.
+func checkDigit10(body string) byte {
+	sum := 0
+	for i := 0; i < 9; i++ {
+		sum += int(body[i]-'0') * (10 - i)
+	}
+
+	d := (11 - sum%11) % 11
+	if d == 10 {
+		return 'X'
+	}
+	return byte('0' + d)
+}
+
+// checkDigit13 weights the twelve digits alternately 1 and 3, and picks the
+// digit that makes the sum a multiple of 10.
+func checkDigit13(body string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		d := int(body[i] - '0')
+		if i%2 == 1 {
+			d *= 3
+		}
+		sum += d
+	}
+
+	return byte('0' + (10-sum%10)%10)
+}
+
+func digits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
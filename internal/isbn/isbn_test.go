@@ -0,0 +1,65 @@
+package isbn
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	var tests = []struct {
+		name   string
+		input  string
+		isbn13 string
+		isbn10 string
+		err    error
+	}{
+		{"isbn-13", "9780441172719", "9780441172719", "0441172717", nil},
+		{"isbn-13 with hyphens", "978-0-441-17271-9", "9780441172719", "0441172717", nil},
+		{"labelled isbn-13", "ISBN-13: 978-0-441-17271-9", "9780441172719", "0441172717", nil},
+		{"isbn-10", "0441172717", "9780441172719", "0441172717", nil},
+		{"labelled isbn-10", "ISBN 0-441-17271-7", "9780441172719", "0441172717", nil},
+		{"isbn-10 with X check digit", "0-8044-2957-x", "9780804429573", "080442957X", nil},
+		{"979 prefix", "979-10-90636-07-1", "9791090636071", "", nil},
+		{"bad isbn-13 check digit", "9780441172710", "", "", ErrChecksum},
+		{"bad isbn-10 check digit", "0441172718", "", "", ErrChecksum},
+		{"not a book EAN", "4006381333931", "", "", ErrInvalid},
+		{"X in isbn-13", "978044117271X", "", "", ErrInvalid},
+		{"X before the end", "04411727X7", "", "", ErrInvalid},
+		{"too short", "12345", "", "", ErrInvalid},
+		{"empty", "", "", "", ErrInvalid},
+	}
+
+	for _, e := range tests {
+		isbn13, isbn10, err := Parse(e.input)
+		if !errors.Is(err, e.err) {
+			t.Errorf("%s: expected error %v, got %v", e.name, e.err, err)
+			continue
+		}
+
+		if isbn13 != e.isbn13 || isbn10 != e.isbn10 {
+			t.Errorf("%s: expected %q and %q, got %q and %q", e.name, e.isbn13, e.isbn10, isbn13, isbn10)
+		}
+	}
+}
+
+func TestConversion(t *testing.T) {
+	isbn13, err := To13("0-14-044913-2")
+	if err != nil || isbn13 != "9780140449136" {
+		t.Errorf("expected 9780140449136, got %q (%v)", isbn13, err)
+	}
+
+	isbn10, err := To10(isbn13)
+	if err != nil || isbn10 != "0140449132" {
+		t.Errorf("expected 0140449132, got %q (%v)", isbn10, err)
+	}
+
+	_, err = To10("9791090636071")
+	if !errors.Is(err, ErrNoISBN10) {
+		t.Errorf("expected ErrNoISBN10, got %v", err)
+	}
+
+	_, err = To13("9780140449136")
+	if !errors.Is(err, ErrInvalid) {
+		t.Errorf("expected an ISBN-13 to be refused as an ISBN-10, got %v", err)
+	}
+}
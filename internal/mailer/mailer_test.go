@@ -0,0 +1,40 @@
+package mailer
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestFileOutbox_Send(t *testing.T) {
+	dir := t.TempDir()
+	outbox := FileOutbox{Dir: dir, From: "library@example.com"}
+
+	for i := 0; i < 2; i++ {
+		err := outbox.Send(context.Background(), Message{To: "me@here.com", Subject: "Hello", Body: "line one\nline two"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 messages in the outbox, got %d", len(entries))
+	}
+
+	contents, err := os.ReadFile(dir + "/" + entries[0].Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"To: me@here.com\r\n", "Subject: Hello\r\n", "\r\n\r\nline one\r\nline two"} {
+		if !strings.Contains(string(contents), want) {
+			t.Errorf("message is missing %q:\n%s", want, contents)
+		}
+	}
+}
@@ -0,0 +1,332 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// ErrOutdatedSchema is returned by Check when the database has not had every
+// embedded migration applied to it.
+var ErrOutdatedSchema = errors.New("database schema is out of date")
+
+// Timeout bounds each migration on its own, so a long run of migrations
+// doesn't have to fit in one deadline. Data migrations over a large catalog
+// may need more, which cmd/migrate's -timeout flag sets.
+var Timeout = 10 * time.Minute
+
+// queryTimeout bounds the bookkeeping around the migrations.
+const queryTimeout = 30 * time.Second
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// All returns every embedded migration, ordered by version.
+func All() ([]Migration, error) {
+	entries, err := fs.ReadDir(files, "sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+
+	for _, entry := range entries {
+		fileName := entry.Name()
+
+		var direction string
+		switch {
+		case strings.HasSuffix(fileName, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(fileName, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("migration %s: must end in .up.sql or .down.sql", fileName)
+		}
+
+		base := strings.TrimSuffix(fileName, "."+direction+".sql")
+		parts := strings.SplitN(base, "_", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("migration %s: name must look like 0001_description", fileName)
+		}
+
+		version, err := strconv.Atoi(parts[0])
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("migration %s: invalid version %q", fileName, parts[0])
+		}
+
+		contents, err := files.ReadFile(path.Join("sql", fileName))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: parts[1]}
+			byVersion[version] = m
+		} else if m.Name != parts[1] {
+			return nil, fmt.Errorf("migration %d: conflicting names %q and %q", version, m.Name, parts[1])
+		}
+
+		if direction == "up" {
+			m.Up = string(contents)
+		} else {
+			m.Down = string(contents)
+		}
+	}
+
+	var all []Migration
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d: missing up file", m.Version)
+		}
+		all = append(all, *m)
+	}
+
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].Version < all[j].Version
+	})
+
+	return all, nil
+}
+
+// Latest returns the version of the newest embedded migration.
+func Latest() (int, error) {
+	all, err := All()
+	if err != nil {
+		return 0, err
+	}
+
+	if len(all) == 0 {
+		return 0, nil
+	}
+
+	return all[len(all)-1].Version, nil
+}
+
+// Current returns the highest version recorded in schema_migrations, or 0 if
+// nothing has been applied yet. It only reads, so the API can call it on
+// every start: a database without schema_migrations is at version 0.
+func Current(db *sql.DB) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	var exists bool
+	err := db.QueryRowContext(ctx, `select to_regclass('schema_migrations') is not null`).Scan(&exists)
+	if err != nil {
+		return 0, err
+	}
+
+	if !exists {
+		return 0, nil
+	}
+
+	return currentVersion(ctx, db)
+}
+
+// Check returns ErrOutdatedSchema if the database is behind the embedded
+// migrations, and an error if it is ahead of them.
+func Check(db *sql.DB) error {
+	latest, err := Latest()
+	if err != nil {
+		return err
+	}
+
+	current, err := Current(db)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case current < latest:
+		return fmt.Errorf("%w: at version %d, expected %d", ErrOutdatedSchema, current, latest)
+	case current > latest:
+		return fmt.Errorf("database schema version %d is newer than this build (%d)", current, latest)
+	}
+
+	return nil
+}
+
+// Up applies every migration newer than the current version, each in its own
+// transaction and within its own Timeout.
+func Up(db *sql.DB) error {
+	all, err := All()
+	if err != nil {
+		return err
+	}
+
+	current, err := prepare(db)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range all {
+		if m.Version <= current {
+			continue
+		}
+
+		err := apply(db, m.Up, func(ctx context.Context, tx *sql.Tx) error {
+			stmt := `insert into schema_migrations (version, name, applied_at) values ($1, $2, $3)`
+			_, err := tx.ExecContext(ctx, stmt, m.Version, m.Name, time.Now())
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// Down rolls back the given number of applied migrations, newest first.
+func Down(db *sql.DB, steps int) error {
+	all, err := All()
+	if err != nil {
+		return err
+	}
+
+	current, err := prepare(db)
+	if err != nil {
+		return err
+	}
+
+	for i := len(all) - 1; i >= 0 && steps > 0; i-- {
+		m := all[i]
+		if m.Version > current {
+			continue
+		}
+
+		if m.Down == "" {
+			return fmt.Errorf("migration %d (%s): no down file", m.Version, m.Name)
+		}
+
+		err := apply(db, m.Down, func(ctx context.Context, tx *sql.Tx) error {
+			stmt := `delete from schema_migrations where version = $1`
+			_, err := tx.ExecContext(ctx, stmt, m.Version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+
+		steps--
+	}
+
+	return nil
+}
+
+// Force records version as the current schema without running any SQL. It is
+// meant for adopting databases that were set up by hand before migrations
+// existed.
+func Force(db *sql.DB, version int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	all, err := All()
+	if err != nil {
+		return err
+	}
+
+	err = ensureVersionTable(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `delete from schema_migrations`)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range all {
+		if m.Version > version {
+			break
+		}
+
+		stmt := `insert into schema_migrations (version, name, applied_at) values ($1, $2, $3)`
+		_, err := tx.ExecContext(ctx, stmt, m.Version, m.Name, time.Now())
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// prepare creates schema_migrations if needed and returns the current version.
+func prepare(db *sql.DB) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	err := ensureVersionTable(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+
+	return currentVersion(ctx, db)
+}
+
+func ensureVersionTable(ctx context.Context, db *sql.DB) error {
+	stmt := `create table if not exists schema_migrations (
+		version integer primary key,
+		name character varying(255) not null,
+		applied_at timestamp without time zone not null
+	)`
+
+	_, err := db.ExecContext(ctx, stmt)
+	return err
+}
+
+func currentVersion(ctx context.Context, db *sql.DB) (int, error) {
+	var version int
+
+	row := db.QueryRowContext(ctx, `select coalesce(max(version), 0) from schema_migrations`)
+	err := row.Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+func apply(db *sql.DB, script string, record func(ctx context.Context, tx *sql.Tx) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, script)
+	if err != nil {
+		return err
+	}
+
+	err = record(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,82 @@
+package migrations
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestAll(t *testing.T) {
+	all, err := All()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(all) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+
+	for i, m := range all {
+		if m.Version != i+1 {
+			t.Errorf("expected version %d, got %d (%s)", i+1, m.Version, m.Name)
+		}
+
+		if m.Up == "" || m.Down == "" {
+			t.Errorf("migration %d (%s) is missing an up or down script", m.Version, m.Name)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	latest, err := Latest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		name     string
+		current  int
+		outdated bool
+		wantErr  bool
+	}{
+		{"up to date", latest, false, false},
+		{"behind", latest - 1, true, true},
+		{"ahead", latest + 1, false, true},
+	}
+
+	for _, e := range tests {
+		db, mock, _ := sqlmock.New()
+
+		mock.ExpectQuery("select to_regclass").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectQuery("select coalesce").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(e.current))
+
+		err := Check(db)
+		if (err != nil) != e.wantErr {
+			t.Errorf("%s: unexpected error value %v", e.name, err)
+		}
+
+		if errors.Is(err, ErrOutdatedSchema) != e.outdated {
+			t.Errorf("%s: expected ErrOutdatedSchema to be %v, got %v", e.name, e.outdated, err)
+		}
+
+		db.Close()
+	}
+}
+
+func TestCheck_noVersionTable(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	// Check must not create the table: any Exec would fail the expectations
+	mock.ExpectQuery("select to_regclass").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+	err := Check(db)
+	if !errors.Is(err, ErrOutdatedSchema) {
+		t.Errorf("expected ErrOutdatedSchema, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS public.users;
+DROP TABLE IF EXISTS public.tokens;
+DROP TABLE IF EXISTS public.genres;
+DROP TABLE IF EXISTS public.books_genres;
+DROP TABLE IF EXISTS public.books;
+DROP TABLE IF EXISTS public.authors;
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS public.books_search_vector_idx;
+DROP TRIGGER IF EXISTS authors_search_vector_update ON public.authors;
+DROP FUNCTION IF EXISTS public.authors_search_vector_trigger();
+DROP TRIGGER IF EXISTS books_search_vector_update ON public.books;
+DROP FUNCTION IF EXISTS public.books_search_vector_trigger();
+DROP FUNCTION IF EXISTS public.book_search_document(text, text, integer);
+ALTER TABLE public.books DROP COLUMN IF EXISTS search_vector;
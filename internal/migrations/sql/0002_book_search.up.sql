@@ -0,0 +1,41 @@
+ALTER TABLE public.books ADD COLUMN search_vector tsvector;
+
+CREATE FUNCTION public.book_search_document(title text, description text, author_id integer) RETURNS tsvector
+    LANGUAGE sql STABLE
+    AS $$
+    SELECT setweight(to_tsvector('english', coalesce($1, '')), 'A') ||
+           setweight(to_tsvector('english', coalesce((SELECT author_name FROM public.authors WHERE id = $3), '')), 'B') ||
+           setweight(to_tsvector('english', coalesce($2, '')), 'C')
+    $$;
+
+CREATE FUNCTION public.books_search_vector_trigger() RETURNS trigger
+    LANGUAGE plpgsql
+    AS $$
+BEGIN
+    NEW.search_vector := public.book_search_document(NEW.title, NEW.description, NEW.author_id);
+    RETURN NEW;
+END
+$$;
+
+CREATE TRIGGER books_search_vector_update
+    BEFORE INSERT OR UPDATE OF title, description, author_id ON public.books
+    FOR EACH ROW EXECUTE FUNCTION public.books_search_vector_trigger();
+
+CREATE FUNCTION public.authors_search_vector_trigger() RETURNS trigger
+    LANGUAGE plpgsql
+    AS $$
+BEGIN
+    UPDATE public.books
+        SET search_vector = public.book_search_document(title, description, author_id)
+        WHERE author_id = NEW.id;
+    RETURN NULL;
+END
+$$;
+
+CREATE TRIGGER authors_search_vector_update
+    AFTER UPDATE OF author_name ON public.authors
+    FOR EACH ROW EXECUTE FUNCTION public.authors_search_vector_trigger();
+
+UPDATE public.books SET search_vector = public.book_search_document(title, description, author_id);
+
+CREATE INDEX books_search_vector_idx ON public.books USING gin (search_vector);
@@ -0,0 +1,3 @@
+ALTER TABLE public.users DROP CONSTRAINT IF EXISTS users_role_id_fkey;
+ALTER TABLE public.users DROP COLUMN IF EXISTS role_id;
+DROP TABLE IF EXISTS public.roles;
@@ -0,0 +1,21 @@
+CREATE TABLE public.roles (
+    id integer GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    role_name character varying(64) NOT NULL UNIQUE,
+    created_at timestamp without time zone NOT NULL,
+    updated_at timestamp without time zone NOT NULL
+);
+
+INSERT INTO public.roles (role_name, created_at, updated_at) VALUES
+    ('admin', now(), now()),
+    ('editor', now(), now()),
+    ('viewer', now(), now());
+
+ALTER TABLE public.users ADD COLUMN role_id integer;
+
+-- every user could manage everything before roles existed, so keep it that way
+UPDATE public.users SET role_id = (SELECT id FROM public.roles WHERE role_name = 'admin');
+
+ALTER TABLE public.users ALTER COLUMN role_id SET NOT NULL;
+
+ALTER TABLE public.users
+    ADD CONSTRAINT users_role_id_fkey FOREIGN KEY (role_id) REFERENCES public.roles(id);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS public.tokens_token_hash_idx;
+
+-- the plaintext cannot be recovered; every existing session is invalidated
+DELETE FROM public.tokens;
+
+ALTER TABLE public.tokens ADD COLUMN token character varying(255) NOT NULL;
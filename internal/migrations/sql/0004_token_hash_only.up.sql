@@ -0,0 +1,5 @@
+-- token_hash has always been written alongside the plaintext, so existing
+-- sessions keep working once the plaintext is gone
+ALTER TABLE public.tokens DROP COLUMN token;
+
+CREATE UNIQUE INDEX tokens_token_hash_idx ON public.tokens (token_hash);
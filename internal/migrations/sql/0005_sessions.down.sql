@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS public.tokens_user_id_idx;
+
+ALTER TABLE public.tokens
+    DROP COLUMN IF EXISTS last_used_at,
+    DROP COLUMN IF EXISTS ip_address,
+    DROP COLUMN IF EXISTS user_agent,
+    DROP COLUMN IF EXISTS name;
@@ -0,0 +1,9 @@
+ALTER TABLE public.tokens
+    ADD COLUMN name character varying(255) NOT NULL DEFAULT '',
+    ADD COLUMN user_agent character varying(512) NOT NULL DEFAULT '',
+    ADD COLUMN ip_address character varying(64) NOT NULL DEFAULT '',
+    ADD COLUMN last_used_at timestamp with time zone NOT NULL DEFAULT now();
+
+UPDATE public.tokens SET last_used_at = updated_at;
+
+CREATE INDEX tokens_user_id_idx ON public.tokens (user_id);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS public.refresh_tokens;
+
+ALTER TABLE public.tokens DROP CONSTRAINT IF EXISTS tokens_pkey;
@@ -0,0 +1,15 @@
+ALTER TABLE public.tokens ADD PRIMARY KEY (id);
+
+-- each row belongs to the session (tokens row) it was issued for; rotating a
+-- refresh token adds a row to the same session, which is the token family
+CREATE TABLE public.refresh_tokens (
+    id integer GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    session_id integer NOT NULL REFERENCES public.tokens(id) ON DELETE CASCADE,
+    user_id integer NOT NULL,
+    token_hash bytea NOT NULL UNIQUE,
+    expiry timestamp with time zone NOT NULL,
+    used_at timestamp with time zone,
+    created_at timestamp without time zone NOT NULL
+);
+
+CREATE INDEX refresh_tokens_session_id_idx ON public.refresh_tokens (session_id);
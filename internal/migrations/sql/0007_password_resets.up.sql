@@ -0,0 +1,10 @@
+CREATE TABLE public.password_resets (
+    id integer GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    user_id integer NOT NULL,
+    token_hash bytea NOT NULL UNIQUE,
+    expiry timestamp with time zone NOT NULL,
+    used_at timestamp with time zone,
+    created_at timestamp without time zone NOT NULL
+);
+
+CREATE INDEX password_resets_user_id_idx ON public.password_resets (user_id);
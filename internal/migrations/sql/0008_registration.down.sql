@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS public.settings;
+
+DELETE FROM public.one_time_tokens WHERE scope <> 'password-reset';
+ALTER TABLE public.one_time_tokens DROP COLUMN scope;
+ALTER INDEX public.one_time_tokens_user_id_idx RENAME TO password_resets_user_id_idx;
+ALTER TABLE public.one_time_tokens RENAME TO password_resets;
@@ -0,0 +1,14 @@
+-- password reset tokens become one kind of single-use emailed token; email
+-- verification is the other
+ALTER TABLE public.password_resets RENAME TO one_time_tokens;
+ALTER INDEX public.password_resets_user_id_idx RENAME TO one_time_tokens_user_id_idx;
+ALTER TABLE public.one_time_tokens ADD COLUMN scope text NOT NULL DEFAULT 'password-reset';
+ALTER TABLE public.one_time_tokens ALTER COLUMN scope DROP DEFAULT;
+
+CREATE TABLE public.settings (
+    name text PRIMARY KEY,
+    value text NOT NULL,
+    updated_at timestamp without time zone NOT NULL DEFAULT now()
+);
+
+INSERT INTO public.settings (name, value) VALUES ('registration_open', 'false');
@@ -0,0 +1,3 @@
+ALTER TABLE public.users
+    ADD COLUMN failed_logins integer NOT NULL DEFAULT 0,
+    ADD COLUMN locked_until timestamp with time zone;
@@ -0,0 +1,18 @@
+-- actor and target ids are not foreign keys: the record has to outlive the
+-- users and rows it describes
+CREATE TABLE public.audit_events (
+    id bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    actor_id integer,
+    actor_email text NOT NULL DEFAULT '',
+    action text NOT NULL,
+    target_type text NOT NULL,
+    target_id integer,
+    before jsonb,
+    after jsonb,
+    ip_address text NOT NULL DEFAULT '',
+    created_at timestamp with time zone NOT NULL DEFAULT now()
+);
+
+CREATE INDEX audit_events_created_at_idx ON public.audit_events (created_at DESC);
+CREATE INDEX audit_events_target_idx ON public.audit_events (target_type, target_id);
+CREATE INDEX audit_events_actor_id_idx ON public.audit_events (actor_id);
@@ -0,0 +1 @@
+ALTER TABLE public.books DROP COLUMN IF EXISTS covers;
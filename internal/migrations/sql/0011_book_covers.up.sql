@@ -0,0 +1,2 @@
+-- the cover renditions stored for each book, as [{name, key, width, height}]
+ALTER TABLE public.books ADD COLUMN covers jsonb NOT NULL DEFAULT '[]';
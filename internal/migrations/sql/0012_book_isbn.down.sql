@@ -0,0 +1,2 @@
+ALTER TABLE public.books DROP COLUMN IF EXISTS isbn_13;
+ALTER TABLE public.books DROP COLUMN IF EXISTS isbn_10;
@@ -0,0 +1,7 @@
+-- ISBNs are stored in both forms, normalised to bare digits (and X); a book
+-- with a 979 ISBN has no ISBN-10
+ALTER TABLE public.books ADD COLUMN isbn_10 character varying(10);
+ALTER TABLE public.books ADD COLUMN isbn_13 character varying(13);
+
+CREATE UNIQUE INDEX books_isbn_10_idx ON public.books (isbn_10);
+CREATE UNIQUE INDEX books_isbn_13_idx ON public.books (isbn_13);
@@ -0,0 +1,27 @@
+DROP TRIGGER IF EXISTS books_authors_search_vector_update ON public.books_authors;
+DROP FUNCTION IF EXISTS public.books_authors_search_vector_trigger();
+
+CREATE OR REPLACE FUNCTION public.books_search_vector_trigger() RETURNS trigger
+    LANGUAGE plpgsql
+    AS $$
+BEGIN
+    NEW.search_vector := public.book_search_document(NEW.title, NEW.description, NEW.author_id);
+    RETURN NEW;
+END
+$$;
+
+CREATE OR REPLACE FUNCTION public.authors_search_vector_trigger() RETURNS trigger
+    LANGUAGE plpgsql
+    AS $$
+BEGIN
+    UPDATE public.books
+        SET search_vector = public.book_search_document(title, description, author_id)
+        WHERE author_id = NEW.id;
+    RETURN NULL;
+END
+$$;
+
+DROP FUNCTION IF EXISTS public.book_contributors_search_document(integer, text, text);
+DROP TABLE IF EXISTS public.books_authors;
+
+UPDATE public.books SET search_vector = public.book_search_document(title, description, author_id);
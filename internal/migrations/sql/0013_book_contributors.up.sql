@@ -0,0 +1,74 @@
+-- every author credited on a book, in order, with their role; books.author_id
+-- stays as the first author, for clients that only know about one
+CREATE TABLE public.books_authors (
+    book_id integer NOT NULL REFERENCES public.books(id) ON DELETE CASCADE,
+    author_id integer NOT NULL REFERENCES public.authors(id),
+    role text NOT NULL DEFAULT 'author' CHECK (role IN ('author', 'editor', 'translator', 'illustrator')),
+    position integer NOT NULL DEFAULT 0,
+    created_at timestamp without time zone NOT NULL DEFAULT now(),
+    updated_at timestamp without time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (book_id, author_id, role)
+);
+
+CREATE INDEX books_authors_author_id_idx ON public.books_authors (author_id);
+
+INSERT INTO public.books_authors (book_id, author_id, role, position, created_at, updated_at)
+    SELECT b.id, b.author_id, 'author', 0, coalesce(b.created_at, now()), coalesce(b.updated_at, now())
+    FROM public.books b
+    JOIN public.authors a ON (a.id = b.author_id);
+
+-- search covers every contributor's name rather than only the first author's
+CREATE FUNCTION public.book_contributors_search_document(book_id integer, title text, description text) RETURNS tsvector
+    LANGUAGE sql STABLE
+    AS $$
+    SELECT setweight(to_tsvector('english', coalesce($2, '')), 'A') ||
+           setweight(to_tsvector('english', coalesce((SELECT string_agg(a.author_name, ' ' ORDER BY ba.position)
+                FROM public.books_authors ba JOIN public.authors a ON (a.id = ba.author_id)
+                WHERE ba.book_id = $1), '')), 'B') ||
+           setweight(to_tsvector('english', coalesce($3, '')), 'C')
+    $$;
+
+CREATE OR REPLACE FUNCTION public.books_search_vector_trigger() RETURNS trigger
+    LANGUAGE plpgsql
+    AS $$
+BEGIN
+    NEW.search_vector := public.book_contributors_search_document(NEW.id, NEW.title, NEW.description);
+    RETURN NEW;
+END
+$$;
+
+CREATE OR REPLACE FUNCTION public.authors_search_vector_trigger() RETURNS trigger
+    LANGUAGE plpgsql
+    AS $$
+BEGIN
+    UPDATE public.books
+        SET search_vector = public.book_contributors_search_document(id, title, description)
+        WHERE id IN (SELECT book_id FROM public.books_authors WHERE author_id = NEW.id);
+    RETURN NULL;
+END
+$$;
+
+CREATE FUNCTION public.books_authors_search_vector_trigger() RETURNS trigger
+    LANGUAGE plpgsql
+    AS $$
+DECLARE
+    changed integer;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        changed := OLD.book_id;
+    ELSE
+        changed := NEW.book_id;
+    END IF;
+
+    UPDATE public.books
+        SET search_vector = public.book_contributors_search_document(id, title, description)
+        WHERE id = changed;
+    RETURN NULL;
+END
+$$;
+
+CREATE TRIGGER books_authors_search_vector_update
+    AFTER INSERT OR UPDATE OR DELETE ON public.books_authors
+    FOR EACH ROW EXECUTE FUNCTION public.books_authors_search_vector_trigger();
+
+UPDATE public.books SET search_vector = public.book_contributors_search_document(id, title, description);
@@ -0,0 +1,175 @@
+package opds
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+// encoding/xml writes prefixed names as given, which is enough to produce the
+// namespaced elements and attributes declared on the feed.
+type atomFeed struct {
+	XMLName         xml.Name `xml:"feed"`
+	Xmlns           string   `xml:"xmlns,attr"`
+	XmlnsDC         string   `xml:"xmlns:dc,attr"`
+	XmlnsOPDS       string   `xml:"xmlns:opds,attr"`
+	XmlnsOpenSearch string   `xml:"xmlns:opensearch,attr"`
+	XmlnsThr        string   `xml:"xmlns:thr,attr"`
+
+	ID           string      `xml:"id"`
+	Title        string      `xml:"title"`
+	Updated      string      `xml:"updated"`
+	Author       atomPerson  `xml:"author"`
+	TotalResults int         `xml:"opensearch:totalResults,omitempty"`
+	ItemsPerPage int         `xml:"opensearch:itemsPerPage,omitempty"`
+	StartIndex   int         `xml:"opensearch:startIndex,omitempty"`
+	Links        []atomLink  `xml:"link"`
+	Entries      []atomEntry `xml:"entry"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Rel   string `xml:"rel,attr,omitempty"`
+	Href  string `xml:"href,attr"`
+	Type  string `xml:"type,attr,omitempty"`
+	Title string `xml:"title,attr,omitempty"`
+	Count int    `xml:"thr:count,attr,omitempty"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Text string `xml:",chardata"`
+}
+
+type atomCategory struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr"`
+}
+
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	ID         string         `xml:"id"`
+	Updated    string         `xml:"updated"`
+	Authors    []atomPerson   `xml:"author"`
+	Issued     string         `xml:"dc:issued,omitempty"`
+	Categories []atomCategory `xml:"category"`
+	Summary    *atomText      `xml:"summary"`
+	Content    *atomText      `xml:"content"`
+	Links      []atomLink     `xml:"link"`
+}
+
+// WriteAtom writes the feed as an OPDS 1.2 Atom document. author names the
+// catalog's publisher, which Atom requires of every feed.
+func (f *Feed) WriteAtom(w io.Writer, author string) error {
+	feed := atomFeed{
+		Xmlns:           "http://www.w3.org/2005/Atom",
+		XmlnsDC:         "http://purl.org/dc/terms/",
+		XmlnsOPDS:       "http://opds-spec.org/2010/catalog",
+		XmlnsOpenSearch: "http://a9.com/-/spec/opensearch/1.1/",
+		XmlnsThr:        "http://purl.org/syndication/thread/1.0",
+		ID:              f.ID,
+		Title:           f.Title,
+		Updated:         formatTime(f.updated()),
+		Author:          atomPerson{Name: author},
+		TotalResults:    f.Total,
+		ItemsPerPage:    f.PerPage,
+	}
+
+	if f.Page > 0 && f.PerPage > 0 {
+		feed.StartIndex = (f.Page-1)*f.PerPage + 1
+	}
+
+	for _, l := range f.Links {
+		feed.Links = append(feed.Links, atomLinkFor(l))
+	}
+
+	for _, n := range f.Navigation {
+		entry := atomEntry{
+			Title:   n.Title,
+			ID:      n.ID,
+			Updated: formatTime(n.Updated),
+			Links:   []atomLink{{Rel: n.Rel, Href: n.Href, Type: atomType(n.Kind), Count: n.Count}},
+		}
+		if n.Updated.IsZero() {
+			entry.Updated = feed.Updated
+		}
+		if entry.Links[0].Rel == "" {
+			entry.Links[0].Rel = "subsection"
+		}
+		if n.Count > 0 {
+			entry.Content = &atomText{Type: "text", Text: countBooks(n.Count)}
+		}
+
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	for _, p := range f.Publications {
+		entry := atomEntry{
+			Title:   p.Title,
+			ID:      p.ID,
+			Updated: formatTime(p.Updated),
+		}
+		if p.Updated.IsZero() {
+			entry.Updated = feed.Updated
+		}
+
+		for _, name := range p.Authors {
+			entry.Authors = append(entry.Authors, atomPerson{Name: name})
+		}
+		if p.Published > 0 {
+			entry.Issued = fmt.Sprintf("%04d", p.Published)
+		}
+		for _, s := range p.Subjects {
+			entry.Categories = append(entry.Categories, atomCategory{Term: s, Label: s})
+		}
+		if p.Description != "" {
+			entry.Summary = &atomText{Type: "text", Text: p.Description}
+		}
+		for _, l := range p.Links {
+			entry.Links = append(entry.Links, atomLinkFor(l))
+		}
+		for _, l := range p.Images {
+			entry.Links = append(entry.Links, atomLinkFor(l))
+		}
+
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	err = enc.Encode(feed)
+	if err != nil {
+		return err
+	}
+
+	return enc.Flush()
+}
+
+func atomLinkFor(l Link) atomLink {
+	link := atomLink{Rel: l.Rel, Href: l.Href, Type: l.Type, Title: l.Title}
+	if link.Type == "" {
+		link.Type = atomType(l.Kind)
+	}
+	return link
+}
+
+func atomType(kind string) string {
+	if kind == Acquisition {
+		return AcquisitionType
+	}
+	return NavigationType
+}
+
+func countBooks(n int) string {
+	if n == 1 {
+		return "1 book"
+	}
+	return fmt.Sprintf("%d books", n)
+}
@@ -0,0 +1,137 @@
+package opds
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+)
+
+type jsonFeed struct {
+	Metadata     jsonFeedMetadata   `json:"metadata"`
+	Links        []jsonLink         `json:"links"`
+	Navigation   *[]jsonLink        `json:"navigation,omitempty"`
+	Publications *[]jsonPublication `json:"publications,omitempty"`
+}
+
+type jsonFeedMetadata struct {
+	Title         string `json:"title"`
+	Modified      string `json:"modified"`
+	NumberOfItems int    `json:"numberOfItems,omitempty"`
+	ItemsPerPage  int    `json:"itemsPerPage,omitempty"`
+	CurrentPage   int    `json:"currentPage,omitempty"`
+}
+
+type jsonLink struct {
+	Rel        string          `json:"rel,omitempty"`
+	Href       string          `json:"href"`
+	Type       string          `json:"type,omitempty"`
+	Title      string          `json:"title,omitempty"`
+	Templated  bool            `json:"templated,omitempty"`
+	Width      int             `json:"width,omitempty"`
+	Height     int             `json:"height,omitempty"`
+	Properties *jsonProperties `json:"properties,omitempty"`
+}
+
+type jsonProperties struct {
+	NumberOfItems int `json:"numberOfItems"`
+}
+
+type jsonPublication struct {
+	Metadata jsonPublicationMetadata `json:"metadata"`
+	Links    []jsonLink              `json:"links"`
+	Images   []jsonLink              `json:"images,omitempty"`
+}
+
+type jsonPublicationMetadata struct {
+	Type        string        `json:"@type"`
+	Identifier  string        `json:"identifier"`
+	Title       string        `json:"title"`
+	Author      []jsonContrib `json:"author,omitempty"`
+	Published   string        `json:"published,omitempty"`
+	Modified    string        `json:"modified,omitempty"`
+	Description string        `json:"description,omitempty"`
+	Subject     []jsonContrib `json:"subject,omitempty"`
+}
+
+type jsonContrib struct {
+	Name string `json:"name"`
+}
+
+// WriteJSON writes the feed as an OPDS 2.0 JSON document.
+func (f *Feed) WriteJSON(w io.Writer) error {
+	feed := jsonFeed{
+		Metadata: jsonFeedMetadata{
+			Title:         f.Title,
+			Modified:      formatTime(f.updated()),
+			NumberOfItems: f.Total,
+			ItemsPerPage:  f.PerPage,
+			CurrentPage:   f.Page,
+		},
+		Links: []jsonLink{},
+	}
+
+	for _, l := range f.Links {
+		feed.Links = append(feed.Links, jsonLinkFor(l))
+	}
+
+	// a feed has to have its collection even when it is empty
+	navigation := []jsonLink{}
+	publications := []jsonPublication{}
+	if f.Kind == Navigation || len(f.Navigation) > 0 {
+		feed.Navigation = &navigation
+	}
+	if f.Kind == Acquisition || len(f.Publications) > 0 {
+		feed.Publications = &publications
+	}
+
+	for _, n := range f.Navigation {
+		link := jsonLink{Rel: n.Rel, Href: n.Href, Type: JSONType, Title: n.Title}
+		if n.Count > 0 {
+			link.Properties = &jsonProperties{NumberOfItems: n.Count}
+		}
+		navigation = append(navigation, link)
+	}
+
+	for _, p := range f.Publications {
+		pub := jsonPublication{
+			Metadata: jsonPublicationMetadata{
+				Type:        "http://schema.org/Book",
+				Identifier:  p.ID,
+				Title:       p.Title,
+				Description: p.Description,
+			},
+			Links: []jsonLink{},
+		}
+
+		if !p.Updated.IsZero() {
+			pub.Metadata.Modified = formatTime(p.Updated)
+		}
+		if p.Published > 0 {
+			pub.Metadata.Published = strconv.Itoa(p.Published)
+		}
+		for _, name := range p.Authors {
+			pub.Metadata.Author = append(pub.Metadata.Author, jsonContrib{Name: name})
+		}
+		for _, s := range p.Subjects {
+			pub.Metadata.Subject = append(pub.Metadata.Subject, jsonContrib{Name: s})
+		}
+		for _, l := range p.Links {
+			pub.Links = append(pub.Links, jsonLinkFor(l))
+		}
+		for _, l := range p.Images {
+			pub.Images = append(pub.Images, jsonLinkFor(l))
+		}
+
+		publications = append(publications, pub)
+	}
+
+	return json.NewEncoder(w).Encode(feed)
+}
+
+func jsonLinkFor(l Link) jsonLink {
+	link := jsonLink{Rel: l.Rel, Href: l.Href, Type: l.Type, Title: l.Title, Templated: l.Templated, Width: l.Width, Height: l.Height}
+	if link.Type == "" && l.Kind != "" {
+		link.Type = JSONType
+	}
+	return link
+}
@@ -0,0 +1,115 @@
+// Package opds renders catalog feeds for e-reader apps, as OPDS 1.2 Atom or
+// OPDS 2.0 JSON. A Feed is built once and can be written in either version.
+package opds
+
+import (
+	"time"
+)
+
+// Media types of the documents in a catalog.
+const (
+	NavigationType  = "application/atom+xml;profile=opds-catalog;kind=navigation"
+	AcquisitionType = "application/atom+xml;profile=opds-catalog;kind=acquisition"
+	JSONType        = "application/opds+json"
+	OpenSearchType  = "application/opensearchdescription+xml"
+)
+
+// Kinds of feed. A navigation feed links to other feeds; an acquisition feed
+// lists publications.
+const (
+	Navigation  = "navigation"
+	Acquisition = "acquisition"
+)
+
+// Link relations used by catalogs, besides the registered ones such as self,
+// start, next and search.
+const (
+	RelImage     = "http://opds-spec.org/image"
+	RelThumbnail = "http://opds-spec.org/image/thumbnail"
+	RelSortNew   = "http://opds-spec.org/sort/new"
+)
+
+// Link points from a feed or publication to another resource. A link to
+// another feed of the same catalog leaves Type empty and sets Kind instead,
+// and is given the media type of whichever version the feed is written in.
+type Link struct {
+	Rel   string
+	Href  string
+	Type  string
+	Title string
+	Kind  string
+
+	// Templated marks an href holding an OpenSearch template, which OPDS 2.0
+	// writes as a URI template.
+	Templated bool
+
+	// Width and Height describe an image.
+	Width  int
+	Height int
+}
+
+// NavigationEntry is a link to another feed, with the number of
+// publications in it when that is known.
+type NavigationEntry struct {
+	ID      string
+	Title   string
+	Href    string
+	Kind    string
+	Rel     string
+	Count   int
+	Updated time.Time
+}
+
+// Publication is one book in an acquisition feed.
+type Publication struct {
+	ID          string
+	Title       string
+	Authors     []string
+	Description string
+	Published   int
+	Subjects    []string
+	Updated     time.Time
+	Links       []Link
+	Images      []Link
+}
+
+// Feed is a page of a catalog. Total, PerPage and Page describe where the
+// page sits in a longer listing, and are left at zero otherwise.
+type Feed struct {
+	ID           string
+	Title        string
+	Kind         string
+	Updated      time.Time
+	Links        []Link
+	Navigation   []NavigationEntry
+	Publications []Publication
+
+	Total   int
+	PerPage int
+	Page    int
+}
+
+// updated is the time the feed last changed: its own Updated if set, or the
+// latest of its entries.
+func (f *Feed) updated() time.Time {
+	latest := f.Updated
+	for _, n := range f.Navigation {
+		if n.Updated.After(latest) {
+			latest = n.Updated
+		}
+	}
+	for _, p := range f.Publications {
+		if p.Updated.After(latest) {
+			latest = p.Updated
+		}
+	}
+
+	if latest.IsZero() {
+		return time.Now()
+	}
+	return latest
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
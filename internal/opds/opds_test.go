@@ -0,0 +1,221 @@
+package opds
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testFeed() *Feed {
+	return &Feed{
+		ID:    "urn:literal:books",
+		Title: "All books",
+		Kind:  Acquisition,
+		Links: []Link{
+			{Rel: "self", Href: "http://example.com/opds/books", Kind: Acquisition},
+			{Rel: "search", Href: "http://example.com/opds/opensearch.xml", Type: OpenSearchType},
+			{Rel: "next", Href: "http://example.com/opds/books?page=2", Kind: Acquisition},
+		},
+		Publications: []Publication{
+			{
+				ID:          "urn:literal:book:1",
+				Title:       "Dune & Sons",
+				Authors:     []string{"Frank Herbert"},
+				Description: "Spice <must> flow",
+				Published:   1965,
+				Subjects:    []string{"Science Fiction"},
+				Updated:     time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC),
+				Links:       []Link{{Rel: "alternate", Href: "http://example.com/books/dune", Type: "text/html"}},
+				Images:      []Link{{Rel: RelThumbnail, Href: "http://example.com/static/covers/1-medium.jpg", Type: "image/jpeg", Width: 300, Height: 450}},
+			},
+		},
+		Total:   21,
+		PerPage: 10,
+		Page:    2,
+	}
+}
+
+func TestFeed_WriteAtom(t *testing.T) {
+	var buf bytes.Buffer
+	err := testFeed().WriteAtom(&buf, "Literal")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc struct {
+		XMLName xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+		Updated string   `xml:"updated"`
+		Start   int      `xml:"http://a9.com/-/spec/opensearch/1.1/ startIndex"`
+		Links   []struct {
+			Rel  string `xml:"rel,attr"`
+			Type string `xml:"type,attr"`
+		} `xml:"link"`
+		Entries []struct {
+			Title   string `xml:"title"`
+			Issued  string `xml:"http://purl.org/dc/terms/ issued"`
+			Summary string `xml:"summary"`
+			Links   []struct {
+				Rel string `xml:"rel,attr"`
+			} `xml:"link"`
+		} `xml:"entry"`
+	}
+	err = xml.Unmarshal(buf.Bytes(), &doc)
+	if err != nil {
+		t.Fatalf("feed is not valid XML: %s\n%s", err, buf.String())
+	}
+
+	if doc.Updated != "2022-03-04T05:06:07Z" {
+		t.Errorf("expected the feed to be updated with its latest entry, got %q", doc.Updated)
+	}
+	if doc.Start != 11 {
+		t.Errorf("expected start index 11, got %d", doc.Start)
+	}
+	if len(doc.Links) != 3 || doc.Links[0].Type != AcquisitionType || doc.Links[1].Type != OpenSearchType {
+		t.Errorf("unexpected feed links %+v", doc.Links)
+	}
+	if len(doc.Entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(doc.Entries))
+	}
+
+	entry := doc.Entries[0]
+	if entry.Title != "Dune & Sons" || entry.Summary != "Spice <must> flow" || entry.Issued != "1965" {
+		t.Errorf("unexpected entry %+v", entry)
+	}
+	if len(entry.Links) != 2 || entry.Links[1].Rel != RelThumbnail {
+		t.Errorf("expected the alternate and thumbnail links, got %+v", entry.Links)
+	}
+}
+
+func TestFeed_WriteAtomNavigation(t *testing.T) {
+	feed := &Feed{
+		ID:    "urn:literal:genres",
+		Title: "By genre",
+		Kind:  Navigation,
+		Navigation: []NavigationEntry{
+			{ID: "urn:literal:genre:3", Title: "Romance", Href: "http://example.com/opds/genres/3", Kind: Acquisition, Count: 1},
+		},
+	}
+
+	var buf bytes.Buffer
+	err := feed.WriteAtom(&buf, "Literal")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		`<link rel="subsection" href="http://example.com/opds/genres/3" type="` + xmlEscape(AcquisitionType) + `" thr:count="1">`,
+		`<content type="text">1 book</content>`,
+		`xmlns:thr="http://purl.org/syndication/thread/1.0"`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected feed to contain %s, got %s", want, buf.String())
+		}
+	}
+	if strings.Contains(buf.String(), "opensearch:totalResults") {
+		t.Error("expected an unpaged feed to leave out the OpenSearch counts")
+	}
+}
+
+func TestFeed_WriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+	err := testFeed().WriteJSON(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc struct {
+		Metadata struct {
+			NumberOfItems int `json:"numberOfItems"`
+			CurrentPage   int `json:"currentPage"`
+		} `json:"metadata"`
+		Links []struct {
+			Rel  string `json:"rel"`
+			Type string `json:"type"`
+		} `json:"links"`
+		Navigation   *[]interface{} `json:"navigation"`
+		Publications []struct {
+			Metadata struct {
+				Type      string `json:"@type"`
+				Title     string `json:"title"`
+				Published string `json:"published"`
+				Author    []struct {
+					Name string `json:"name"`
+				} `json:"author"`
+			} `json:"metadata"`
+			Images []struct {
+				Width int `json:"width"`
+			} `json:"images"`
+		} `json:"publications"`
+	}
+	err = json.Unmarshal(buf.Bytes(), &doc)
+	if err != nil {
+		t.Fatalf("feed is not valid JSON: %s\n%s", err, buf.String())
+	}
+
+	if doc.Metadata.NumberOfItems != 21 || doc.Metadata.CurrentPage != 2 {
+		t.Errorf("unexpected metadata %+v", doc.Metadata)
+	}
+	if len(doc.Links) != 3 || doc.Links[0].Type != JSONType || doc.Links[1].Type != OpenSearchType {
+		t.Errorf("unexpected feed links %+v", doc.Links)
+	}
+	if doc.Navigation != nil {
+		t.Error("expected an acquisition feed to have no navigation")
+	}
+	if len(doc.Publications) != 1 {
+		t.Fatalf("expected 1 publication, got %d", len(doc.Publications))
+	}
+
+	pub := doc.Publications[0]
+	if pub.Metadata.Type != "http://schema.org/Book" || pub.Metadata.Published != "1965" || len(pub.Metadata.Author) != 1 {
+		t.Errorf("unexpected publication metadata %+v", pub.Metadata)
+	}
+	if len(pub.Images) != 1 || pub.Images[0].Width != 300 {
+		t.Errorf("unexpected images %+v", pub.Images)
+	}
+}
+
+func TestFeed_WriteJSONEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	err := (&Feed{ID: "urn:literal:new", Title: "New books", Kind: Acquisition}).WriteJSON(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(buf.String(), `"publications":[]`) {
+		t.Errorf("expected an empty publications collection, got %s", buf.String())
+	}
+}
+
+func TestWriteOpenSearch(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteOpenSearch(&buf, "Literal", "Search Literal", "http://example.com/opds/search?q={searchTerms}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc struct {
+		XMLName   xml.Name `xml:"http://a9.com/-/spec/opensearch/1.1/ OpenSearchDescription"`
+		ShortName string   `xml:"ShortName"`
+		URL       struct {
+			Type     string `xml:"type,attr"`
+			Template string `xml:"template,attr"`
+		} `xml:"Url"`
+	}
+	err = xml.Unmarshal(buf.Bytes(), &doc)
+	if err != nil {
+		t.Fatalf("description is not valid XML: %s\n%s", err, buf.String())
+	}
+
+	if doc.ShortName != "Literal" || doc.URL.Type != AcquisitionType || doc.URL.Template != "http://example.com/opds/search?q={searchTerms}" {
+		t.Errorf("unexpected description %+v", doc)
+	}
+}
+
+func xmlEscape(s string) string {
+	var buf bytes.Buffer
+	_ = xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
@@ -0,0 +1,47 @@
+package opds
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+type openSearchDescription struct {
+	XMLName     xml.Name `xml:"OpenSearchDescription"`
+	Xmlns       string   `xml:"xmlns,attr"`
+	ShortName   string   `xml:"ShortName"`
+	Description string   `xml:"Description"`
+	InputEnc    string   `xml:"InputEncoding"`
+	OutputEnc   string   `xml:"OutputEncoding"`
+	URL         struct {
+		Type     string `xml:"type,attr"`
+		Template string `xml:"template,attr"`
+	} `xml:"Url"`
+}
+
+// WriteOpenSearch writes the OpenSearch description that OPDS 1.2 catalogs
+// link to for search. template is the search URL, with {searchTerms} where
+// the query goes.
+func WriteOpenSearch(w io.Writer, shortName, description, template string) error {
+	doc := openSearchDescription{
+		Xmlns:       "http://a9.com/-/spec/opensearch/1.1/",
+		ShortName:   shortName,
+		Description: description,
+		InputEnc:    "UTF-8",
+		OutputEnc:   "UTF-8",
+	}
+	doc.URL.Type = AcquisitionType
+	doc.URL.Template = template
+
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	err = enc.Encode(doc)
+	if err != nil {
+		return err
+	}
+
+	return enc.Flush()
+}
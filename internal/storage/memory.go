@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// Memory keeps covers in a map. It is meant for tests and for trying the API
+// out without anywhere to put files; everything is lost on restart.
+type Memory struct {
+	mu      sync.RWMutex
+	objects map[string]memoryObject
+}
+
+type memoryObject struct {
+	data        []byte
+	contentType string
+	modTime     time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{objects: make(map[string]memoryObject)}
+}
+
+func (s *Memory) Put(ctx context.Context, key, contentType string, r io.Reader, size int64) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	if contentType == "" {
+		contentType = contentTypeFor(key)
+	}
+
+	s.mu.Lock()
+	s.objects[key] = memoryObject{data: b, contentType: contentType, modTime: time.Now()}
+	s.mu.Unlock()
+
+	return nil
+}
+
+func (s *Memory) Get(ctx context.Context, key string) (*Object, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	obj, ok := s.objects[key]
+	s.mu.RUnlock()
+
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &Object{
+		ReadCloser:  io.NopCloser(bytes.NewReader(obj.data)),
+		ContentType: obj.contentType,
+		Size:        int64(len(obj.data)),
+		ModTime:     obj.modTime,
+	}, nil
+}
+
+func (s *Memory) Delete(ctx context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	delete(s.objects, key)
+	s.mu.Unlock()
+
+	return nil
+}
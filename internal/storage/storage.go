@@ -0,0 +1,57 @@
+// Package storage keeps book cover images somewhere other than the API
+// server's own disk when it needs to: in memory for tests, or in an
+// S3-compatible bucket when several instances serve the same catalog.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"path"
+	"time"
+)
+
+var (
+	ErrNotFound   = errors.New("cover not found")
+	ErrInvalidKey = errors.New("invalid cover key")
+)
+
+// CoverStore holds cover images under slash-separated keys such as
+// "my-book.jpg".
+type CoverStore interface {
+	// Put stores r under key, replacing anything already there. size is the
+	// length of r, or -1 if it is not known in advance.
+	Put(ctx context.Context, key, contentType string, r io.Reader, size int64) error
+
+	// Get opens the object stored under key. The caller must close it.
+	Get(ctx context.Context, key string) (*Object, error)
+
+	// Delete removes key. Deleting a key that does not exist is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// Object is an open cover image.
+type Object struct {
+	io.ReadCloser
+	ContentType string
+	Size        int64
+	ModTime     time.Time
+}
+
+// checkKey rejects keys that could escape the store's root, such as ones
+// containing "..".
+func checkKey(key string) error {
+	if !fs.ValidPath(key) || key == "." {
+		return ErrInvalidKey
+	}
+	return nil
+}
+
+func contentTypeFor(key string) string {
+	if t := mime.TypeByExtension(path.Ext(key)); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"literal/internal/data"
+)
+
+// audit records a change made through the admin API by the signed-in user.
+// before and after are snapshots of the target; either may be nil. It runs
+// once the change has been made, so failing to record it is logged rather
+// than reported to the client.
+func (app *application) audit(r *http.Request, action, targetType string, targetID int, before, after interface{}) {
+	e := data.AuditEvent{
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		IPAddress:  clientIP(r),
+		Before:     snapshot(before),
+		After:      snapshot(after),
+	}
+
+	if actor := app.contextGetUser(r); actor != nil {
+		e.ActorID = actor.ID
+		e.ActorEmail = actor.Email
+	}
+
+	// the change is already committed, so don't lose the record because the
+	// client went away
+	err := app.models.Audit.Insert(context.Background(), e)
+	if err != nil {
+		app.errorLog.Printf("recording audit event %s on %s %d: %v", action, targetType, targetID, err)
+	}
+}
+
+func snapshot(v interface{}) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil || string(b) == "null" {
+		return nil
+	}
+
+	return b
+}
+
+// userSnapshot is what the audit log keeps of a user: never the password hash
+// or a session token.
+func userSnapshot(u *data.User) interface{} {
+	if u == nil {
+		return nil
+	}
+
+	return envelope{
+		"id":         u.ID,
+		"email":      u.Email,
+		"first_name": u.FirstName,
+		"last_name":  u.LastName,
+		"active":     u.Active,
+		"role":       u.Role,
+	}
+}
+
+// AuditLog lists recorded admin actions, newest first. It takes the usual
+// page and page_size parameters and filters on actor_id, action, target_type,
+// target_id, and since/until as RFC 3339 times.
+func (app *application) AuditLog(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	var filter data.AuditFilter
+	var err error
+
+	for _, param := range []struct {
+		key string
+		dst *int
+	}{
+		{"actor_id", &filter.ActorID},
+		{"target_id", &filter.TargetID},
+	} {
+		*param.dst, err = app.readInt(qs, param.key, 0)
+		if err != nil {
+			app.errorJSON(w, err)
+			return
+		}
+	}
+
+	for _, param := range []struct {
+		key string
+		dst *time.Time
+	}{
+		{"since", &filter.Since},
+		{"until", &filter.Until},
+	} {
+		if v := qs.Get(param.key); v != "" {
+			*param.dst, err = time.Parse(time.RFC3339, v)
+			if err != nil {
+				app.errorJSON(w, fmt.Errorf("%s must be an RFC 3339 time", param.key))
+				return
+			}
+		}
+	}
+
+	filter.Action = qs.Get("action")
+	filter.TargetType = qs.Get("target_type")
+
+	filter.Page, filter.PageSize, err = app.readPage(qs)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	events, total, err := app.models.Audit.List(r.Context(), filter)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	meta := calculateMetadata(total, filter.Page, filter.PageSize)
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "success",
+		Data:    envelope{"events": events, "metadata": meta},
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, payload, paginationLinks(r, meta))
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"literal/internal/data"
+)
+
+func TestApplication_AuditLog(t *testing.T) {
+	var tests = []struct {
+		name         string
+		query        string
+		expectedCode int
+		expected     data.AuditFilter
+	}{
+		{"defaults", "", http.StatusOK, data.AuditFilter{Page: 1, PageSize: defaultPageSize}},
+		{"filtered", "?actor_id=5&action=book.delete&target_type=book&target_id=9&since=2026-01-02T03:04:05Z&page=2&page_size=10", http.StatusOK,
+			data.AuditFilter{ActorID: 5, Action: "book.delete", TargetType: "book", TargetID: 9,
+				Since: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC), Page: 2, PageSize: 10}},
+		{"bad actor", "?actor_id=me", http.StatusBadRequest, data.AuditFilter{}},
+		{"bad time", "?until=yesterday", http.StatusBadRequest, data.AuditFilter{}},
+	}
+
+	for _, e := range tests {
+		events := []data.AuditEvent{{ID: 1, Action: "book.delete", TargetType: "book", TargetID: 9}}
+		var filter data.AuditFilter
+
+		app := testApp
+		app.models.Audit = stubAuditRepository{events: &events, filter: &filter}
+
+		req, _ := http.NewRequest("GET", "/admin/audit"+e.query, nil)
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(app.AuditLog)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected status %d, got %d", e.name, e.expectedCode, rr.Code)
+			continue
+		}
+
+		if rr.Code != http.StatusOK {
+			continue
+		}
+
+		if filter != e.expected {
+			t.Errorf("%s: expected filter %+v, got %+v", e.name, e.expected, filter)
+		}
+
+		if !strings.Contains(rr.Body.String(), `"book.delete"`) {
+			t.Errorf("%s: event missing from response: %s", e.name, rr.Body.String())
+		}
+	}
+}
+
+func Test_userSnapshot(t *testing.T) {
+	u := &data.User{ID: 1, Email: "me@here.com", Password: "$2a$12$hash", Token: data.Token{Token: "secret"}}
+
+	b := string(snapshot(userSnapshot(u)))
+	if strings.Contains(b, "hash") || strings.Contains(b, "secret") {
+		t.Error("user snapshot leaks credentials:", b)
+	}
+
+	if snapshot(userSnapshot(nil)) != nil {
+		t.Error("expected no snapshot for a nil user")
+	}
+}
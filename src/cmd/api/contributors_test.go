@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"literal/internal/data"
+)
+
+var contributorBooks = []*data.Book{
+	{ID: 1, Title: "Good Omens", Slug: "good-omens", AuthorID: 1, Authors: []data.Contributor{
+		{AuthorID: 1, AuthorName: "Terry Pratchett", Role: data.ContributorAuthor},
+		{AuthorID: 2, AuthorName: "Neil Gaiman", Role: data.ContributorAuthor},
+		{AuthorID: 3, AuthorName: "Paul Kidby", Role: data.ContributorIllustrator},
+	}},
+}
+
+func TestApplication_EditBook_contributors(t *testing.T) {
+	var tests = []struct {
+		name             string
+		body             string
+		expectedCode     int
+		expectedBody     string
+		expectedAuthorID int
+		expectedAuthors  []data.Contributor
+	}{
+		{"new book with contributors",
+			`{"title": "Odyssey", "authors": [{"author_id": 4, "role": "translator"}, {"author_id": 5, "role": "author"}]}`,
+			http.StatusAccepted, "", 5,
+			[]data.Contributor{{AuthorID: 4, Role: "translator"}, {AuthorID: 5, Role: "author"}}},
+		{"new book with author_id only", `{"title": "Emma", "author_id": 6}`, http.StatusAccepted, "", 6, nil},
+		{"anthology of an editor",
+			`{"title": "Dangerous Visions", "authors": [{"author_id": 7, "role": "editor"}]}`,
+			http.StatusAccepted, "", 7,
+			[]data.Contributor{{AuthorID: 7, Role: "editor"}}},
+		{"same author in two roles",
+			`{"title": "Odyssey", "authors": [{"author_id": 4, "role": "author"}, {"author_id": 4, "role": "illustrator"}]}`,
+			http.StatusAccepted, "", 4,
+			[]data.Contributor{{AuthorID: 4, Role: "author"}, {AuthorID: 4, Role: "illustrator"}}},
+		{"unknown role", `{"title": "Odyssey", "authors": [{"author_id": 4, "role": "narrator"}]}`,
+			http.StatusBadRequest, "authors[0]: role must be", 0, nil},
+		{"missing author", `{"title": "Odyssey", "authors": [{"role": "author"}]}`,
+			http.StatusBadRequest, "author_id is required", 0, nil},
+		{"credited twice", `{"title": "Odyssey", "authors": [{"author_id": 4, "role": "author"}, {"author_id": 4, "role": "author"}]}`,
+			http.StatusBadRequest, "already credited as author", 0, nil},
+		{"empty list", `{"title": "Odyssey", "authors": []}`, http.StatusBadRequest, "at least one contributor", 0, nil},
+		{"old client keeps co-authors", `{"id": 1, "title": "Good Omens", "author_id": 1}`, http.StatusAccepted, "", 1,
+			[]data.Contributor{{AuthorID: 1, Role: "author"}, contributorBooks[0].Authors[1], contributorBooks[0].Authors[2]}},
+		{"old client changes first author", `{"id": 1, "title": "Good Omens", "author_id": 2}`, http.StatusAccepted, "", 2,
+			[]data.Contributor{{AuthorID: 2, Role: "author"}, contributorBooks[0].Authors[2]}},
+		{"old client adds first author", `{"id": 1, "title": "Good Omens", "author_id": 8}`, http.StatusAccepted, "", 8,
+			[]data.Contributor{{AuthorID: 8, Role: "author"}, contributorBooks[0].Authors[1], contributorBooks[0].Authors[2]}},
+	}
+
+	for _, e := range tests {
+		var saved data.Book
+		var events []data.AuditEvent
+
+		app := testApp
+		app.models.Book = stubISBNBookRepository{stubBookRepository: stubBookRepository{books: contributorBooks}, saved: &saved}
+		app.models.Audit = stubAuditRepository{events: &events}
+
+		req, _ := http.NewRequest("POST", "/admin/books/save", strings.NewReader(e.body))
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(app.EditBook)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected status %d, got %d: %s", e.name, e.expectedCode, rr.Code, rr.Body.String())
+			continue
+		}
+
+		if !strings.Contains(rr.Body.String(), e.expectedBody) {
+			t.Errorf("%s: expected body to contain %s, got %s", e.name, e.expectedBody, rr.Body.String())
+		}
+
+		if rr.Code != http.StatusAccepted {
+			if saved.Title != "" {
+				t.Errorf("%s: expected the book not to be saved", e.name)
+			}
+			continue
+		}
+
+		if saved.AuthorID != e.expectedAuthorID {
+			t.Errorf("%s: expected author_id %d, got %d", e.name, e.expectedAuthorID, saved.AuthorID)
+		}
+		if !reflect.DeepEqual(saved.Authors, e.expectedAuthors) {
+			t.Errorf("%s: expected authors %v, got %v", e.name, e.expectedAuthors, saved.Authors)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"literal/internal/data"
+	"literal/internal/imaging"
+	"literal/internal/storage"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// coverStoreFromEnv picks where covers are kept from COVER_STORE: "fs" (the
+// default, under COVER_DIR), "memory", or "s3", configured by the S3_*
+// variables.
+func coverStoreFromEnv() (storage.CoverStore, error) {
+	switch kind := os.Getenv("COVER_STORE"); kind {
+	case "", "fs":
+		dir := os.Getenv("COVER_DIR")
+		if dir == "" {
+			dir = "./static/covers"
+		}
+		return storage.Filesystem{Dir: dir}, nil
+	case "memory":
+		return storage.NewMemory(), nil
+	case "s3":
+		s := storage.S3{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Region:    os.Getenv("S3_REGION"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+			PathStyle: os.Getenv("S3_PATH_STYLE") == "true",
+		}
+		if s.Endpoint == "" || s.Bucket == "" {
+			return nil, errors.New("COVER_STORE=s3 needs S3_ENDPOINT and S3_BUCKET")
+		}
+		if s.Region == "" {
+			s.Region = "us-east-1"
+		}
+		return s, nil
+	default:
+		return nil, fmt.Errorf("unknown COVER_STORE %q", kind)
+	}
+}
+
+// coverKey is where a book's full-size cover is stored, and its path under
+// /static/covers. Thumbnails sit next to it with the size name appended.
+func coverKey(slug string) string {
+	return slug + ".jpg"
+}
+
+func renditionKey(slug, name string) string {
+	if name == "original" {
+		return coverKey(slug)
+	}
+	return slug + "-" + name + ".jpg"
+}
+
+// storeCover saves every rendition of a processed cover and records them on
+// the book. Renditions of the previous cover that the new one doesn't
+// replace, such as a thumbnail size the new image is too small for, are
+// removed.
+func (app *application) storeCover(ctx context.Context, bookID int, slug string, previous data.CoverRenditions, cover *imaging.Result) (data.CoverRenditions, error) {
+	var stored data.CoverRenditions
+	keep := make(map[string]bool)
+
+	for _, r := range cover.Renditions {
+		key := renditionKey(slug, r.Name)
+
+		err := app.covers.Put(ctx, key, "image/jpeg", bytes.NewReader(r.Data), int64(len(r.Data)))
+		if err != nil {
+			return nil, err
+		}
+
+		keep[key] = true
+		stored = append(stored, data.CoverRendition{Name: r.Name, Key: key, Width: r.Width, Height: r.Height})
+	}
+
+	err := app.models.Book.SetCovers(ctx, bookID, stored)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range previous {
+		if !keep[r.Key] {
+			app.deleteCoverFile(ctx, r.Key)
+		}
+	}
+
+	return stored, nil
+}
+
+// deleteCovers removes every stored rendition of a book's cover.
+func (app *application) deleteCovers(ctx context.Context, slug string, covers data.CoverRenditions) {
+	// covers saved before renditions were tracked are only under coverKey
+	app.deleteCoverFile(ctx, coverKey(slug))
+	for _, r := range covers {
+		if r.Key != coverKey(slug) {
+			app.deleteCoverFile(ctx, r.Key)
+		}
+	}
+}
+
+// deleteCoverFile is best effort: a file left behind only wastes space.
+func (app *application) deleteCoverFile(ctx context.Context, key string) {
+	err := app.covers.Delete(ctx, key)
+	if err != nil {
+		app.errorLog.Printf("deleting cover %s: %v", key, err)
+	}
+}
+
+// coverError reports why an uploaded cover was rejected.
+func (app *application) coverError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, imaging.ErrTooLarge), errors.As(err, new(*http.MaxBytesError)):
+		app.errorJSON(w, err, http.StatusRequestEntityTooLarge)
+	case errors.Is(err, imaging.ErrUnsupportedFormat):
+		app.errorJSON(w, err, http.StatusUnsupportedMediaType)
+	case errors.Is(err, imaging.ErrDimensions), errors.Is(err, imaging.ErrCorrupt):
+		app.errorJSON(w, err, http.StatusUnprocessableEntity)
+	default:
+		app.errorJSON(w, err)
+	}
+}
+
+// ServeCover streams a cover image from the cover store.
+func (app *application) ServeCover(w http.ResponseWriter, r *http.Request) {
+	obj, err := app.covers.Get(r.Context(), chi.URLParam(r, "*"))
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidKey) {
+			http.NotFound(w, r)
+			return
+		}
+		app.errorLog.Println(err)
+		http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		return
+	}
+	defer obj.Close()
+
+	if !obj.ModTime.IsZero() {
+		if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !obj.ModTime.Truncate(time.Second).After(since) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Last-Modified", obj.ModTime.UTC().Format(http.TimeFormat))
+	}
+
+	w.Header().Set("Content-Type", obj.ContentType)
+	if obj.Size >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(obj.Size, 10))
+	}
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	_, err = io.Copy(w, obj)
+	if err != nil {
+		app.errorLog.Println("serving cover:", err)
+	}
+}
+
+// UploadCover replaces a book's cover with the image in the request, sent
+// either as the "cover" field of a multipart form or as the raw body. The
+// image goes straight from the request to the processor, so it isn't held
+// to readJSON's limit or inflated by base64.
+func (app *application) UploadCover(w http.ResponseWriter, r *http.Request) {
+	book, ok := app.bookForCover(w, r)
+	if !ok {
+		return
+	}
+
+	// leave room for multipart headers; Process enforces the image's own limit
+	r.Body = http.MaxBytesReader(w, r.Body, app.config.coverLimits.MaxBytes+1<<20)
+
+	var src io.Reader = r.Body
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+		part, err := coverPart(r)
+		if err != nil {
+			app.coverError(w, err)
+			return
+		}
+		defer part.Close()
+		src = part
+	}
+
+	cover, err := imaging.Process(src, app.config.coverLimits, imaging.DefaultSizes)
+	if err != nil {
+		app.coverError(w, err)
+		return
+	}
+
+	covers, err := app.storeCover(r.Context(), book.ID, book.Slug, book.Covers, cover)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	app.audit(r, "book.cover_update", "book", book.ID, envelope{"covers": book.Covers}, envelope{"covers": covers})
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Cover saved",
+		Data:    envelope{"id": book.ID, "covers": covers},
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, payload)
+}
+
+// DeleteCover removes every rendition of a book's cover.
+func (app *application) DeleteCover(w http.ResponseWriter, r *http.Request) {
+	book, ok := app.bookForCover(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.models.Book.SetCovers(r.Context(), book.ID, nil)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	app.deleteCovers(r.Context(), book.Slug, book.Covers)
+	app.audit(r, "book.cover_delete", "book", book.ID, envelope{"covers": book.Covers}, nil)
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Cover deleted",
+	}
+
+	_ = app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+// bookForCover loads the book named by the id in the URL, answering the
+// request itself when there isn't one.
+func (app *application) bookForCover(w http.ResponseWriter, r *http.Request) (*data.Book, bool) {
+	bookID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, err)
+		return nil, false
+	}
+
+	book, err := app.models.Book.GetBookById(r.Context(), bookID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.errorJSON(w, errors.New("book not found"), http.StatusNotFound)
+			return nil, false
+		}
+		app.errorJSON(w, err)
+		return nil, false
+	}
+
+	return book, true
+}
+
+// coverPart returns the "cover" field of a multipart request, skipping any
+// other fields before it.
+func coverPart(r *http.Request) (*multipart.Part, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil, errors.New("the form has no cover field")
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if part.FormName() == "cover" {
+			return part, nil
+		}
+		part.Close()
+	}
+}
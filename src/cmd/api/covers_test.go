@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"image"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"literal/internal/data"
+	"literal/internal/storage"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestApplication_ServeCover(t *testing.T) {
+	store := storage.NewMemory()
+	_ = store.Put(context.Background(), "my-book.jpg", "image/jpeg", strings.NewReader("jpeg bytes"), -1)
+
+	app := testApp
+	app.covers = store
+	routes := app.routes()
+
+	var tests = []struct {
+		name         string
+		path         string
+		since        time.Time
+		expectedCode int
+		expectedBody string
+	}{
+		{"stored cover", "/static/covers/my-book.jpg", time.Time{}, http.StatusOK, "jpeg bytes"},
+		{"missing cover", "/static/covers/other-book.jpg", time.Time{}, http.StatusNotFound, ""},
+		{"escaping the store", "/static/covers/../secret.jpg", time.Time{}, http.StatusNotFound, ""},
+		{"not modified", "/static/covers/my-book.jpg", time.Now().Add(time.Hour), http.StatusNotModified, ""},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", e.path, nil)
+		if !e.since.IsZero() {
+			req.Header.Set("If-Modified-Since", e.since.UTC().Format(http.TimeFormat))
+		}
+
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected status %d, got %d", e.name, e.expectedCode, rr.Code)
+		}
+
+		if e.expectedBody != "" && rr.Body.String() != e.expectedBody {
+			t.Errorf("%s: expected body %q, got %q", e.name, e.expectedBody, rr.Body.String())
+		}
+	}
+}
+
+type stubCoverBookRepository struct {
+	stubBookRepository
+	covers map[int]data.CoverRenditions
+}
+
+func (s stubCoverBookRepository) SetCovers(ctx context.Context, id int, covers data.CoverRenditions) error {
+	s.covers[id] = covers
+	return nil
+}
+
+func (s stubCoverBookRepository) GetBookById(ctx context.Context, id int) (*data.Book, error) {
+	for _, b := range s.books {
+		if b.ID == id {
+			return b, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func TestApplication_EditBook_cover(t *testing.T) {
+	var cover bytes.Buffer
+	_ = png.Encode(&cover, image.NewNRGBA(image.Rect(0, 0, 400, 600)))
+
+	var tests = []struct {
+		name         string
+		cover        []byte
+		expectedCode int
+		expectedKeys []string
+	}{
+		{"png cover", cover.Bytes(), http.StatusAccepted, []string{"my-book.jpg", "my-book-medium.jpg", "my-book-small.jpg"}},
+		{"not an image", []byte("jpeg bytes"), http.StatusUnsupportedMediaType, nil},
+	}
+
+	for _, e := range tests {
+		var events []data.AuditEvent
+		covers := map[int]data.CoverRenditions{}
+
+		app := testApp
+		app.covers = storage.NewMemory()
+		app.models.Book = stubCoverBookRepository{covers: covers}
+		app.models.Audit = stubAuditRepository{events: &events}
+
+		body := `{"title": "My Book", "author_id": 1, "cover": "` + base64.StdEncoding.EncodeToString(e.cover) + `"}`
+		req, _ := http.NewRequest("POST", "/admin/books/save", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(app.EditBook)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected status %d, got %d: %s", e.name, e.expectedCode, rr.Code, rr.Body.String())
+			continue
+		}
+
+		if e.expectedKeys == nil {
+			if len(events) != 0 || len(covers) != 0 {
+				t.Errorf("%s: expected the book not to be saved", e.name)
+			}
+			continue
+		}
+
+		if len(covers[42]) != len(e.expectedKeys) {
+			t.Errorf("%s: expected renditions %v, got %+v", e.name, e.expectedKeys, covers[42])
+			continue
+		}
+
+		for i, key := range e.expectedKeys {
+			if covers[42][i].Key != key {
+				t.Errorf("%s: expected rendition %d to be %s, got %s", e.name, i, key, covers[42][i].Key)
+			}
+
+			obj, err := app.covers.Get(context.Background(), key)
+			if err != nil {
+				t.Errorf("%s: %s was not stored: %v", e.name, key, err)
+				continue
+			}
+			b, _ := io.ReadAll(obj)
+			obj.Close()
+
+			if _, format, err := image.DecodeConfig(bytes.NewReader(b)); err != nil || format != "jpeg" {
+				t.Errorf("%s: %s is not a JPEG: %v", e.name, key, err)
+			}
+		}
+	}
+}
+
+func TestApplication_UploadCover(t *testing.T) {
+	var cover bytes.Buffer
+	_ = png.Encode(&cover, image.NewNRGBA(image.Rect(0, 0, 400, 600)))
+
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	_ = mw.WriteField("note", "scanned")
+	fw, _ := mw.CreateFormFile("cover", "cover.png")
+	_, _ = fw.Write(cover.Bytes())
+	_ = mw.Close()
+
+	var tests = []struct {
+		name         string
+		path         string
+		contentType  string
+		body         []byte
+		maxBytes     int64
+		expectedCode int
+		expectedKeys []string
+	}{
+		{"raw body", "/admin/books/1/cover", "image/png", cover.Bytes(), 0, http.StatusOK, []string{"my-book.jpg", "my-book-medium.jpg", "my-book-small.jpg"}},
+		{"multipart form", "/admin/books/1/cover", mw.FormDataContentType(), form.Bytes(), 0, http.StatusOK, []string{"my-book.jpg", "my-book-medium.jpg", "my-book-small.jpg"}},
+		{"form without cover", "/admin/books/1/cover", "multipart/form-data; boundary=x", []byte("--x--\r\n"), 0, http.StatusBadRequest, nil},
+		{"too large", "/admin/books/1/cover", "image/png", cover.Bytes(), 100, http.StatusRequestEntityTooLarge, nil},
+		{"not an image", "/admin/books/1/cover", "image/png", []byte("jpeg bytes"), 0, http.StatusUnsupportedMediaType, nil},
+		{"unknown book", "/admin/books/2/cover", "image/png", cover.Bytes(), 0, http.StatusNotFound, nil},
+	}
+
+	for _, e := range tests {
+		var events []data.AuditEvent
+		covers := map[int]data.CoverRenditions{}
+
+		app := testApp
+		app.covers = storage.NewMemory()
+		app.models.Book = stubCoverBookRepository{
+			stubBookRepository: stubBookRepository{books: []*data.Book{{ID: 1, Title: "My Book", Slug: "my-book"}}},
+			covers:             covers,
+		}
+		app.models.Audit = stubAuditRepository{events: &events}
+		if e.maxBytes > 0 {
+			app.config.coverLimits.MaxBytes = e.maxBytes
+		}
+
+		req, _ := http.NewRequest("PUT", e.path, bytes.NewReader(e.body))
+		req.Header.Set("Content-Type", e.contentType)
+		rr := httptest.NewRecorder()
+		mux := chi.NewRouter()
+		mux.Put("/admin/books/{id}/cover", app.UploadCover)
+		mux.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected status %d, got %d: %s", e.name, e.expectedCode, rr.Code, rr.Body.String())
+			continue
+		}
+
+		if e.expectedKeys == nil {
+			if len(events) != 0 || len(covers) != 0 {
+				t.Errorf("%s: expected the cover not to be saved", e.name)
+			}
+			continue
+		}
+
+		if len(covers[1]) != len(e.expectedKeys) {
+			t.Errorf("%s: expected renditions %v, got %+v", e.name, e.expectedKeys, covers[1])
+			continue
+		}
+
+		for _, key := range e.expectedKeys {
+			if _, err := app.covers.Get(context.Background(), key); err != nil {
+				t.Errorf("%s: %s was not stored: %v", e.name, key, err)
+			}
+		}
+
+		if len(events) != 1 || events[0].Action != "book.cover_update" {
+			t.Errorf("%s: expected a book.cover_update audit event, got %+v", e.name, events)
+		}
+	}
+}
+
+func TestApplication_DeleteCover(t *testing.T) {
+	var events []data.AuditEvent
+	covers := map[int]data.CoverRenditions{}
+
+	store := storage.NewMemory()
+	_ = store.Put(context.Background(), "my-book.jpg", "image/jpeg", strings.NewReader("jpeg bytes"), -1)
+	_ = store.Put(context.Background(), "my-book-small.jpg", "image/jpeg", strings.NewReader("jpeg bytes"), -1)
+
+	app := testApp
+	app.covers = store
+	app.models.Book = stubCoverBookRepository{
+		stubBookRepository: stubBookRepository{books: []*data.Book{{ID: 1, Title: "My Book", Slug: "my-book", Covers: data.CoverRenditions{
+			{Name: "original", Key: "my-book.jpg"},
+			{Name: "small", Key: "my-book-small.jpg"},
+		}}}},
+		covers: covers,
+	}
+	app.models.Audit = stubAuditRepository{events: &events}
+
+	req, _ := http.NewRequest("DELETE", "/admin/books/1/cover", nil)
+	rr := httptest.NewRecorder()
+	mux := chi.NewRouter()
+	mux.Delete("/admin/books/{id}/cover", app.DeleteCover)
+	mux.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusAccepted, rr.Code, rr.Body.String())
+	}
+
+	if c, ok := covers[1]; !ok || len(c) != 0 {
+		t.Errorf("expected the book's covers to be cleared, got %+v", c)
+	}
+
+	for _, key := range []string{"my-book.jpg", "my-book-small.jpg"} {
+		if _, err := store.Get(context.Background(), key); err != storage.ErrNotFound {
+			t.Errorf("expected %s to be deleted, got %v", key, err)
+		}
+	}
+
+	if len(events) != 1 || events[0].Action != "book.cover_delete" {
+		t.Errorf("expected a book.cover_delete audit event, got %+v", events)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"literal/internal/catalog"
+	"literal/internal/data"
+)
+
+// ExportBooks downloads the books matching the same filters AllBooks takes,
+// with their author and genres, as csv (the default), json (JSON lines) or
+// xlsx, picked by the format parameter.
+func (app *application) ExportBooks(w http.ResponseWriter, r *http.Request) {
+	filter, err := app.readBookFilter(r.URL.Query())
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	app.export(w, r, catalog.Books, func(out *catalog.Writer) error {
+		return app.models.Book.Each(r.Context(), filter, func(b *data.Book) error {
+			return out.Write(catalog.BookRecord(b)...)
+		})
+	})
+}
+
+// ExportAuthors downloads every author with their number of books.
+func (app *application) ExportAuthors(w http.ResponseWriter, r *http.Request) {
+	app.export(w, r, catalog.Authors, func(out *catalog.Writer) error {
+		return app.models.Author.Each(r.Context(), func(a *data.Author) error {
+			return out.Write(catalog.AuthorRecord(a)...)
+		})
+	})
+}
+
+// ExportGenres downloads every genre with its number of books.
+func (app *application) ExportGenres(w http.ResponseWriter, r *http.Request) {
+	app.export(w, r, catalog.Genres, func(out *catalog.Writer) error {
+		return app.models.Genre.Each(r.Context(), func(g *data.Genre) error {
+			return out.Write(catalog.GenreRecord(g)...)
+		})
+	})
+}
+
+// export streams table to the client as each writes it, row by row. Until
+// the first bytes go out an error is still reported as JSON; after that, the
+// connection is dropped so the client can't take a cut-off file for a
+// complete one.
+func (app *application) export(w http.ResponseWriter, r *http.Request, table catalog.Table, each func(*catalog.Writer) error) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = catalog.FormatCSV
+	}
+
+	dw := &downloadWriter{ResponseWriter: w, header: func(h http.Header) {
+		h.Set("Content-Type", catalog.ContentType(format))
+		h.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s%s"`,
+			table.Name, time.Now().Format("20060102"), catalog.Extension(format)))
+	}}
+
+	out, err := catalog.NewWriter(dw, format, table)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	err = each(out)
+	if err == nil {
+		err = out.Close()
+	}
+	if err == nil {
+		return
+	}
+
+	if !dw.started {
+		app.errorJSON(w, err)
+		return
+	}
+
+	app.errorLog.Printf("exporting %s: %v", table.Name, err)
+
+	if hj, ok := w.(http.Hijacker); ok {
+		conn, _, hjErr := hj.Hijack()
+		if hjErr == nil {
+			conn.Close()
+		}
+	}
+}
+
+// downloadWriter holds off on the download's headers until there is
+// something to send, so an error before then can still be answered with the
+// usual JSON.
+type downloadWriter struct {
+	http.ResponseWriter
+	header  func(http.Header)
+	started bool
+}
+
+func (dw *downloadWriter) Write(p []byte) (int, error) {
+	if !dw.started {
+		dw.started = true
+		dw.header(dw.ResponseWriter.Header())
+		dw.ResponseWriter.WriteHeader(http.StatusOK)
+	}
+
+	return dw.ResponseWriter.Write(p)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"literal/internal/data"
+)
+
+type stubExportBookRepository struct {
+	stubBookRepository
+	filter *data.BookFilter
+	err    error
+}
+
+func (s stubExportBookRepository) Each(ctx context.Context, f data.BookFilter, fn func(*data.Book) error) error {
+	*s.filter = f
+	if s.err != nil {
+		return s.err
+	}
+
+	for _, b := range s.books {
+		err := fn(b)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func TestApplication_ExportBooks(t *testing.T) {
+	books := []*data.Book{
+		{ID: 1, Title: "Dune", Slug: "dune", Author: data.Author{AuthorName: "Frank Herbert"}, PublicationYear: 1965,
+			Genres: []data.Genre{{GenreName: "Science Fiction"}}},
+	}
+
+	var tests = []struct {
+		name                string
+		query               string
+		err                 error
+		expectedCode        int
+		expectedContentType string
+		expectedBody        string
+		expectedFilter      data.BookFilter
+	}{
+		{"csv by default", "?author_id=3&sort=-year", nil, http.StatusOK, "text/csv; charset=utf-8",
+			"id,title,slug,author,authors,isbn,publication_year,description,genres,created_at,updated_at\n1,Dune,dune,Frank Herbert,,,1965,,Science Fiction,,\n",
+			data.BookFilter{AuthorID: 3, Sort: "-year"}},
+		{"json lines", "?format=json", nil, http.StatusOK, "application/x-ndjson", `{"id":1,"title":"Dune"`, data.BookFilter{}},
+		{"xlsx", "?format=xlsx", nil, http.StatusOK, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", "PK", data.BookFilter{}},
+		{"unknown format", "?format=pdf", nil, http.StatusBadRequest, "application/json", "must be", data.BookFilter{}},
+		{"bad filter", "?year_from=soon", nil, http.StatusBadRequest, "application/json", "must be", data.BookFilter{}},
+		{"error before any rows", "", errors.New(`invalid sort key "isbn"`), http.StatusBadRequest, "application/json", "invalid sort key", data.BookFilter{}},
+	}
+
+	for _, e := range tests {
+		var filter data.BookFilter
+
+		app := testApp
+		app.models.Book = stubExportBookRepository{stubBookRepository: stubBookRepository{books: books}, filter: &filter, err: e.err}
+
+		req, _ := http.NewRequest("GET", "/admin/export/books"+e.query, nil)
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(app.ExportBooks)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected status %d, got %d: %s", e.name, e.expectedCode, rr.Code, rr.Body.String())
+			continue
+		}
+
+		if got := rr.Header().Get("Content-Type"); got != e.expectedContentType {
+			t.Errorf("%s: expected content type %q, got %q", e.name, e.expectedContentType, got)
+		}
+
+		if !strings.Contains(rr.Body.String(), e.expectedBody) {
+			t.Errorf("%s: expected body to contain %q, got %q", e.name, e.expectedBody, rr.Body.String())
+		}
+
+		if filter != e.expectedFilter {
+			t.Errorf("%s: expected filter %+v, got %+v", e.name, e.expectedFilter, filter)
+		}
+
+		disposition := rr.Header().Get("Content-Disposition")
+		if e.expectedCode == http.StatusOK && !strings.HasPrefix(disposition, `attachment; filename="books-`) {
+			t.Errorf("%s: expected the export to download as a books file, got %q", e.name, disposition)
+		}
+	}
+}
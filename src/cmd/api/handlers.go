@@ -1,22 +1,27 @@
 package main
 
 import (
+	"bytes"
+	"database/sql"
 	"encoding/base64"
 	"errors"
 	"fmt"
 	"net/http"
-	"os"
+	"net/mail"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"literal/internal/data"
+	"literal/internal/imaging"
+	"literal/internal/isbn"
+	"literal/internal/mailer"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/mozillazg/go-slugify"
 )
 
-var staticPath = "./static/"
-
 type jsonResponse struct {
 	Error   bool        `json:"error"`
 	Message string      `json:"message"`
@@ -26,10 +31,13 @@ type jsonResponse struct {
 type credentials struct {
 	Username string `json:"email"`
 	Password string `json:"password"`
+	Device   string `json:"device"`
 }
 
 type envelope map[string]interface{}
 
+const minPasswordLength = 8
+
 func (app *application) Login(w http.ResponseWriter, r *http.Request) {
 	var creds credentials
 	var payload jsonResponse
@@ -45,30 +53,60 @@ func (app *application) Login(w http.ResponseWriter, r *http.Request) {
 
 	app.infoLog.Println("Login request for", creds.Username)
 
-	user, err := app.models.User.GetByEmail(creds.Username)
+	user, err := app.models.User.GetByEmail(r.Context(), creds.Username)
 	if err != nil {
 		app.errorJSON(w, errors.New("invalid credentials"), http.StatusUnauthorized)
 		return
 	}
 
+	// a locked account is turned away before the costly password check, with
+	// the same answer as an unknown email so the lock doesn't give away which
+	// emails have accounts
+	if user.LockedAt(time.Now()) {
+		app.errorJSON(w, errors.New("invalid credentials"), http.StatusUnauthorized)
+		return
+	}
+
 	validPassword, err := user.PasswordMatch(creds.Password)
 	if err != nil || !validPassword {
+		_, err := app.models.User.RecordFailedLogin(r.Context(), user.ID, app.config.loginPolicy)
+		if err != nil {
+			app.errorLog.Println("recording failed login:", err)
+		}
 		app.errorJSON(w, errors.New("invalid credentials"), http.StatusUnauthorized)
 		return
 	}
 
+	if user.FailedLogins > 0 {
+		err = app.models.User.ClearFailedLogins(r.Context(), user.ID)
+		if err != nil {
+			app.errorJSON(w, err)
+			return
+		}
+	}
+
 	if user.Active == 0 {
 		app.errorJSON(w, errors.New("user is not active"), http.StatusUnauthorized)
 		return
 	}
 
-	token, err := app.models.Token.GenerateToken(user.ID, 24*time.Hour)
+	token, err := app.models.Token.GenerateToken(user.ID, app.config.accessTokenTTL)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	token.Name = creds.Device
+	token.UserAgent = r.UserAgent()
+	token.IPAddress = clientIP(r)
+
+	refresh, err := app.models.Token.GenerateToken(user.ID, app.config.refreshTokenTTL)
 	if err != nil {
 		app.errorJSON(w, err)
 		return
 	}
 
-	err = app.models.Token.Insert(*token, *user)
+	err = app.models.Token.InsertWithRefresh(r.Context(), *token, *refresh, *user)
 	if err != nil {
 		app.errorJSON(w, err)
 		return
@@ -77,7 +115,7 @@ func (app *application) Login(w http.ResponseWriter, r *http.Request) {
 	payload = jsonResponse{
 		Error:   false,
 		Message: "log in: success",
-		Data:    envelope{"token": token, "user": user},
+		Data:    envelope{"token": token, "refresh_token": refresh, "user": user},
 	}
 
 	err = app.writeJSON(w, http.StatusOK, payload)
@@ -86,6 +124,42 @@ func (app *application) Login(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// RefreshToken trades a refresh token for a new access and refresh token.
+// Reusing a refresh token revokes its whole session.
+func (app *application) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	var reqPayload struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	err := app.readJSON(w, r, &reqPayload)
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid /missing json"))
+		return
+	}
+
+	token, refresh, err := app.models.Token.Refresh(r.Context(), reqPayload.RefreshToken, app.config.accessTokenTTL, app.config.refreshTokenTTL)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRefreshTokenReused):
+			app.errorLog.Println("refresh token reuse detected; session revoked")
+			app.errorJSON(w, err, http.StatusUnauthorized)
+		case errors.Is(err, data.ErrInvalidRefreshToken):
+			app.errorJSON(w, err, http.StatusUnauthorized)
+		default:
+			app.errorJSON(w, err)
+		}
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "token refreshed",
+		Data:    envelope{"token": token, "refresh_token": refresh},
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, payload)
+}
+
 func (app *application) Logout(w http.ResponseWriter, r *http.Request) {
 	var reqPayload struct {
 		Token string `json:"token"`
@@ -97,7 +171,7 @@ func (app *application) Logout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = app.models.Token.DeleteByToken(reqPayload.Token)
+	err = app.models.Token.DeleteByToken(r.Context(), reqPayload.Token)
 	if err != nil {
 		app.errorJSON(w, errors.New("invalid /missing json"))
 		return
@@ -111,9 +185,233 @@ func (app *application) Logout(w http.ResponseWriter, r *http.Request) {
 	_ = app.writeJSON(w, http.StatusOK, payload)
 }
 
+// ForgotPassword emails a password reset link. It answers the same way
+// whether or not the address has an account, so it can't be used to find out
+// who is registered.
+func (app *application) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var reqPayload struct {
+		Email string `json:"email"`
+	}
+
+	err := app.readJSON(w, r, &reqPayload)
+	if err != nil || reqPayload.Email == "" {
+		app.errorJSON(w, errors.New("invalid /missing json"))
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "if that address has an account, a reset link has been sent to it",
+	}
+
+	user, err := app.models.User.GetByEmail(r.Context(), reqPayload.Email)
+	if err != nil || user.Active == 0 {
+		_ = app.writeJSON(w, http.StatusAccepted, payload)
+		return
+	}
+
+	plainText, err := app.models.OneTimeToken.Create(r.Context(), user.ID, data.ScopePasswordReset, app.config.resetTokenTTL)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	msg := mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password for your account. "+
+			"If it was you, follow this link within %s:\n\n%s/reset-password?token=%s\n\n"+
+			"If it wasn't, you can ignore this email.\n",
+			user.FirstName, app.config.resetTokenTTL, app.config.frontendURL, plainText),
+	}
+
+	app.sendEmail(msg)
+
+	_ = app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+// ResetPassword sets a new password using the token from a reset email, then
+// signs the user out everywhere.
+func (app *application) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var reqPayload struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	err := app.readJSON(w, r, &reqPayload)
+	if err != nil || reqPayload.Token == "" {
+		app.errorJSON(w, errors.New("invalid /missing json"))
+		return
+	}
+
+	if len(reqPayload.Password) < minPasswordLength {
+		app.errorJSON(w, fmt.Errorf("password must be at least %d characters", minPasswordLength))
+		return
+	}
+
+	userID, err := app.models.OneTimeToken.Consume(r.Context(), data.ScopePasswordReset, reqPayload.Token)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	err = app.models.User.ResetPassword(r.Context(), userID, reqPayload.Password)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	// a reset is often how a locked-out user gets back in
+	err = app.models.User.ClearFailedLogins(r.Context(), userID)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	err = app.models.Token.DeleteTokensForUser(r.Context(), userID)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "password changed",
+	}
+
+	_ = app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+// Register signs up a new viewer account while open registration is switched
+// on. The account stays inactive until the emailed verification link is used.
+func (app *application) Register(w http.ResponseWriter, r *http.Request) {
+	open, err := app.models.Settings.RegistrationOpen(r.Context())
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	if !open {
+		app.errorJSON(w, errors.New("registration is closed"), http.StatusForbidden)
+		return
+	}
+
+	var reqPayload struct {
+		FirstName string `json:"first_name"`
+		LastName  string `json:"last_name"`
+		Email     string `json:"email"`
+		Password  string `json:"password"`
+	}
+
+	err = app.readJSON(w, r, &reqPayload)
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid /missing json"))
+		return
+	}
+
+	if reqPayload.FirstName == "" || reqPayload.LastName == "" {
+		app.errorJSON(w, errors.New("first and last name are required"))
+		return
+	}
+
+	address, err := mail.ParseAddress(reqPayload.Email)
+	if err != nil || address.Address != reqPayload.Email {
+		app.errorJSON(w, errors.New("a valid email address is required"))
+		return
+	}
+
+	if len(reqPayload.Password) < minPasswordLength {
+		app.errorJSON(w, fmt.Errorf("password must be at least %d characters", minPasswordLength))
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "check your email for a link to activate your account",
+	}
+
+	// an address that is already registered gets the same answer, so sign-up
+	// can't be used to find out who has an account
+	if _, err := app.models.User.GetByEmail(r.Context(), reqPayload.Email); err == nil {
+		_ = app.writeJSON(w, http.StatusAccepted, payload)
+		return
+	}
+
+	user := data.User{
+		FirstName: reqPayload.FirstName,
+		LastName:  reqPayload.LastName,
+		Email:     reqPayload.Email,
+		Password:  reqPayload.Password,
+		Active:    0,
+		Role:      data.RoleViewer,
+	}
+
+	user.ID, err = app.models.User.Insert(r.Context(), user)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	plainText, err := app.models.OneTimeToken.Create(r.Context(), user.ID, data.ScopeVerifyEmail, app.config.verifyTokenTTL)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	app.sendEmail(mailer.Message{
+		To:      user.Email,
+		Subject: "Activate your account",
+		Body: fmt.Sprintf("Hi %s,\n\nThanks for signing up. Follow this link within %s to activate your account:\n\n"+
+			"%s/verify-email?token=%s\n\n"+
+			"If you didn't sign up, you can ignore this email.\n",
+			user.FirstName, app.config.verifyTokenTTL, app.config.frontendURL, plainText),
+	})
+
+	_ = app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+// VerifyEmail activates the account a verification link was sent for.
+func (app *application) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var reqPayload struct {
+		Token string `json:"token"`
+	}
+
+	err := app.readJSON(w, r, &reqPayload)
+	if err != nil || reqPayload.Token == "" {
+		app.errorJSON(w, errors.New("invalid /missing json"))
+		return
+	}
+
+	userID, err := app.models.OneTimeToken.Consume(r.Context(), data.ScopeVerifyEmail, reqPayload.Token)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	user, err := app.models.User.GetUserById(r.Context(), userID)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	user.Active = 1
+
+	err = app.models.User.Update(r.Context(), *user)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "account activated",
+	}
+
+	_ = app.writeJSON(w, http.StatusAccepted, payload)
+}
+
 func (app *application) AllUsers(w http.ResponseWriter, r *http.Request) {
-	var users data.User
-	all, err := users.GetAll()
+	all, err := app.models.User.GetAll(r.Context())
 	if err != nil {
 		app.errorLog.Println(err)
 		return
@@ -138,35 +436,68 @@ func (app *application) EditUser(w http.ResponseWriter, r *http.Request) {
 
 	if user.ID == 0 {
 		// add user
-		if _, err := app.models.User.Insert(user); err != nil {
+		id, err := app.models.User.Insert(r.Context(), user)
+		if err != nil {
 			app.errorJSON(w, err)
 			return
 		}
+
+		user.ID = id
+		if user.Role == "" {
+			user.Role = data.RoleViewer
+		}
+		app.audit(r, "user.create", "user", id, nil, userSnapshot(&user))
 	} else {
 		// editing user
-		u, err := app.models.User.GetUserById(user.ID)
+		u, err := app.models.User.GetUserById(r.Context(), user.ID)
 		if err != nil {
 			app.errorJSON(w, err)
 			return
 		}
 
+		before := userSnapshot(u)
+		deactivated := u.Active != 0 && user.Active == 0
+
 		u.Email = user.Email
 		u.FirstName = user.FirstName
 		u.LastName = user.LastName
 		u.Active = user.Active
 
-		if err := u.Update(); err != nil {
+		// an empty role leaves the current one in place
+		if user.Role != "" {
+			current := app.contextGetUser(r)
+			if current != nil && current.ID == u.ID && u.Role == data.RoleAdmin && user.Role != data.RoleAdmin {
+				app.errorJSON(w, errors.New("you cannot remove your own admin role"), http.StatusForbidden)
+				return
+			}
+			u.Role = user.Role
+		}
+
+		if err := app.models.User.Update(r.Context(), *u); err != nil {
 			app.errorJSON(w, err)
 			return
 		}
 
+		// a deactivated user is logged out everywhere, refresh tokens included
+		if deactivated {
+			err := app.models.Token.DeleteTokensForUser(r.Context(), u.ID)
+			if err != nil {
+				app.errorJSON(w, err)
+				return
+			}
+		}
+
+		app.audit(r, "user.update", "user", u.ID, before, userSnapshot(u))
+
 		// if passowrd != string, update password
 		if user.Password != "" {
-			err := u.ResetPassword(user.Password)
+			err := app.models.User.ResetPassword(r.Context(), u.ID, user.Password)
 			if err != nil {
 				app.errorJSON(w, err)
 				return
 			}
+
+			app.audit(r, "user.set_password", "user", u.ID, nil, nil)
 		}
 	}
 
@@ -178,6 +509,34 @@ func (app *application) EditUser(w http.ResponseWriter, r *http.Request) {
 	_ = app.writeJSON(w, http.StatusAccepted, payload)
 }
 
+// UnlockUser clears a user's failed logins, lifting any lockout early.
+func (app *application) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	var reqPayload struct {
+		ID int `json:"id"`
+	}
+
+	err := app.readJSON(w, r, &reqPayload)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	err = app.models.User.ClearFailedLogins(r.Context(), reqPayload.ID)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	app.audit(r, "user.unlock", "user", reqPayload.ID, nil, nil)
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "user unlocked",
+	}
+
+	_ = app.writeJSON(w, http.StatusAccepted, payload)
+}
+
 func (app *application) GetUser(w http.ResponseWriter, r *http.Request) {
 	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
@@ -185,7 +544,7 @@ func (app *application) GetUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := app.models.User.GetUserById(userID)
+	user, err := app.models.User.GetUserById(r.Context(), userID)
 	if err != nil {
 		app.errorJSON(w, err)
 		return
@@ -205,12 +564,17 @@ func (app *application) DeleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = app.models.User.DeleteByID(reqPayload.ID)
+	// the snapshot is best effort; a missing user is reported by the delete
+	before, _ := app.models.User.GetUserById(r.Context(), reqPayload.ID)
+
+	err = app.models.User.DeleteByID(r.Context(), reqPayload.ID)
 	if err != nil {
 		app.errorJSON(w, err)
 		return
 	}
 
+	app.audit(r, "user.delete", "user", reqPayload.ID, userSnapshot(before), nil)
+
 	payload := jsonResponse{
 		Error:   false,
 		Message: "User deleted",
@@ -226,26 +590,29 @@ func (app *application) LogoutUserAndSetInactive(w http.ResponseWriter, r *http.
 		return
 	}
 
-	user, err := app.models.User.GetUserById(userID)
+	user, err := app.models.User.GetUserById(r.Context(), userID)
 	if err != nil {
 		app.errorJSON(w, err)
 		return
 	}
 
+	before := userSnapshot(user)
 	user.Active = 0
 
-	err = user.Update()
+	err = app.models.User.Update(r.Context(), *user)
 	if err != nil {
 		app.errorJSON(w, err)
 		return
 	}
 
-	err = app.models.Token.DeleteTokensForUser(userID)
+	err = app.models.Token.DeleteTokensForUser(r.Context(), userID)
 	if err != nil {
 		app.errorJSON(w, err)
 		return
 	}
 
+	app.audit(r, "user.deactivate", "user", userID, before, userSnapshot(user))
+
 	payload := jsonResponse{
 		Error:   false,
 		Message: "User logged out and set inactive",
@@ -254,56 +621,339 @@ func (app *application) LogoutUserAndSetInactive(w http.ResponseWriter, r *http.
 	_ = app.writeJSON(w, http.StatusAccepted, payload)
 }
 
-func (app *application) ValidateToken(w http.ResponseWriter, r *http.Request) {
-	var reqPayload struct {
-		Token string `json:"token"`
-	}
-
-	err := app.readJSON(w, r, &reqPayload)
+// RegistrationSettings reports whether open registration is switched on.
+func (app *application) RegistrationSettings(w http.ResponseWriter, r *http.Request) {
+	open, err := app.models.Settings.RegistrationOpen(r.Context())
 	if err != nil {
 		app.errorJSON(w, err)
 		return
 	}
 
-	valid := false
-
-	valid, _ = app.models.Token.ValidToken(reqPayload.Token)
-
 	payload := jsonResponse{
 		Error:   false,
 		Message: "success",
-		Data:    valid,
+		Data:    envelope{"open": open},
 	}
 
 	_ = app.writeJSON(w, http.StatusOK, payload)
 }
 
-func (app *application) AllBooks(w http.ResponseWriter, r *http.Request) {
-	books, err := app.models.Book.GetAll()
-	if err != nil {
-		app.errorJSON(w, err)
-		return
+// SetRegistration switches open registration on or off.
+func (app *application) SetRegistration(w http.ResponseWriter, r *http.Request) {
+	var reqPayload struct {
+		Open *bool `json:"open"`
 	}
 
-	payload := jsonResponse{
-		Error:   false,
-		Message: "success",
-		Data:    envelope{"books": books},
+	err := app.readJSON(w, r, &reqPayload)
+	if err != nil || reqPayload.Open == nil {
+		app.errorJSON(w, errors.New("invalid /missing json"))
+		return
 	}
 
-	app.writeJSON(w, http.StatusOK, payload)
-}
-
-func (app *application) SingleBook(w http.ResponseWriter, r *http.Request) {
-	slug := chi.URLParam(r, "slug")
-
-	book, err := app.models.Book.GetBookBySlug(slug)
+	before, err := app.models.Settings.RegistrationOpen(r.Context())
 	if err != nil {
 		app.errorJSON(w, err)
 		return
 	}
 
-	payload := jsonResponse{
+	err = app.models.Settings.SetRegistrationOpen(r.Context(), *reqPayload.Open)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	app.audit(r, "settings.update", "settings", 0, envelope{"registration_open": before}, envelope{"registration_open": *reqPayload.Open})
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Changes saved",
+		Data:    envelope{"open": *reqPayload.Open},
+	}
+
+	_ = app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+func (app *application) MySessions(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	sessions, err := app.models.Token.SessionsForUser(r.Context(), user.ID)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "success",
+		Data:    envelope{"sessions": sessions, "current_session_id": user.Token.ID},
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, payload)
+}
+
+func (app *application) RevokeMySession(w http.ResponseWriter, r *http.Request) {
+	var reqPayload struct {
+		ID int `json:"id"`
+	}
+
+	err := app.readJSON(w, r, &reqPayload)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.models.Token.DeleteSession(r.Context(), user.ID, reqPayload.ID)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Session revoked",
+	}
+
+	_ = app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+// RevokeAllMySessions signs the user out everywhere, including the session
+// making the request.
+func (app *application) RevokeAllMySessions(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	err := app.models.Token.DeleteTokensForUser(r.Context(), user.ID)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "All sessions revoked",
+	}
+
+	_ = app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+func (app *application) UserSessions(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	sessions, err := app.models.Token.SessionsForUser(r.Context(), userID)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "success",
+		Data:    envelope{"sessions": sessions},
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, payload)
+}
+
+// RevokeUserSession lets an admin end one of a user's sessions, or all of
+// them when no session id is given, without deactivating the account.
+func (app *application) RevokeUserSession(w http.ResponseWriter, r *http.Request) {
+	var reqPayload struct {
+		UserID    int `json:"user_id"`
+		SessionID int `json:"session_id"`
+	}
+
+	err := app.readJSON(w, r, &reqPayload)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	if reqPayload.SessionID == 0 {
+		err = app.models.Token.DeleteTokensForUser(r.Context(), reqPayload.UserID)
+	} else {
+		err = app.models.Token.DeleteSession(r.Context(), reqPayload.UserID, reqPayload.SessionID)
+	}
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	app.audit(r, "user.revoke_sessions", "user", reqPayload.UserID, envelope{"session_id": reqPayload.SessionID}, nil)
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Session revoked",
+	}
+
+	_ = app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+func (app *application) ValidateToken(w http.ResponseWriter, r *http.Request) {
+	var reqPayload struct {
+		Token string `json:"token"`
+	}
+
+	err := app.readJSON(w, r, &reqPayload)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	valid := false
+
+	valid, _ = app.models.Token.ValidToken(r.Context(), reqPayload.Token)
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "success",
+		Data:    valid,
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, payload)
+}
+
+// AllBooks lists books, filtered by author_id, genre_id, year_from and year_to
+// and ordered by sort (title, year or created_at, prefixed with "-" for
+// descending). Results are only paginated when page or page_size is given, so
+// existing clients that expect the whole catalog keep working.
+func (app *application) AllBooks(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	filter, err := app.readBookFilter(qs)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	paginated := qs.Has("page") || qs.Has("page_size")
+	if paginated {
+		filter.Page, filter.PageSize, err = app.readPage(qs)
+		if err != nil {
+			app.errorJSON(w, err)
+			return
+		}
+	}
+
+	books, total, err := app.models.Book.List(r.Context(), filter)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	var headers http.Header
+	meta := calculateMetadata(total, 1, total)
+	if paginated {
+		meta = calculateMetadata(total, filter.Page, filter.PageSize)
+		headers = paginationLinks(r, meta)
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "success",
+		Data:    envelope{"books": books, "metadata": meta},
+	}
+
+	app.writeJSON(w, http.StatusOK, payload, headers)
+}
+
+// readBookFilter reads the author_id, genre_id, year_from, year_to and sort
+// parameters that narrow a book listing. Paging is left to the caller.
+func (app *application) readBookFilter(qs url.Values) (data.BookFilter, error) {
+	var filter data.BookFilter
+	var err error
+
+	for _, param := range []struct {
+		key string
+		dst *int
+	}{
+		{"author_id", &filter.AuthorID},
+		{"genre_id", &filter.GenreID},
+		{"year_from", &filter.YearFrom},
+		{"year_to", &filter.YearTo},
+	} {
+		*param.dst, err = app.readInt(qs, param.key, 0)
+		if err != nil {
+			return filter, err
+		}
+	}
+
+	filter.Sort = qs.Get("sort")
+
+	return filter, nil
+}
+
+func (app *application) SearchBooks(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	q := strings.TrimSpace(qs.Get("q"))
+	if q == "" {
+		app.errorJSON(w, errors.New("q must not be empty"))
+		return
+	}
+
+	page, pageSize, err := app.readPage(qs)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	results, total, err := app.models.Book.Search(r.Context(), q, page, pageSize)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "success",
+		Data:    envelope{"books": results, "metadata": calculateMetadata(total, page, pageSize)},
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+func (app *application) SingleBook(w http.ResponseWriter, r *http.Request) {
+	slug := chi.URLParam(r, "slug")
+
+	book, err := app.models.Book.GetBookBySlug(r.Context(), slug)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "success",
+		Data:    envelope{"book": book},
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// BookByISBN looks a book up by either form of its ISBN.
+func (app *application) BookByISBN(w http.ResponseWriter, r *http.Request) {
+	isbn13, _, err := isbn.Parse(chi.URLParam(r, "isbn"))
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	book, err := app.models.Book.GetBookByISBN(r.Context(), isbn13)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.errorJSON(w, errors.New("no book has that ISBN"), http.StatusNotFound)
+			return
+		}
+		app.errorJSON(w, err)
+		return
+	}
+
+	payload := jsonResponse{
 		Error:   false,
 		Message: "success",
 		Data:    envelope{"book": book},
@@ -313,7 +963,7 @@ func (app *application) SingleBook(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app *application) AllAuthors(w http.ResponseWriter, r *http.Request) {
-	all, error := app.models.Author.GetAllAuthors()
+	all, error := app.models.Author.GetAllAuthors(r.Context())
 	if error != nil {
 		app.errorJSON(w, error)
 		return
@@ -343,6 +993,231 @@ func (app *application) AllAuthors(w http.ResponseWriter, r *http.Request) {
 	app.writeJSON(w, http.StatusOK, payload)
 }
 
+func (app *application) AuthorByID(w http.ResponseWriter, r *http.Request) {
+	authorID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	author, err := app.models.Author.GetByID(r.Context(), authorID)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "success",
+		Data:    author,
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+func (app *application) EditAuthor(w http.ResponseWriter, r *http.Request) {
+	var author data.Author
+	err := app.readJSON(w, r, &author)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	if author.ID == 0 {
+		id, err := app.models.Author.Insert(r.Context(), author)
+		if err != nil {
+			app.errorJSON(w, err)
+			return
+		}
+		author.ID = id
+		app.audit(r, "author.create", "author", id, nil, author)
+	} else {
+		before, _ := app.models.Author.GetByID(r.Context(), author.ID)
+
+		err := app.models.Author.Update(r.Context(), author)
+		if err != nil {
+			app.errorJSON(w, err)
+			return
+		}
+		app.audit(r, "author.update", "author", author.ID, before, author)
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Changes saved",
+		Data:    envelope{"id": author.ID},
+	}
+
+	_ = app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+func (app *application) DeleteAuthor(w http.ResponseWriter, r *http.Request) {
+	var reqPayload struct {
+		ID int `json:"id"`
+	}
+
+	err := app.readJSON(w, r, &reqPayload)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	before, _ := app.models.Author.GetByID(r.Context(), reqPayload.ID)
+
+	err = app.models.Author.Delete(r.Context(), reqPayload.ID)
+	if err != nil {
+		if errors.Is(err, data.ErrAuthorHasBooks) {
+			app.errorJSON(w, err, http.StatusConflict)
+			return
+		}
+		app.errorJSON(w, err)
+		return
+	}
+
+	app.audit(r, "author.delete", "author", reqPayload.ID, before, nil)
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Author deleted",
+	}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+func (app *application) MergeAuthors(w http.ResponseWriter, r *http.Request) {
+	var reqPayload struct {
+		KeepID      int `json:"keep_id"`
+		DuplicateID int `json:"duplicate_id"`
+	}
+
+	err := app.readJSON(w, r, &reqPayload)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	duplicate, _ := app.models.Author.GetByID(r.Context(), reqPayload.DuplicateID)
+
+	moved, err := app.models.Author.Merge(r.Context(), reqPayload.KeepID, reqPayload.DuplicateID)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	app.audit(r, "author.merge", "author", reqPayload.KeepID, envelope{"duplicate": duplicate}, envelope{"books_moved": moved})
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Authors merged",
+		Data:    envelope{"books_moved": moved},
+	}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+func (app *application) AllGenres(w http.ResponseWriter, r *http.Request) {
+	genres, err := app.models.Genre.GetAll(r.Context())
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "success",
+		Data:    envelope{"genres": genres},
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+func (app *application) GenreByID(w http.ResponseWriter, r *http.Request) {
+	genreID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	genre, err := app.models.Genre.GetByID(r.Context(), genreID)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "success",
+		Data:    genre,
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+func (app *application) EditGenre(w http.ResponseWriter, r *http.Request) {
+	var genre data.Genre
+	err := app.readJSON(w, r, &genre)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	if genre.ID == 0 {
+		id, err := app.models.Genre.Insert(r.Context(), genre)
+		if err != nil {
+			app.errorJSON(w, err)
+			return
+		}
+		genre.ID = id
+		app.audit(r, "genre.create", "genre", id, nil, genre)
+	} else {
+		before, _ := app.models.Genre.GetByID(r.Context(), genre.ID)
+
+		err := app.models.Genre.Update(r.Context(), genre)
+		if err != nil {
+			app.errorJSON(w, err)
+			return
+		}
+		app.audit(r, "genre.update", "genre", genre.ID, before, genre)
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Changes saved",
+		Data:    envelope{"id": genre.ID},
+	}
+
+	_ = app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+func (app *application) DeleteGenre(w http.ResponseWriter, r *http.Request) {
+	var reqPayload struct {
+		ID int `json:"id"`
+	}
+
+	err := app.readJSON(w, r, &reqPayload)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	before, _ := app.models.Genre.GetByID(r.Context(), reqPayload.ID)
+
+	err = app.models.Genre.Delete(r.Context(), reqPayload.ID)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	app.audit(r, "genre.delete", "genre", reqPayload.ID, before, nil)
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Genre deleted",
+	}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
 func (app *application) EditBook(w http.ResponseWriter, r *http.Request) {
 	var reqPayload struct {
 		ID              int    `json:"id"`
@@ -351,7 +1226,16 @@ func (app *application) EditBook(w http.ResponseWriter, r *http.Request) {
 		PublicationYear int    `json:"publication_year"`
 		Description     string `json:"description"`
 		CoverBase64     string `json:"cover"`
+		CoverURL        string `json:"cover_url"`
 		GenreIDs        []int  `json:"genre_ids"`
+
+		// nil leaves an existing book's ISBN alone, and "" clears it
+		ISBN10 *string `json:"isbn_10"`
+		ISBN13 *string `json:"isbn_13"`
+
+		// nil keeps an existing book's contributors, with author_id as its
+		// first author, for clients that only know about one author
+		Authors []data.Contributor `json:"authors"`
 	}
 
 	err := app.readJSON(w, r, &reqPayload)
@@ -370,39 +1254,199 @@ func (app *application) EditBook(w http.ResponseWriter, r *http.Request) {
 		GenreIDs:        reqPayload.GenreIDs,
 	}
 
-	if len(reqPayload.CoverBase64) > 0 {
-		decoded, err := base64.StdEncoding.DecodeString(reqPayload.CoverBase64)
+	var before *data.Book
+	if book.ID != 0 {
+		before, _ = app.models.Book.GetBookById(r.Context(), book.ID)
+	}
+
+	if reqPayload.Authors != nil {
+		err = checkContributors(reqPayload.Authors)
 		if err != nil {
 			app.errorJSON(w, err)
 			return
 		}
+		book.Authors = reqPayload.Authors
+		book.AuthorID = data.PrimaryAuthorID(book.Authors)
+	} else if before != nil && book.AuthorID != 0 {
+		book.Authors = replacePrimaryAuthor(before.Authors, book.AuthorID)
+	}
 
-		if err := os.WriteFile(fmt.Sprintf("%s/covers/%s.jpg", staticPath, book.Slug), decoded, 0o666); err != nil {
+	if reqPayload.ISBN10 == nil && reqPayload.ISBN13 == nil {
+		if before != nil {
+			book.ISBN10, book.ISBN13 = before.ISBN10, before.ISBN13
+		}
+	} else {
+		book.ISBN13, book.ISBN10, err = readISBN(reqPayload.ISBN10, reqPayload.ISBN13)
+		if err != nil {
 			app.errorJSON(w, err)
 			return
 		}
+	}
 
-		payload := jsonResponse{
-			Error:   false,
-			Message: "Book updated",
+	// the ISBN identifies the book, so saving one that another book already
+	// has would be a duplicate
+	if book.ISBN13 != "" {
+		existing, err := app.models.Book.GetBookByISBN(r.Context(), book.ISBN13)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			app.errorJSON(w, err)
+			return
+		}
+		if existing != nil && existing.ID != book.ID {
+			payload := jsonResponse{
+				Error:   true,
+				Message: fmt.Sprintf("ISBN %s is already used by %q", book.ISBN13, existing.Title),
+				Data:    envelope{"id": existing.ID, "slug": existing.Slug},
+			}
+			app.writeJSON(w, http.StatusConflict, payload)
+			return
 		}
+	}
 
-		app.writeJSON(w, http.StatusAccepted, payload)
+	// check the cover before saving anything, so a bad image fails the whole save
+	var cover *imaging.Result
+	if len(reqPayload.CoverBase64) > 0 {
+		decoded, err := base64.StdEncoding.DecodeString(reqPayload.CoverBase64)
+		if err != nil {
+			app.errorJSON(w, err)
+			return
+		}
+
+		cover, err = imaging.Process(bytes.NewReader(decoded), app.config.coverLimits, imaging.DefaultSizes)
+		if err != nil {
+			app.coverError(w, err)
+			return
+		}
+	} else if reqPayload.CoverURL != "" {
+		cover, err = app.fetchCover(r.Context(), reqPayload.CoverURL)
+		if err != nil {
+			app.coverError(w, err)
+			return
+		}
 	}
 
+	var previous data.CoverRenditions
+
 	if book.ID == 0 {
-		_, err = app.models.Book.Insert(book)
+		id, err := app.models.Book.Insert(r.Context(), book)
 		if err != nil {
 			app.errorJSON(w, err)
 			return
 		}
+		book.ID = id
+		app.audit(r, "book.create", "book", id, nil, book)
 	} else {
-		err := book.Update()
+		if before != nil {
+			previous = before.Covers
+		}
+
+		err := app.models.Book.Update(r.Context(), book)
 		if err != nil {
 			app.errorJSON(w, err)
 			return
 		}
+		app.audit(r, "book.update", "book", book.ID, before, book)
+	}
+
+	if cover != nil {
+		book.Covers, err = app.storeCover(r.Context(), book.ID, book.Slug, previous, cover)
+		if err != nil {
+			app.errorJSON(w, err)
+			return
+		}
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Book updated",
+		Data:    envelope{"id": book.ID, "covers": book.Covers},
+	}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+// readISBN validates the ISBNs sent with a book. Either form is enough, and
+// when both are sent they have to be the same book's.
+func readISBN(isbn10, isbn13 *string) (string, string, error) {
+	var from10, from13, to10 string
+	var err error
+
+	if isbn10 != nil && strings.TrimSpace(*isbn10) != "" {
+		from10, err = isbn.To13(*isbn10)
+		if err != nil {
+			return "", "", fmt.Errorf("isbn_10: %w", err)
+		}
+		to10 = isbn.Clean(*isbn10)
+	}
+
+	if isbn13 != nil && strings.TrimSpace(*isbn13) != "" {
+		from13 = isbn.Clean(*isbn13)
+		to10, err = isbn.To10(from13)
+		if err != nil && !errors.Is(err, isbn.ErrNoISBN10) {
+			return "", "", fmt.Errorf("isbn_13: %w", err)
+		}
+	}
+
+	if from10 != "" && from13 != "" && from10 != from13 {
+		return "", "", errors.New("isbn_10 and isbn_13 are different books")
 	}
+	if from13 == "" {
+		from13 = from10
+	}
+
+	return from13, to10, nil
+}
+
+// checkContributors validates the contributors sent with a book. A book needs
+// at least one, and an author can be credited in more than one role but only
+// once in each.
+func checkContributors(contributors []data.Contributor) error {
+	if len(contributors) == 0 {
+		return errors.New("authors: a book needs at least one contributor")
+	}
+
+	seen := make(map[data.Contributor]bool, len(contributors))
+	for i, c := range contributors {
+		if c.AuthorID <= 0 {
+			return fmt.Errorf("authors[%d]: author_id is required", i)
+		}
+		if !data.ValidContributorRole(c.Role) {
+			return fmt.Errorf("authors[%d]: %w", i, data.ErrInvalidContributorRole)
+		}
+
+		key := data.Contributor{AuthorID: c.AuthorID, Role: c.Role}
+		if seen[key] {
+			return fmt.Errorf("authors[%d]: author %d is already credited as %s", i, c.AuthorID, c.Role)
+		}
+		seen[key] = true
+	}
+
+	return nil
+}
+
+// replacePrimaryAuthor makes authorID the first author in a copy of
+// contributors, keeping everyone else where they were.
+func replacePrimaryAuthor(contributors []data.Contributor, authorID int) []data.Contributor {
+	out := make([]data.Contributor, 0, len(contributors)+1)
+	replaced := false
+	for _, c := range contributors {
+		if c.Role == data.ContributorAuthor {
+			if !replaced {
+				out = append(out, data.Contributor{AuthorID: authorID, Role: data.ContributorAuthor})
+				replaced = true
+				continue
+			}
+			if c.AuthorID == authorID {
+				continue
+			}
+		}
+		out = append(out, c)
+	}
+
+	if !replaced {
+		out = append([]data.Contributor{{AuthorID: authorID, Role: data.ContributorAuthor}}, out...)
+	}
+
+	return out
 }
 
 func (app *application) BookById(w http.ResponseWriter, r *http.Request) {
@@ -412,7 +1456,7 @@ func (app *application) BookById(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	book, err := app.models.Book.GetBookById(bookID)
+	book, err := app.models.Book.GetBookById(r.Context(), bookID)
 	if err != nil {
 		app.errorJSON(w, err)
 		return
@@ -438,12 +1482,20 @@ func (app *application) DeleteBook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = app.models.Book.DeleteByID(reqPayload.ID)
+	before, _ := app.models.Book.GetBookById(r.Context(), reqPayload.ID)
+
+	err = app.models.Book.DeleteByID(r.Context(), reqPayload.ID)
 	if err != nil {
 		app.errorJSON(w, err)
 		return
 	}
 
+	app.audit(r, "book.delete", "book", reqPayload.ID, before, nil)
+
+	if before != nil {
+		app.deleteCovers(r.Context(), before.Slug, before.Covers)
+	}
+
 	payload := jsonResponse{
 		Error:   false,
 		Message: "Book deleted",
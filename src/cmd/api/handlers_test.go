@@ -1,16 +1,27 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	"literal/internal/data"
+	"literal/internal/mailer"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestApplication_AllUsers(t *testing.T) {
 	// create some mock rows, and add one row
-	mockedRows := mockDB.NewRows([]string{"id", "email", "first_name", "last_name", "password", "active", "created_at", "updated_at", "has_token"})
-	mockedRows.AddRow("1", "me@here.com", "Jack", "Smith", "abc123", "1", time.Now(), time.Now(), "0")
+	mockedRows := mockDB.NewRows([]string{"id", "first_name", "last_name", "email", "password", "active", "created_at", "updated_at", "role", "has_token", "failed_logins", "locked_until"})
+	mockedRows.AddRow("1", "Jack", "Smith", "me@here.com", "abc123", "1", time.Now(), time.Now(), "admin", "0", "0", nil)
 
 	mockDB.ExpectQuery("select \\\\* ").WillReturnRows(mockedRows)
 
@@ -23,3 +34,681 @@ func TestApplication_AllUsers(t *testing.T) {
 		t.Error("AllUsers returned wrong status code of", rr.Code)
 	}
 }
+
+type stubBookRepository struct {
+	data.BookRepository
+	books []*data.Book
+}
+
+func (s stubBookRepository) List(ctx context.Context, f data.BookFilter) ([]*data.Book, int, error) {
+	if f.PageSize == 0 {
+		return s.books, len(s.books), nil
+	}
+
+	start := (f.Page - 1) * f.PageSize
+	if start > len(s.books) {
+		start = len(s.books)
+	}
+	end := start + f.PageSize
+	if end > len(s.books) {
+		end = len(s.books)
+	}
+
+	return s.books[start:end], len(s.books), nil
+}
+
+func (s stubBookRepository) Search(ctx context.Context, q string, page, pageSize int) ([]*data.BookSearchResult, int, error) {
+	var results []*data.BookSearchResult
+	for _, b := range s.books {
+		results = append(results, &data.BookSearchResult{Book: *b, Rank: 0.5, Snippet: "<mark>" + q + "</mark>"})
+	}
+	return results, len(results), nil
+}
+
+func (s stubBookRepository) Insert(ctx context.Context, book data.Book) (int, error) {
+	return 42, nil
+}
+
+func TestApplication_AllBooks(t *testing.T) {
+	app := testApp
+	app.models.Book = stubBookRepository{books: []*data.Book{{ID: 1, Title: "My Book", Slug: "my-book"}}}
+
+	rr := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/books", nil)
+	handler := http.HandlerFunc(app.AllBooks)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Error("AllBooks returned wrong status code of", rr.Code)
+	}
+
+	if !strings.Contains(rr.Body.String(), `"my-book"`) {
+		t.Error("AllBooks did not return the stubbed book:", rr.Body.String())
+	}
+}
+
+type stubAuthorRepository struct {
+	data.AuthorRepository
+	deleteErr error
+}
+
+func (s stubAuthorRepository) Delete(ctx context.Context, id int) error {
+	return s.deleteErr
+}
+
+func (s stubAuthorRepository) GetByID(ctx context.Context, id int) (*data.Author, error) {
+	return &data.Author{ID: id, AuthorName: "John Smith"}, nil
+}
+
+type stubAuditRepository struct {
+	data.AuditRepository
+	events *[]data.AuditEvent
+	filter *data.AuditFilter
+}
+
+func (s stubAuditRepository) Insert(ctx context.Context, e data.AuditEvent) error {
+	*s.events = append(*s.events, e)
+	return nil
+}
+
+func (s stubAuditRepository) List(ctx context.Context, f data.AuditFilter) ([]*data.AuditEvent, int, error) {
+	*s.filter = f
+	var events []*data.AuditEvent
+	for i := range *s.events {
+		events = append(events, &(*s.events)[i])
+	}
+	return events, len(events), nil
+}
+
+func TestApplication_DeleteAuthor(t *testing.T) {
+	var tests = []struct {
+		name          string
+		deleteErr     error
+		expectedCode  int
+		expectedAudit int
+	}{
+		{"deleted", nil, http.StatusAccepted, 1},
+		{"has books", data.ErrAuthorHasBooks, http.StatusConflict, 0},
+		{"not found", sql.ErrNoRows, http.StatusBadRequest, 0},
+	}
+
+	for _, e := range tests {
+		var events []data.AuditEvent
+
+		app := testApp
+		app.models.Author = stubAuthorRepository{deleteErr: e.deleteErr}
+		app.models.Audit = stubAuditRepository{events: &events}
+
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/admin/authors/delete", strings.NewReader(`{"id": 1}`))
+		req = app.contextSetUser(req, &data.User{ID: 5, Email: "admin@here.com"})
+		handler := http.HandlerFunc(app.DeleteAuthor)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected status %d, got %d", e.name, e.expectedCode, rr.Code)
+		}
+
+		if len(events) != e.expectedAudit {
+			t.Errorf("%s: expected %d audit events, got %d", e.name, e.expectedAudit, len(events))
+			continue
+		}
+
+		if len(events) > 0 {
+			ev := events[0]
+			if ev.Action != "author.delete" || ev.ActorID != 5 || ev.TargetID != 1 || !strings.Contains(string(ev.Before), "John Smith") || ev.After != nil {
+				t.Errorf("%s: unexpected audit event %+v", e.name, ev)
+			}
+		}
+	}
+}
+
+type stubGenreRepository struct {
+	data.GenreRepository
+	genres []*data.Genre
+}
+
+func (s stubGenreRepository) GetAll(ctx context.Context) ([]*data.Genre, error) {
+	return s.genres, nil
+}
+
+func TestApplication_AllGenres(t *testing.T) {
+	app := testApp
+	app.models.Genre = stubGenreRepository{genres: []*data.Genre{{ID: 3, GenreName: "Romance", BookCount: 1}}}
+
+	rr := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/genres", nil)
+	handler := http.HandlerFunc(app.AllGenres)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Error("AllGenres returned wrong status code of", rr.Code)
+	}
+
+	if !strings.Contains(rr.Body.String(), `"book_count"`) {
+		t.Error("AllGenres did not include book counts:", rr.Body.String())
+	}
+}
+
+func TestApplication_AllBooksPaginated(t *testing.T) {
+	var books []*data.Book
+	for i := 1; i <= 5; i++ {
+		books = append(books, &data.Book{ID: i, Title: fmt.Sprintf("Book %d", i)})
+	}
+
+	app := testApp
+	app.models.Book = stubBookRepository{books: books}
+
+	var tests = []struct {
+		name         string
+		url          string
+		expectedCode int
+		expectedLink string
+	}{
+		{"first page", "/books?page=1&page_size=2", http.StatusOK, `rel="next"`},
+		{"last page", "/books?page=3&page_size=2", http.StatusOK, `rel="prev"`},
+		{"bad filter", "/books?author_id=abc", http.StatusBadRequest, ""},
+		{"bad page size", "/books?page_size=0", http.StatusBadRequest, ""},
+	}
+
+	for _, e := range tests {
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", e.url, nil)
+		handler := http.HandlerFunc(app.AllBooks)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected status %d, got %d", e.name, e.expectedCode, rr.Code)
+		}
+
+		if !strings.Contains(rr.Header().Get("Link"), e.expectedLink) {
+			t.Errorf("%s: expected Link header to contain %s, got %q", e.name, e.expectedLink, rr.Header().Get("Link"))
+		}
+	}
+}
+
+func TestApplication_SearchBooks(t *testing.T) {
+	app := testApp
+	app.models.Book = stubBookRepository{books: []*data.Book{{ID: 1, Title: "My Book", Slug: "my-book"}}}
+
+	var tests = []struct {
+		name         string
+		url          string
+		expectedCode int
+	}{
+		{"match", "/books/search?q=book", http.StatusOK},
+		{"missing query", "/books/search?q=+", http.StatusBadRequest},
+		{"bad page", "/books/search?q=book&page=0", http.StatusBadRequest},
+	}
+
+	for _, e := range tests {
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", e.url, nil)
+		handler := http.HandlerFunc(app.SearchBooks)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected status %d, got %d", e.name, e.expectedCode, rr.Code)
+		}
+	}
+}
+
+type stubTokenRepository struct {
+	data.TokenRepository
+	sessions   map[int][]int
+	refreshErr error
+	revoked    *[]int
+}
+
+func (s stubTokenRepository) Refresh(ctx context.Context, plainText string, accessTTL, refreshTTL time.Duration) (*data.Token, *data.Token, error) {
+	if s.refreshErr != nil {
+		return nil, nil, s.refreshErr
+	}
+	return &data.Token{Token: "access"}, &data.Token{Token: "refresh"}, nil
+}
+
+func (s stubTokenRepository) DeleteSession(ctx context.Context, userID, id int) error {
+	for _, sessionID := range s.sessions[userID] {
+		if sessionID == id {
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (s stubTokenRepository) GenerateToken(userID int, ttl time.Duration) (*data.Token, error) {
+	return &data.Token{UserID: userID, Token: "abcdefghijklmnopqrstuvwxyz", Expiry: time.Now().Add(ttl)}, nil
+}
+
+func (s stubTokenRepository) InsertWithRefresh(ctx context.Context, access, refresh data.Token, u data.User) error {
+	return nil
+}
+
+func (s stubTokenRepository) DeleteTokensForUser(ctx context.Context, id int) error {
+	*s.revoked = append(*s.revoked, id)
+	return nil
+}
+
+func TestApplication_RevokeMySession(t *testing.T) {
+	app := testApp
+	app.models.Token = stubTokenRepository{sessions: map[int][]int{1: {10, 11}, 2: {20}}}
+
+	var tests = []struct {
+		name         string
+		sessionID    int
+		expectedCode int
+	}{
+		{"own session", 11, http.StatusAccepted},
+		{"someone else's session", 20, http.StatusBadRequest},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", "/users/me/sessions/revoke", strings.NewReader(fmt.Sprintf(`{"id": %d}`, e.sessionID)))
+		req = app.contextSetUser(req, &data.User{ID: 1})
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(app.RevokeMySession)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected status %d, got %d", e.name, e.expectedCode, rr.Code)
+		}
+	}
+}
+
+func TestApplication_RefreshToken(t *testing.T) {
+	var tests = []struct {
+		name         string
+		refreshErr   error
+		expectedCode int
+	}{
+		{"rotated", nil, http.StatusOK},
+		{"unknown token", data.ErrInvalidRefreshToken, http.StatusUnauthorized},
+		{"reused token", data.ErrRefreshTokenReused, http.StatusUnauthorized},
+	}
+
+	for _, e := range tests {
+		app := testApp
+		app.models.Token = stubTokenRepository{refreshErr: e.refreshErr}
+
+		req, _ := http.NewRequest("POST", "/users/refresh", strings.NewReader(`{"refresh_token": "abc"}`))
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(app.RefreshToken)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected status %d, got %d", e.name, e.expectedCode, rr.Code)
+		}
+	}
+}
+
+type stubUserRepository struct {
+	data.UserRepository
+	users     map[string]*data.User
+	passwords map[int]string
+	failures  map[int]int
+}
+
+func (s stubUserRepository) RecordFailedLogin(ctx context.Context, id int, p data.LoginPolicy) (time.Time, error) {
+	s.failures[id]++
+	return time.Time{}, nil
+}
+
+func (s stubUserRepository) ClearFailedLogins(ctx context.Context, id int) error {
+	delete(s.failures, id)
+	return nil
+}
+
+func (s stubUserRepository) GetUserById(ctx context.Context, id int) (*data.User, error) {
+	for _, u := range s.users {
+		if u.ID == id {
+			found := *u
+			return &found, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s stubUserRepository) Insert(ctx context.Context, user data.User) (int, error) {
+	user.ID = len(s.users) + 1
+	s.users[user.Email] = &user
+	return user.ID, nil
+}
+
+func (s stubUserRepository) Update(ctx context.Context, user data.User) error {
+	s.users[user.Email] = &user
+	return nil
+}
+
+func (s stubUserRepository) GetByEmail(ctx context.Context, email string) (*data.User, error) {
+	if u, ok := s.users[email]; ok {
+		return u, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s stubUserRepository) ResetPassword(ctx context.Context, id int, password string) error {
+	s.passwords[id] = password
+	return nil
+}
+
+type stubOneTimeTokenRepository struct {
+	data.OneTimeTokenRepository
+	tokens map[string]stubOneTimeToken
+}
+
+type stubOneTimeToken struct {
+	scope  string
+	userID int
+}
+
+func (s stubOneTimeTokenRepository) Create(ctx context.Context, userID int, scope string, ttl time.Duration) (string, error) {
+	plainText := scope + "-token"
+	s.tokens[plainText] = stubOneTimeToken{scope, userID}
+	return plainText, nil
+}
+
+func (s stubOneTimeTokenRepository) Consume(ctx context.Context, scope, plainText string) (int, error) {
+	token, ok := s.tokens[plainText]
+	if !ok || token.scope != scope {
+		return 0, data.ErrInvalidOneTimeToken
+	}
+	delete(s.tokens, plainText)
+	return token.userID, nil
+}
+
+func TestApplication_ForgotPassword(t *testing.T) {
+	var tests = []struct {
+		name          string
+		email         string
+		expectedCode  int
+		expectedMails int
+	}{
+		{"known address", "me@here.com", http.StatusAccepted, 1},
+		{"unknown address", "nobody@here.com", http.StatusAccepted, 0},
+		{"inactive account", "gone@here.com", http.StatusAccepted, 0},
+	}
+
+	for _, e := range tests {
+		outbox := t.TempDir()
+
+		app := testApp
+		app.models.User = stubUserRepository{users: map[string]*data.User{
+			"me@here.com":   {ID: 1, Email: "me@here.com", Active: 1},
+			"gone@here.com": {ID: 2, Email: "gone@here.com", Active: 0},
+		}}
+		app.models.OneTimeToken = stubOneTimeTokenRepository{tokens: map[string]stubOneTimeToken{}}
+		app.mailer = mailer.FileOutbox{Dir: outbox, From: "test@localhost"}
+
+		req, _ := http.NewRequest("POST", "/users/forgot-password", strings.NewReader(fmt.Sprintf(`{"email": %q}`, e.email)))
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(app.ForgotPassword)
+		handler.ServeHTTP(rr, req)
+		app.wg.Wait()
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected status %d, got %d", e.name, e.expectedCode, rr.Code)
+		}
+
+		sent, _ := os.ReadDir(outbox)
+		if len(sent) != e.expectedMails {
+			t.Errorf("%s: expected %d emails, got %d", e.name, e.expectedMails, len(sent))
+		}
+
+		if len(sent) > 0 {
+			body, _ := os.ReadFile(filepath.Join(outbox, sent[0].Name()))
+			if !strings.Contains(string(body), "reset-password?token=password-reset-token") {
+				t.Errorf("%s: reset link missing from email:\n%s", e.name, body)
+			}
+		}
+	}
+}
+
+func TestApplication_ResetPassword(t *testing.T) {
+	var tests = []struct {
+		name          string
+		body          string
+		expectedCode  int
+		expectRevoked bool
+	}{
+		{"valid token", `{"token": "reset-token", "password": "new password"}`, http.StatusAccepted, true},
+		{"unknown token", `{"token": "other-token", "password": "new password"}`, http.StatusBadRequest, false},
+		{"verification token", `{"token": "verify-token", "password": "new password"}`, http.StatusBadRequest, false},
+		{"short password", `{"token": "reset-token", "password": "short"}`, http.StatusBadRequest, false},
+	}
+
+	for _, e := range tests {
+		var revoked []int
+		passwords := map[int]string{}
+		failures := map[int]int{7: 10}
+
+		app := testApp
+		app.models.User = stubUserRepository{passwords: passwords, failures: failures}
+		app.models.Token = stubTokenRepository{revoked: &revoked}
+		app.models.OneTimeToken = stubOneTimeTokenRepository{tokens: map[string]stubOneTimeToken{
+			"reset-token":  {data.ScopePasswordReset, 7},
+			"verify-token": {data.ScopeVerifyEmail, 7},
+		}}
+
+		req, _ := http.NewRequest("POST", "/users/reset-password", strings.NewReader(e.body))
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(app.ResetPassword)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected status %d, got %d", e.name, e.expectedCode, rr.Code)
+		}
+
+		if e.expectRevoked && (len(revoked) != 1 || revoked[0] != 7 || passwords[7] != "new password") {
+			t.Errorf("%s: expected user 7's password changed and sessions revoked", e.name)
+		}
+		if e.expectRevoked && failures[7] != 0 {
+			t.Errorf("%s: expected user 7's failed logins cleared, got %d", e.name, failures[7])
+		}
+		if !e.expectRevoked && (len(revoked) != 0 || len(passwords) != 0 || failures[7] != 10) {
+			t.Errorf("%s: expected nothing to change", e.name)
+		}
+	}
+}
+
+type stubSettingsRepository struct {
+	data.SettingsRepository
+	registrationOpen bool
+}
+
+func (s stubSettingsRepository) RegistrationOpen(ctx context.Context) (bool, error) {
+	return s.registrationOpen, nil
+}
+
+func TestApplication_Register(t *testing.T) {
+	var tests = []struct {
+		name          string
+		open          bool
+		body          string
+		expectedCode  int
+		expectedUsers int
+		expectedMails int
+	}{
+		{"new account", true, `{"first_name": "Jane", "last_name": "Doe", "email": "jane@here.com", "password": "password1"}`, http.StatusAccepted, 2, 1},
+		{"registration closed", false, `{"first_name": "Jane", "last_name": "Doe", "email": "jane@here.com", "password": "password1"}`, http.StatusForbidden, 1, 0},
+		{"existing address", true, `{"first_name": "Jack", "last_name": "Smith", "email": "me@here.com", "password": "password1"}`, http.StatusAccepted, 1, 0},
+		{"bad address", true, `{"first_name": "Jane", "last_name": "Doe", "email": "jane", "password": "password1"}`, http.StatusBadRequest, 1, 0},
+		{"short password", true, `{"first_name": "Jane", "last_name": "Doe", "email": "jane@here.com", "password": "short"}`, http.StatusBadRequest, 1, 0},
+	}
+
+	for _, e := range tests {
+		outbox := t.TempDir()
+		users := map[string]*data.User{"me@here.com": {ID: 1, Email: "me@here.com", Active: 1}}
+
+		app := testApp
+		app.models.User = stubUserRepository{users: users}
+		app.models.OneTimeToken = stubOneTimeTokenRepository{tokens: map[string]stubOneTimeToken{}}
+		app.models.Settings = stubSettingsRepository{registrationOpen: e.open}
+		app.mailer = mailer.FileOutbox{Dir: outbox, From: "test@localhost"}
+
+		req, _ := http.NewRequest("POST", "/users/register", strings.NewReader(e.body))
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(app.Register)
+		handler.ServeHTTP(rr, req)
+		app.wg.Wait()
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected status %d, got %d", e.name, e.expectedCode, rr.Code)
+		}
+
+		if len(users) != e.expectedUsers {
+			t.Errorf("%s: expected %d users, got %d", e.name, e.expectedUsers, len(users))
+		}
+
+		if u, ok := users["jane@here.com"]; ok && (u.Active != 0 || u.Role != data.RoleViewer) {
+			t.Errorf("%s: expected an inactive viewer, got active=%d role=%s", e.name, u.Active, u.Role)
+		}
+
+		sent, _ := os.ReadDir(outbox)
+		if len(sent) != e.expectedMails {
+			t.Errorf("%s: expected %d emails, got %d", e.name, e.expectedMails, len(sent))
+		}
+	}
+}
+
+func TestApplication_VerifyEmail(t *testing.T) {
+	var tests = []struct {
+		name         string
+		token        string
+		expectedCode int
+		expectActive bool
+	}{
+		{"verification token", "verify-token", http.StatusAccepted, true},
+		{"password reset token", "reset-token", http.StatusBadRequest, false},
+		{"unknown token", "other-token", http.StatusBadRequest, false},
+	}
+
+	for _, e := range tests {
+		users := map[string]*data.User{"jane@here.com": {ID: 2, Email: "jane@here.com", Active: 0}}
+
+		app := testApp
+		app.models.User = stubUserRepository{users: users}
+		app.models.OneTimeToken = stubOneTimeTokenRepository{tokens: map[string]stubOneTimeToken{
+			"verify-token": {data.ScopeVerifyEmail, 2},
+			"reset-token":  {data.ScopePasswordReset, 2},
+		}}
+
+		req, _ := http.NewRequest("POST", "/users/verify-email", strings.NewReader(fmt.Sprintf(`{"token": %q}`, e.token)))
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(app.VerifyEmail)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected status %d, got %d", e.name, e.expectedCode, rr.Code)
+		}
+
+		if active := users["jane@here.com"].Active == 1; active != e.expectActive {
+			t.Errorf("%s: expected active %v, got %v", e.name, e.expectActive, active)
+		}
+	}
+}
+
+func TestApplication_Login(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("password1"), bcrypt.MinCost)
+	lockedUntil := time.Now().Add(time.Minute)
+	expired := time.Now().Add(-time.Minute)
+
+	var tests = []struct {
+		name             string
+		user             data.User
+		password         string
+		expectedCode     int
+		expectedFailures int
+	}{
+		{"valid password", data.User{}, "password1", http.StatusOK, 0},
+		{"wrong password", data.User{FailedLogins: 2}, "password2", http.StatusUnauthorized, 3},
+		{"valid password clears failures", data.User{FailedLogins: 2}, "password1", http.StatusOK, 0},
+		{"locked account", data.User{FailedLogins: 10, LockedUntil: &lockedUntil}, "password1", http.StatusUnauthorized, 10},
+		{"lock has expired", data.User{FailedLogins: 10, LockedUntil: &expired}, "password1", http.StatusOK, 0},
+	}
+
+	for _, e := range tests {
+		user := e.user
+		user.ID, user.Email, user.Password, user.Active = 1, "me@here.com", string(hash), 1
+
+		failures := map[int]int{}
+		if user.FailedLogins > 0 {
+			failures[1] = user.FailedLogins
+		}
+
+		app := testApp
+		app.models.User = stubUserRepository{users: map[string]*data.User{user.Email: &user}, failures: failures}
+		app.models.Token = stubTokenRepository{}
+
+		req, _ := http.NewRequest("POST", "/users/login", strings.NewReader(fmt.Sprintf(`{"email": "me@here.com", "password": %q}`, e.password)))
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(app.Login)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected status %d, got %d", e.name, e.expectedCode, rr.Code)
+		}
+
+		if failures[1] != e.expectedFailures {
+			t.Errorf("%s: expected %d failed logins, got %d", e.name, e.expectedFailures, failures[1])
+		}
+
+		if rr.Header().Get("Retry-After") != "" {
+			t.Errorf("%s: expected no Retry-After header", e.name)
+		}
+	}
+
+	// an unknown email gets the same answer as a locked account
+	app := testApp
+	app.models.User = stubUserRepository{users: map[string]*data.User{}}
+
+	req, _ := http.NewRequest("POST", "/users/login", strings.NewReader(`{"email": "nobody@here.com", "password": "password1"}`))
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(app.Login)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusUnauthorized || !strings.Contains(rr.Body.String(), "invalid credentials") {
+		t.Errorf("unknown email: expected status %d with invalid credentials, got %d: %s", http.StatusUnauthorized, rr.Code, rr.Body.String())
+	}
+}
+
+func TestApplication_EditUser_deactivate(t *testing.T) {
+	var tests = []struct {
+		name          string
+		active        int
+		expectRevoked bool
+	}{
+		{"deactivated", 0, true},
+		{"still active", 1, false},
+	}
+
+	for _, e := range tests {
+		var revoked []int
+		var events []data.AuditEvent
+
+		app := testApp
+		app.models.User = stubUserRepository{users: map[string]*data.User{
+			"jack@here.com": {ID: 7, Email: "jack@here.com", Active: 1, Role: data.RoleEditor},
+		}}
+		app.models.Token = stubTokenRepository{revoked: &revoked}
+		app.models.Audit = stubAuditRepository{events: &events}
+
+		body := fmt.Sprintf(`{"id": 7, "email": "jack@here.com", "first_name": "Jack", "last_name": "Smith", "active": %d}`, e.active)
+		req, _ := http.NewRequest("POST", "/admin/users/save", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(app.EditUser)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusAccepted {
+			t.Errorf("%s: expected status %d, got %d: %s", e.name, http.StatusAccepted, rr.Code, rr.Body.String())
+			continue
+		}
+
+		if e.expectRevoked && (len(revoked) != 1 || revoked[0] != 7) {
+			t.Errorf("%s: expected user 7's sessions revoked, got %v", e.name, revoked)
+		}
+		if !e.expectRevoked && len(revoked) != 0 {
+			t.Errorf("%s: expected no sessions revoked, got %v", e.name, revoked)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
 )
 
@@ -53,3 +54,45 @@ func Test_writeJSON(t *testing.T) {
 		t.Log(err)
 	}
 }
+
+func Test_readPage(t *testing.T) {
+	var tests = []struct {
+		name             string
+		query            string
+		expectedPage     int
+		expectedPageSize int
+		expectErr        bool
+	}{
+		{"defaults", "", 1, defaultPageSize, false},
+		{"explicit", "page=3&page_size=50", 3, 50, false},
+		{"not a number", "page=abc", 0, 0, true},
+		{"page zero", "page=0", 0, 0, true},
+		{"page size too big", "page_size=1000", 0, 0, true},
+	}
+
+	for _, e := range tests {
+		qs, _ := url.ParseQuery(e.query)
+
+		page, pageSize, err := testApp.readPage(qs)
+		if (err != nil) != e.expectErr {
+			t.Errorf("%s: unexpected error value %v", e.name, err)
+			continue
+		}
+
+		if page != e.expectedPage || pageSize != e.expectedPageSize {
+			t.Errorf("%s: expected page %d size %d, got %d size %d", e.name, e.expectedPage, e.expectedPageSize, page, pageSize)
+		}
+	}
+}
+
+func Test_calculateMetadata(t *testing.T) {
+	m := calculateMetadata(41, 2, 20)
+	if m.LastPage != 3 {
+		t.Errorf("expected last page 3, got %d", m.LastPage)
+	}
+
+	m = calculateMetadata(0, 1, 20)
+	if m.LastPage != 0 {
+		t.Errorf("expected last page 0 for no records, got %d", m.LastPage)
+	}
+}
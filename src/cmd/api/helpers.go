@@ -3,11 +3,40 @@ package main
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 )
 
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+type metadata struct {
+	CurrentPage  int `json:"current_page"`
+	PageSize     int `json:"page_size"`
+	LastPage     int `json:"last_page"`
+	TotalRecords int `json:"total_records"`
+}
+
+func calculateMetadata(totalRecords, page, pageSize int) metadata {
+	if pageSize < 1 {
+		return metadata{CurrentPage: page, TotalRecords: totalRecords}
+	}
+
+	return metadata{
+		CurrentPage:  page,
+		PageSize:     pageSize,
+		LastPage:     (totalRecords + pageSize - 1) / pageSize,
+		TotalRecords: totalRecords,
+	}
+}
+
 func (app *application) readJSON(w http.ResponseWriter, r *http.Request, data interface{}) error {
 	maxBytes := 1048576 // 1MB
 	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
@@ -92,3 +121,84 @@ func (app *application) errorJSON(w http.ResponseWriter, err error, status ...in
 
 	app.writeJSON(w, statusCode, payload)
 }
+
+// readInt returns the integer query parameter key, or def when it is absent.
+func (app *application) readInt(qs url.Values, key string, def int) (int, error) {
+	s := qs.Get(key)
+	if s == "" {
+		return def, nil
+	}
+
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be an integer", key)
+	}
+
+	return i, nil
+}
+
+// readPage reads and bounds the page and page_size query parameters.
+func (app *application) readPage(qs url.Values) (int, int, error) {
+	page, err := app.readInt(qs, "page", 1)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	pageSize, err := app.readInt(qs, "page_size", defaultPageSize)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if page < 1 {
+		return 0, 0, errors.New("page must be at least 1")
+	}
+
+	if pageSize < 1 || pageSize > maxPageSize {
+		return 0, 0, fmt.Errorf("page_size must be between 1 and %d", maxPageSize)
+	}
+
+	return page, pageSize, nil
+}
+
+// paginationLinks builds a Link header pointing at the first, previous, next
+// and last pages of the current request, keeping its other query parameters.
+func paginationLinks(r *http.Request, meta metadata) http.Header {
+	var links []string
+
+	link := func(page int, rel string) {
+		u := *r.URL
+		qs := u.Query()
+		qs.Set("page", strconv.Itoa(page))
+		qs.Set("page_size", strconv.Itoa(meta.PageSize))
+		u.RawQuery = qs.Encode()
+		links = append(links, fmt.Sprintf(`<%s>; rel="%s"`, u.RequestURI(), rel))
+	}
+
+	if meta.LastPage == 0 {
+		return nil
+	}
+
+	link(1, "first")
+	if meta.CurrentPage > 1 && meta.CurrentPage <= meta.LastPage {
+		link(meta.CurrentPage-1, "prev")
+	}
+	if meta.CurrentPage < meta.LastPage {
+		link(meta.CurrentPage+1, "next")
+	}
+	link(meta.LastPage, "last")
+
+	headers := make(http.Header)
+	headers.Set("Link", strings.Join(links, ", "))
+
+	return headers
+}
+
+// clientIP returns the host part of the request's remote address.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"literal/internal/catalog"
+	"literal/internal/data"
+)
+
+// importMaxBytes bounds an import file, which can be far larger than the
+// JSON bodies readJSON accepts.
+const importMaxBytes = 20 << 20
+
+// ImportBooks adds books in bulk from a CSV or JSON lines body, creating any
+// authors and genres that don't exist yet. The format comes from the format
+// parameter or else the Content-Type. dry_run=true reports what would happen
+// without saving anything, and existing=skip leaves books that are already in
+// the catalog alone instead of updating them.
+func (app *application) ImportBooks(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	format := qs.Get("format")
+	if format == "" {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		format = catalog.FormatFor(mediaType)
+	}
+	if format != catalog.FormatCSV && format != catalog.FormatJSON {
+		app.errorJSON(w, catalog.ErrUnknownFormat, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var opts data.ImportOptions
+	if v := qs.Get("dry_run"); v != "" {
+		dryRun, err := strconv.ParseBool(v)
+		if err != nil {
+			app.errorJSON(w, errors.New("dry_run must be true or false"))
+			return
+		}
+		opts.DryRun = dryRun
+	}
+
+	switch qs.Get("existing") {
+	case "", "update":
+	case "skip":
+		opts.SkipExisting = true
+	default:
+		app.errorJSON(w, errors.New("existing must be update or skip"))
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, importMaxBytes)
+
+	rows, err := catalog.Read(r.Body, format)
+	if err != nil {
+		if errors.As(err, new(*http.MaxBytesError)) {
+			app.errorJSON(w, fmt.Errorf("import files are limited to %d MB", importMaxBytes>>20), http.StatusRequestEntityTooLarge)
+			return
+		}
+		app.errorJSON(w, err)
+		return
+	}
+
+	if len(rows) == 0 {
+		app.errorJSON(w, errors.New("the file has no books in it"))
+		return
+	}
+
+	report, err := app.models.Book.Import(r.Context(), rows, opts)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	if !opts.DryRun && report.Created+report.Updated > 0 {
+		app.audit(r, "book.import", "book", 0, nil, envelope{
+			"created": report.Created,
+			"updated": report.Updated,
+			"skipped": report.Skipped,
+			"failed":  report.Failed,
+		})
+	}
+
+	message := fmt.Sprintf("%d created, %d updated, %d skipped, %d failed",
+		report.Created, report.Updated, report.Skipped, report.Failed)
+	if opts.DryRun {
+		message = "Dry run: " + message
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: message,
+		Data:    report,
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, payload)
+}
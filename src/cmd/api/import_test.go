@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"literal/internal/data"
+)
+
+type stubImportBookRepository struct {
+	stubBookRepository
+	rows *[]data.ImportRow
+	opts *data.ImportOptions
+}
+
+func (s stubImportBookRepository) Import(ctx context.Context, rows []data.ImportRow, opts data.ImportOptions) (*data.ImportReport, error) {
+	*s.rows = rows
+	*s.opts = opts
+
+	report := &data.ImportReport{DryRun: opts.DryRun}
+	for _, row := range rows {
+		report.Created++
+		report.Rows = append(report.Rows, data.ImportResult{Line: row.Line, Status: data.ImportCreated})
+	}
+
+	return report, nil
+}
+
+func TestApplication_ImportBooks(t *testing.T) {
+	csvBody := "title,author,year\nDune,Frank Herbert,1965\nEmma,Jane Austen,1815\n"
+	jsonBody := `{"title": "Dune", "author": "Frank Herbert"}` + "\n"
+
+	var tests = []struct {
+		name           string
+		query          string
+		contentType    string
+		body           string
+		expectedCode   int
+		expectedRows   int
+		expectedOpts   data.ImportOptions
+		expectedEvents int
+	}{
+		{"csv", "", "text/csv; charset=utf-8", csvBody, http.StatusOK, 2, data.ImportOptions{}, 1},
+		{"json lines by parameter", "?format=json", "text/plain", jsonBody, http.StatusOK, 1, data.ImportOptions{}, 1},
+		{"dry run", "?dry_run=true&existing=skip", "text/csv", csvBody, http.StatusOK, 2, data.ImportOptions{DryRun: true, SkipExisting: true}, 0},
+		{"unknown format", "", "text/plain", csvBody, http.StatusUnsupportedMediaType, 0, data.ImportOptions{}, 0},
+		{"bad existing", "?existing=replace", "text/csv", csvBody, http.StatusBadRequest, 0, data.ImportOptions{}, 0},
+		{"bad header", "", "text/csv", "name,year\nDune,1965\n", http.StatusBadRequest, 0, data.ImportOptions{}, 0},
+		{"no books", "", "text/csv", "title,author\n", http.StatusBadRequest, 0, data.ImportOptions{}, 0},
+	}
+
+	for _, e := range tests {
+		var rows []data.ImportRow
+		var opts data.ImportOptions
+		var events []data.AuditEvent
+
+		app := testApp
+		app.models.Book = stubImportBookRepository{rows: &rows, opts: &opts}
+		app.models.Audit = stubAuditRepository{events: &events}
+
+		req, _ := http.NewRequest("POST", "/admin/books/import"+e.query, strings.NewReader(e.body))
+		req.Header.Set("Content-Type", e.contentType)
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(app.ImportBooks)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected status %d, got %d: %s", e.name, e.expectedCode, rr.Code, rr.Body.String())
+			continue
+		}
+
+		if len(rows) != e.expectedRows {
+			t.Errorf("%s: expected %d rows to be imported, got %d", e.name, e.expectedRows, len(rows))
+		}
+
+		if opts != e.expectedOpts {
+			t.Errorf("%s: expected options %+v, got %+v", e.name, e.expectedOpts, opts)
+		}
+
+		if len(events) != e.expectedEvents {
+			t.Errorf("%s: expected %d audit events, got %d", e.name, e.expectedEvents, len(events))
+		}
+	}
+}
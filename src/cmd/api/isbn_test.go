@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"literal/internal/data"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type stubISBNBookRepository struct {
+	stubBookRepository
+	saved *data.Book
+}
+
+func (s stubISBNBookRepository) GetBookById(ctx context.Context, id int) (*data.Book, error) {
+	for _, b := range s.books {
+		if b.ID == id {
+			return b, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s stubISBNBookRepository) GetBookByISBN(ctx context.Context, isbn13 string) (*data.Book, error) {
+	for _, b := range s.books {
+		if b.ISBN13 == isbn13 {
+			return b, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s stubISBNBookRepository) Insert(ctx context.Context, book data.Book) (int, error) {
+	*s.saved = book
+	return 42, nil
+}
+
+func (s stubISBNBookRepository) Update(ctx context.Context, book data.Book) error {
+	*s.saved = book
+	return nil
+}
+
+var isbnBooks = []*data.Book{
+	{ID: 1, Title: "Dune", Slug: "dune", ISBN10: "0441172717", ISBN13: "9780441172719"},
+	{ID: 2, Title: "Emma", Slug: "emma"},
+}
+
+func TestApplication_BookByISBN(t *testing.T) {
+	app := testApp
+	app.models.Book = stubISBNBookRepository{stubBookRepository: stubBookRepository{books: isbnBooks}}
+
+	mux := chi.NewRouter()
+	mux.Get("/books/isbn/{isbn}", app.BookByISBN)
+
+	var tests = []struct {
+		name         string
+		isbn         string
+		expectedCode int
+		expectedBody string
+	}{
+		{"isbn-13", "978-0-441-17271-9", http.StatusOK, `"dune"`},
+		{"isbn-10", "0441172717", http.StatusOK, `"dune"`},
+		{"unknown", "9780140449136", http.StatusNotFound, "no book has that ISBN"},
+		{"bad check digit", "9780441172710", http.StatusBadRequest, "check digit"},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/books/isbn/"+e.isbn, nil)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected status %d, got %d: %s", e.name, e.expectedCode, rr.Code, rr.Body.String())
+			continue
+		}
+
+		if !strings.Contains(rr.Body.String(), e.expectedBody) {
+			t.Errorf("%s: expected body to contain %s, got %s", e.name, e.expectedBody, rr.Body.String())
+		}
+	}
+}
+
+func TestApplication_EditBook_isbn(t *testing.T) {
+	var tests = []struct {
+		name         string
+		body         string
+		expectedCode int
+		expectedBody string
+		expected10   string
+		expected13   string
+	}{
+		{"new book with isbn-10", `{"title": "Republic", "isbn_10": "0-14-044913-2"}`, http.StatusAccepted, "", "0140449132", "9780140449136"},
+		{"new book with isbn-13", `{"title": "Republic", "isbn_13": "9780140449136"}`, http.StatusAccepted, "", "0140449132", "9780140449136"},
+		{"979 isbn", `{"title": "Republic", "isbn_13": "979-10-90636-07-1"}`, http.StatusAccepted, "", "", "9791090636071"},
+		{"both forms agree", `{"title": "Republic", "isbn_10": "0140449132", "isbn_13": "9780140449136"}`, http.StatusAccepted, "", "0140449132", "9780140449136"},
+		{"forms disagree", `{"title": "Republic", "isbn_10": "0441172717", "isbn_13": "9780140449136"}`, http.StatusBadRequest, "different books", "", ""},
+		{"bad check digit", `{"title": "Republic", "isbn_13": "9780140449137"}`, http.StatusBadRequest, "isbn_13: isbn: check digit", "", ""},
+		{"isbn-13 as isbn-10", `{"title": "Republic", "isbn_10": "9780140449136"}`, http.StatusBadRequest, "isbn_10", "", ""},
+		{"duplicate of another book", `{"title": "Dune again", "isbn_10": "0441172717"}`, http.StatusConflict, `"dune"`, "", ""},
+		{"duplicate on update", `{"id": 2, "title": "Emma", "isbn_13": "9780441172719"}`, http.StatusConflict, `already used by \"Dune\"`, "", ""},
+		{"same book keeps its isbn", `{"id": 1, "title": "Dune", "isbn_13": "9780441172719"}`, http.StatusAccepted, "", "0441172717", "9780441172719"},
+		{"update without isbn leaves it", `{"id": 1, "title": "Dune"}`, http.StatusAccepted, "", "0441172717", "9780441172719"},
+		{"empty isbn clears it", `{"id": 1, "title": "Dune", "isbn_13": ""}`, http.StatusAccepted, "", "", ""},
+	}
+
+	for _, e := range tests {
+		var saved data.Book
+		var events []data.AuditEvent
+
+		app := testApp
+		app.models.Book = stubISBNBookRepository{stubBookRepository: stubBookRepository{books: isbnBooks}, saved: &saved}
+		app.models.Audit = stubAuditRepository{events: &events}
+
+		req, _ := http.NewRequest("POST", "/admin/books/save", strings.NewReader(e.body))
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(app.EditBook)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected status %d, got %d: %s", e.name, e.expectedCode, rr.Code, rr.Body.String())
+			continue
+		}
+
+		if !strings.Contains(rr.Body.String(), e.expectedBody) {
+			t.Errorf("%s: expected body to contain %s, got %s", e.name, e.expectedBody, rr.Body.String())
+		}
+
+		if rr.Code != http.StatusAccepted {
+			if saved.Title != "" {
+				t.Errorf("%s: expected the book not to be saved", e.name)
+			}
+			continue
+		}
+
+		if saved.ISBN10 != e.expected10 || saved.ISBN13 != e.expected13 {
+			t.Errorf("%s: expected ISBNs %q and %q, got %q and %q", e.name, e.expected10, e.expected13, saved.ISBN10, saved.ISBN13)
+		}
+	}
+}
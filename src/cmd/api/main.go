@@ -1,13 +1,26 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"literal/internal/data"
 	"literal/internal/driver"
+	"literal/internal/enrich"
+	"literal/internal/imaging"
+	"literal/internal/mailer"
+	"literal/internal/storage"
 
 	_ "github.com/jackc/pgconn"
 	_ "github.com/jackc/pgx/v4"
@@ -15,7 +28,26 @@ import (
 )
 
 type config struct {
-	port int
+	port            int
+	dbTimeout       time.Duration
+	accessTokenTTL  time.Duration
+	refreshTokenTTL time.Duration
+	slidingSessions bool
+	resetTokenTTL   time.Duration
+	verifyTokenTTL  time.Duration
+	frontendURL     string
+	smtp            struct {
+		host     string
+		port     int
+		username string
+		password string
+	}
+	mailFrom string
+
+	loginPolicy    data.LoginPolicy
+	loginRateLimit int
+
+	coverLimits imaging.Limits
 }
 
 type application struct {
@@ -23,16 +55,92 @@ type application struct {
 	infoLog     *log.Logger
 	errorLog    *log.Logger
 	models      data.Models
+	mailer      mailer.Mailer
+	covers      storage.CoverStore
+	metadata    enrich.MetadataProvider
+	loginLimit  *rateLimiter
 	environment string
+	wg          *sync.WaitGroup
 }
 
 func main() {
 	var cfg config
 	cfg.port = 8081
+	cfg.dbTimeout = 3 * time.Second
+	// the bundled client never calls /users/refresh, so access tokens last a
+	// day unless ACCESS_TOKEN_TTL asks for less
+	cfg.accessTokenTTL = 24 * time.Hour
+	cfg.refreshTokenTTL = 30 * 24 * time.Hour
+	cfg.resetTokenTTL = time.Hour
+	cfg.verifyTokenTTL = 48 * time.Hour
+	cfg.frontendURL = "http://localhost:8080"
+	cfg.smtp.port = 25
+	cfg.mailFrom = "Literal <no-reply@localhost>"
+	cfg.loginPolicy = data.DefaultLoginPolicy
+	cfg.loginRateLimit = 20
+	cfg.coverLimits = imaging.DefaultLimits
 
 	infoLog := log.New(os.Stdout, "INFO: ", log.Ldate|log.Ltime)
 	errorLog := log.New(os.Stderr, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile)
 
+	for _, setting := range []struct {
+		env string
+		dst *time.Duration
+	}{
+		{"DB_TIMEOUT", &cfg.dbTimeout},
+		{"ACCESS_TOKEN_TTL", &cfg.accessTokenTTL},
+		{"REFRESH_TOKEN_TTL", &cfg.refreshTokenTTL},
+		{"PASSWORD_RESET_TTL", &cfg.resetTokenTTL},
+		{"EMAIL_VERIFY_TTL", &cfg.verifyTokenTTL},
+	} {
+		if v := os.Getenv(setting.env); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				errorLog.Fatalf("invalid %s %q: %v", setting.env, v, err)
+			}
+			*setting.dst = d
+		}
+	}
+
+	// with sliding sessions, access tokens stay alive for as long as they are
+	// used, so clients that never call /users/refresh are not logged out
+	cfg.slidingSessions = os.Getenv("SLIDING_SESSIONS") == "true"
+
+	if v := os.Getenv("FRONTEND_URL"); v != "" {
+		cfg.frontendURL = strings.TrimSuffix(v, "/")
+	}
+
+	cfg.smtp.host = os.Getenv("SMTP_HOST")
+	cfg.smtp.username = os.Getenv("SMTP_USERNAME")
+	cfg.smtp.password = os.Getenv("SMTP_PASSWORD")
+	if v := os.Getenv("SMTP_PORT"); v != "" {
+		port, err := strconv.Atoi(v)
+		if err != nil {
+			errorLog.Fatalf("invalid SMTP_PORT %q: %v", v, err)
+		}
+		cfg.smtp.port = port
+	}
+	if v := os.Getenv("MAIL_FROM"); v != "" {
+		cfg.mailFrom = v
+	}
+
+	if v := os.Getenv("COVER_MAX_BYTES"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 1 {
+			errorLog.Fatalf("invalid COVER_MAX_BYTES %q", v)
+		}
+		cfg.coverLimits.MaxBytes = n
+	}
+
+	// login attempts allowed per client IP per minute; 0 turns the limit off
+	if v := os.Getenv("LOGIN_RATE_LIMIT"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			errorLog.Fatalf("invalid LOGIN_RATE_LIMIT %q", v)
+		}
+		cfg.loginRateLimit = n
+	}
+
 	dsn := os.Getenv("DSN")
 	environment := os.Getenv("ENV")
 	db, err := driver.ConnectPostgres(dsn)
@@ -41,12 +149,47 @@ func main() {
 	}
 	defer db.SQL.Close()
 
+	models := data.NewWithTimeout(db.SQL, cfg.dbTimeout)
+	if cfg.slidingSessions {
+		models.Token = data.TokenModel{DB: db.SQL, Timeout: cfg.dbTimeout, SlidingExpiry: cfg.accessTokenTTL}
+	}
+
+	// without an SMTP server, mail is written to ./outbox for local development
+	var mail mailer.Mailer = mailer.FileOutbox{Dir: "./outbox", From: cfg.mailFrom}
+	if cfg.smtp.host != "" {
+		mail = mailer.SMTP{
+			Host:     cfg.smtp.host,
+			Port:     cfg.smtp.port,
+			Username: cfg.smtp.username,
+			Password: cfg.smtp.password,
+			From:     cfg.mailFrom,
+		}
+	}
+
+	covers, err := coverStoreFromEnv()
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	books, err := metadataFromEnv()
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
 	app := &application{
 		config:      cfg,
 		infoLog:     infoLog,
 		errorLog:    errorLog,
-		models:      data.New(db.SQL),
+		models:      models,
+		mailer:      mail,
+		covers:      covers,
+		metadata:    books,
 		environment: environment,
+		wg:          &sync.WaitGroup{},
+	}
+
+	if cfg.loginRateLimit > 0 {
+		app.loginLimit = newRateLimiter(cfg.loginRateLimit)
 	}
 
 	err = app.serve()
@@ -55,12 +198,81 @@ func main() {
 	}
 }
 
+// serve runs the server until SIGINT or SIGTERM. Request contexts derive from
+// a base context that is cancelled on shutdown, so queries still running for
+// in-flight requests are abandoned rather than left to hit their deadline.
 func (app *application) serve() error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	app.infoLog.Println("Listening on port", app.config.port)
 	serve := &http.Server{
 		Addr:    fmt.Sprintf(":%d", app.config.port),
 		Handler: app.routes(),
+		BaseContext: func(net.Listener) context.Context {
+			return ctx
+		},
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- serve.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	app.infoLog.Println("Shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := serve.Shutdown(shutdownCtx)
+	if err != nil {
+		return err
+	}
+
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return err
 	}
 
-	return serve.ListenAndServe()
+	app.infoLog.Println("Waiting for background tasks")
+	app.wg.Wait()
+
+	return nil
+}
+
+// sendEmail delivers msg in the background. Sending after the response means
+// a slow mail server neither holds up the request nor gives away, through
+// timing, whether an address has an account.
+func (app *application) sendEmail(msg mailer.Message) {
+	app.background(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		err := app.mailer.Send(ctx, msg)
+		if err != nil {
+			app.errorLog.Printf("sending %q to %s: %v", msg.Subject, msg.To, err)
+		}
+	})
+}
+
+// background runs fn outside the request, logging rather than crashing on a
+// panic. serve waits for these to finish before it returns.
+func (app *application) background(fn func()) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+		defer func() {
+			if err := recover(); err != nil {
+				app.errorLog.Println(fmt.Errorf("%v", err))
+			}
+		}()
+
+		fn()
+	}()
 }
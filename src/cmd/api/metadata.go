@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"literal/internal/data"
+	"literal/internal/enrich"
+	"literal/internal/imaging"
+	"literal/internal/isbn"
+
+	"github.com/mozillazg/go-slugify"
+)
+
+// metadataFromEnv picks the provider books are looked up in. Answers are
+// cached, since librarians tend to look the same book up more than once
+// while editing it.
+func metadataFromEnv() (enrich.MetadataProvider, error) {
+	ttl := 24 * time.Hour
+	if v := os.Getenv("METADATA_CACHE_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid METADATA_CACHE_TTL %q: %w", v, err)
+		}
+		ttl = d
+	}
+
+	// Open Library asks for a way to contact heavy users, which can go here
+	userAgent := os.Getenv("METADATA_USER_AGENT")
+	if userAgent == "" {
+		userAgent = "Literal"
+	}
+
+	switch kind := os.Getenv("METADATA_PROVIDER"); kind {
+	case "", "openlibrary":
+		p := enrich.OpenLibrary{
+			BaseURL:   os.Getenv("OPENLIBRARY_URL"),
+			CoversURL: os.Getenv("OPENLIBRARY_COVERS_URL"),
+			UserAgent: userAgent,
+			Client:    &http.Client{Timeout: 10 * time.Second},
+		}
+		return enrich.NewCache(p, ttl, 1000), nil
+	case "off":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown METADATA_PROVIDER %q", kind)
+	}
+}
+
+// proposedGenre is a subject the provider gave a book, matched to one of our
+// genres where possible. A subject with no matching genre has ID 0.
+type proposedGenre struct {
+	ID        int    `json:"id"`
+	GenreName string `json:"genre_name"`
+}
+
+// LookupBook proposes a book's details from the metadata provider, found by
+// ?isbn= or by ?title= and ?author=. Nothing is saved: the proposal is for an
+// admin to review, and apply through /admin/books/save.
+func (app *application) LookupBook(w http.ResponseWriter, r *http.Request) {
+	if app.metadata == nil {
+		app.errorJSON(w, errors.New("book lookups are turned off"), http.StatusNotImplemented)
+		return
+	}
+
+	qs := r.URL.Query()
+	q := enrich.Query{
+		Title:  strings.TrimSpace(qs.Get("title")),
+		Author: strings.TrimSpace(qs.Get("author")),
+	}
+
+	if s := qs.Get("isbn"); s != "" {
+		var err error
+		q.ISBN, _, err = isbn.Parse(s)
+		if err != nil {
+			app.errorJSON(w, err)
+			return
+		}
+	}
+
+	if q.ISBN == "" && q.Title == "" {
+		app.errorJSON(w, errors.New("isbn or title must be given"))
+		return
+	}
+
+	record, err := app.metadata.Lookup(r.Context(), q)
+	if err != nil {
+		if errors.Is(err, enrich.ErrNotFound) {
+			app.errorJSON(w, err, http.StatusNotFound)
+			return
+		}
+		app.errorLog.Println("looking up book:", err)
+		app.errorJSON(w, errors.New("the book catalog could not be reached"), http.StatusBadGateway)
+		return
+	}
+
+	book, genres, err := app.proposeBook(r, record)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	// a book we already have is better updated than added again
+	var existing *data.Book
+	if book.ISBN13 != "" {
+		existing, err = app.models.Book.GetBookByISBN(r.Context(), book.ISBN13)
+	} else {
+		existing, err = app.models.Book.GetBookBySlug(r.Context(), book.Slug)
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		app.errorJSON(w, err)
+		return
+	}
+
+	var existingID int
+	if existing != nil {
+		existingID = existing.ID
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "success",
+		Data: envelope{
+			"book":        book,
+			"genres":      genres,
+			"cover":       record.CoverURL,
+			"existing_id": existingID,
+			"source":      record.Source,
+			"source_url":  record.SourceURL,
+		},
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// proposeBook turns a provider's record into a Book, matching its authors
+// and its subjects to our authors and genres by name. An author we don't have
+// yet is proposed with AuthorID 0, to be added before saving.
+func (app *application) proposeBook(r *http.Request, record *enrich.Record) (data.Book, []proposedGenre, error) {
+	book := data.Book{
+		Title:           record.Title,
+		Slug:            slugify.Slugify(record.Title),
+		Description:     record.Description,
+		PublicationYear: record.PublicationYear,
+		ISBN10:          record.ISBN10,
+		ISBN13:          record.ISBN13,
+		GenreIDs:        []int{},
+	}
+
+	if len(record.Authors) > 0 {
+		authors, err := app.models.Author.GetAllAuthors(r.Context())
+		if err != nil {
+			return book, nil, err
+		}
+
+		byName := make(map[string]*data.Author, len(authors))
+		for _, a := range authors {
+			byName[strings.ToLower(a.AuthorName)] = a
+		}
+
+		book.Authors = make([]data.Contributor, 0, len(record.Authors))
+		for _, name := range record.Authors {
+			c := data.Contributor{AuthorName: name, Role: data.ContributorAuthor}
+			if a, ok := byName[strings.ToLower(name)]; ok {
+				c.AuthorID, c.AuthorName = a.ID, a.AuthorName
+			}
+			book.Authors = append(book.Authors, c)
+		}
+
+		book.AuthorID = book.Authors[0].AuthorID
+		book.Author = data.Author{ID: book.AuthorID, AuthorName: book.Authors[0].AuthorName}
+		if a, ok := byName[strings.ToLower(record.Authors[0])]; ok {
+			book.Author = *a
+		}
+	}
+
+	all, err := app.models.Genre.GetAll(r.Context())
+	if err != nil {
+		return book, nil, err
+	}
+
+	byName := make(map[string]*data.Genre, len(all))
+	for _, g := range all {
+		byName[strings.ToLower(g.GenreName)] = g
+	}
+
+	genres := []proposedGenre{}
+	seen := make(map[string]bool)
+	for _, subject := range record.Subjects {
+		name := strings.TrimSpace(subject)
+		if name == "" || seen[strings.ToLower(name)] {
+			continue
+		}
+		seen[strings.ToLower(name)] = true
+
+		g, ok := byName[strings.ToLower(name)]
+		if !ok {
+			genres = append(genres, proposedGenre{GenreName: name})
+			continue
+		}
+
+		genres = append(genres, proposedGenre{ID: g.ID, GenreName: g.GenreName})
+		book.Genres = append(book.Genres, *g)
+		book.GenreIDs = append(book.GenreIDs, g.ID)
+	}
+
+	return book, genres, nil
+}
+
+// fetchCover downloads a cover proposed by LookupBook, so saving a book can
+// apply it, and checks it like an uploaded one.
+func (app *application) fetchCover(ctx context.Context, url string) (*imaging.Result, error) {
+	if app.metadata == nil {
+		return nil, errors.New("book lookups are turned off")
+	}
+
+	cover, err := app.metadata.FetchCover(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("fetching cover: %w", err)
+	}
+	defer cover.Close()
+
+	return imaging.Process(cover, app.config.coverLimits, imaging.DefaultSizes)
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"literal/internal/data"
+	"literal/internal/enrich"
+	"literal/internal/storage"
+)
+
+type stubMetadataProvider struct {
+	record *enrich.Record
+	err    error
+	cover  []byte
+}
+
+func (s stubMetadataProvider) Lookup(ctx context.Context, q enrich.Query) (*enrich.Record, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.record, nil
+}
+
+func (s stubMetadataProvider) FetchCover(ctx context.Context, url string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(url, "https://covers.example.com/") {
+		return nil, enrich.ErrForeignCover
+	}
+	return io.NopCloser(bytes.NewReader(s.cover)), nil
+}
+
+type stubLookupBookRepository struct {
+	stubISBNBookRepository
+}
+
+func (s stubLookupBookRepository) GetBookBySlug(ctx context.Context, slug string) (*data.Book, error) {
+	for _, b := range s.books {
+		if b.Slug == slug {
+			return b, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+type stubLookupAuthorRepository struct {
+	data.AuthorRepository
+}
+
+func (s stubLookupAuthorRepository) GetAllAuthors(ctx context.Context) ([]*data.Author, error) {
+	return []*data.Author{{ID: 7, AuthorName: "Frank Herbert"}}, nil
+}
+
+func TestApplication_LookupBook(t *testing.T) {
+	dune := &enrich.Record{
+		Source:          "Open Library",
+		Title:           "Dune",
+		Authors:         []string{"frank herbert"},
+		Description:     "Set on the desert planet Arrakis.",
+		PublicationYear: 1965,
+		ISBN10:          "0441172717",
+		ISBN13:          "9780441172719",
+		Subjects:        []string{"Science Fiction", "Ecology", "science fiction"},
+		CoverURL:        "https://covers.example.com/b/id/1-L.jpg",
+	}
+	emma := &enrich.Record{Source: "Open Library", Title: "Emma", Authors: []string{"Jane Austen"}}
+
+	var tests = []struct {
+		name           string
+		query          string
+		record         *enrich.Record
+		err            error
+		expectedCode   int
+		expectedAuthor int
+		expectedGenres []proposedGenre
+		expectedID     int
+	}{
+		{"by isbn", "?isbn=0-441-17271-7", dune, nil, http.StatusOK, 7,
+			[]proposedGenre{{ID: 3, GenreName: "Science Fiction"}, {GenreName: "Ecology"}}, 1},
+		{"by title, new author", "?title=emma", emma, nil, http.StatusOK, 0, []proposedGenre{}, 2},
+		{"no match", "?title=nothing", nil, enrich.ErrNotFound, http.StatusNotFound, 0, nil, 0},
+		{"provider down", "?title=dune", nil, errors.New("connection refused"), http.StatusBadGateway, 0, nil, 0},
+		{"bad isbn", "?isbn=9780441172710", nil, nil, http.StatusBadRequest, 0, nil, 0},
+		{"no query", "?author=Herbert", nil, nil, http.StatusBadRequest, 0, nil, 0},
+	}
+
+	for _, e := range tests {
+		app := testApp
+		app.metadata = stubMetadataProvider{record: e.record, err: e.err}
+		app.models.Book = stubLookupBookRepository{stubISBNBookRepository{stubBookRepository: stubBookRepository{books: isbnBooks}}}
+		app.models.Author = stubLookupAuthorRepository{}
+		app.models.Genre = stubGenreRepository{genres: []*data.Genre{{ID: 3, GenreName: "Science Fiction"}}}
+
+		req, _ := http.NewRequest("GET", "/admin/books/lookup"+e.query, nil)
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(app.LookupBook)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected status %d, got %d: %s", e.name, e.expectedCode, rr.Code, rr.Body.String())
+			continue
+		}
+		if rr.Code != http.StatusOK {
+			continue
+		}
+
+		var resp struct {
+			Data struct {
+				Book       data.Book       `json:"book"`
+				Genres     []proposedGenre `json:"genres"`
+				Cover      string          `json:"cover"`
+				ExistingID int             `json:"existing_id"`
+			} `json:"data"`
+		}
+		err := json.Unmarshal(rr.Body.Bytes(), &resp)
+		if err != nil {
+			t.Errorf("%s: %v", e.name, err)
+			continue
+		}
+
+		if resp.Data.Book.Title != e.record.Title || resp.Data.Book.AuthorID != e.expectedAuthor {
+			t.Errorf("%s: unexpected book %+v", e.name, resp.Data.Book)
+		}
+		if resp.Data.Book.Author.AuthorName == "" {
+			t.Errorf("%s: expected the author's name to be proposed", e.name)
+		}
+		if len(resp.Data.Genres) != len(e.expectedGenres) {
+			t.Errorf("%s: expected genres %v, got %v", e.name, e.expectedGenres, resp.Data.Genres)
+		} else {
+			for i := range e.expectedGenres {
+				if resp.Data.Genres[i] != e.expectedGenres[i] {
+					t.Errorf("%s: expected genres %v, got %v", e.name, e.expectedGenres, resp.Data.Genres)
+					break
+				}
+			}
+		}
+		if resp.Data.Cover != e.record.CoverURL {
+			t.Errorf("%s: expected cover %q, got %q", e.name, e.record.CoverURL, resp.Data.Cover)
+		}
+		if resp.Data.ExistingID != e.expectedID {
+			t.Errorf("%s: expected existing book %d, got %d", e.name, e.expectedID, resp.Data.ExistingID)
+		}
+	}
+}
+
+func TestApplication_LookupBook_off(t *testing.T) {
+	app := testApp
+	app.metadata = nil
+
+	req, _ := http.NewRequest("GET", "/admin/books/lookup?title=dune", nil)
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(app.LookupBook)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotImplemented {
+		t.Errorf("expected status %d, got %d", http.StatusNotImplemented, rr.Code)
+	}
+}
+
+func TestApplication_EditBook_coverURL(t *testing.T) {
+	var cover bytes.Buffer
+	_ = png.Encode(&cover, image.NewNRGBA(image.Rect(0, 0, 400, 600)))
+
+	var tests = []struct {
+		name         string
+		url          string
+		expectedCode int
+	}{
+		{"proposed cover", "https://covers.example.com/b/id/1-L.jpg", http.StatusAccepted},
+		{"somewhere else", "http://169.254.169.254/latest/meta-data", http.StatusBadRequest},
+	}
+
+	for _, e := range tests {
+		var events []data.AuditEvent
+		covers := map[int]data.CoverRenditions{}
+
+		app := testApp
+		app.covers = storage.NewMemory()
+		app.metadata = stubMetadataProvider{cover: cover.Bytes()}
+		app.models.Book = stubCoverBookRepository{covers: covers}
+		app.models.Audit = stubAuditRepository{events: &events}
+
+		body := `{"title": "My Book", "author_id": 1, "cover_url": "` + e.url + `"}`
+		req, _ := http.NewRequest("POST", "/admin/books/save", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(app.EditBook)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected status %d, got %d: %s", e.name, e.expectedCode, rr.Code, rr.Body.String())
+			continue
+		}
+
+		if e.expectedCode == http.StatusAccepted && len(covers[42]) == 0 {
+			t.Errorf("%s: expected the cover to be stored", e.name)
+		}
+		if e.expectedCode != http.StatusAccepted && len(events) != 0 {
+			t.Errorf("%s: expected the book not to be saved", e.name)
+		}
+	}
+}
@@ -1,10 +1,31 @@
 package main
 
-import "net/http"
+import (
+	"context"
+	"net/http"
+
+	"literal/internal/data"
+)
+
+type contextKey string
+
+const userContextKey = contextKey("user")
+
+func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
+	ctx := context.WithValue(r.Context(), userContextKey, user)
+	return r.WithContext(ctx)
+}
+
+// contextGetUser returns the user stored by AuthTokenMiddleware, or nil on
+// routes it does not wrap.
+func (app *application) contextGetUser(r *http.Request) *data.User {
+	user, _ := r.Context().Value(userContextKey).(*data.User)
+	return user
+}
 
 func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		_, err := app.models.Token.AuthenticateToken(r)
+		user, err := app.models.Token.AuthenticateToken(r)
 		if err != nil {
 			payload := jsonResponse{
 				Error:   true,
@@ -14,6 +35,26 @@ func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
 			_ = app.writeJSON(w, http.StatusUnauthorized, payload)
 			return
 		}
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, app.contextSetUser(r, user))
 	})
 }
+
+// requirePermission rejects requests whose authenticated user's role does not
+// grant p. It must run after AuthTokenMiddleware.
+func (app *application) requirePermission(p data.Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := app.contextGetUser(r)
+			if user == nil || !user.Can(p) {
+				payload := jsonResponse{
+					Error:   true,
+					Message: "your role does not allow this action",
+				}
+
+				_ = app.writeJSON(w, http.StatusForbidden, payload)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
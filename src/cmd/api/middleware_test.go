@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"literal/internal/data"
+)
+
+func TestApplication_requirePermission(t *testing.T) {
+	var tests = []struct {
+		name         string
+		user         *data.User
+		permission   data.Permission
+		expectedCode int
+	}{
+		{"no user", nil, data.PermBooksRead, http.StatusForbidden},
+		{"viewer reads books", &data.User{Role: data.RoleViewer}, data.PermBooksRead, http.StatusOK},
+		{"viewer writes books", &data.User{Role: data.RoleViewer}, data.PermBooksWrite, http.StatusForbidden},
+		{"editor writes books", &data.User{Role: data.RoleEditor}, data.PermBooksWrite, http.StatusOK},
+		{"editor manages users", &data.User{Role: data.RoleEditor}, data.PermUsersWrite, http.StatusForbidden},
+		{"admin manages users", &data.User{Role: data.RoleAdmin}, data.PermUsersWrite, http.StatusOK},
+		{"unknown role", &data.User{Role: "owner"}, data.PermBooksRead, http.StatusForbidden},
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", "/admin/test", nil)
+		if e.user != nil {
+			req = testApp.contextSetUser(req, e.user)
+		}
+
+		rr := httptest.NewRecorder()
+		testApp.requirePermission(e.permission)(next).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected status %d, got %d", e.name, e.expectedCode, rr.Code)
+		}
+	}
+}
+
+func TestRateLimiter_allow(t *testing.T) {
+	now := time.Now()
+	limiter := newRateLimiter(3)
+	limiter.now = func() time.Time { return now }
+
+	var tests = []struct {
+		name    string
+		key     string
+		advance time.Duration
+		allowed bool
+	}{
+		{"first attempt", "10.0.0.1", 0, true},
+		{"second attempt", "10.0.0.1", 0, true},
+		{"third attempt", "10.0.0.1", 0, true},
+		{"burst used up", "10.0.0.1", 0, false},
+		{"other address", "10.0.0.2", 0, true},
+		{"too soon for a new token", "10.0.0.1", 10 * time.Second, false},
+		{"token earned back", "10.0.0.1", 10 * time.Second, true},
+		{"and spent again", "10.0.0.1", 0, false},
+	}
+
+	for _, e := range tests {
+		now = now.Add(e.advance)
+
+		allowed, wait := limiter.allow(e.key)
+		if allowed != e.allowed {
+			t.Errorf("%s: expected allowed %v, got %v", e.name, e.allowed, allowed)
+		}
+		if !allowed && wait <= 0 {
+			t.Errorf("%s: expected a wait when refused", e.name)
+		}
+	}
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"literal/internal/data"
+	"literal/internal/opds"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// opdsTitle names the catalog in feeds and in the OpenSearch description.
+const opdsTitle = "Literal"
+
+// opdsCatalog is one rendering of the OPDS catalog: OPDS 1.2 Atom under
+// /opds, or OPDS 2.0 JSON under /opds/v2. The feeds are the same in both.
+type opdsCatalog struct {
+	prefix string
+	json   bool
+}
+
+var (
+	opdsAtom = opdsCatalog{prefix: "/opds"}
+	opdsJSON = opdsCatalog{prefix: "/opds/v2", json: true}
+)
+
+// opdsRequest carries what a feed builder needs to make absolute links: the
+// API's own base URL, and the frontend's for links to book pages.
+type opdsRequest struct {
+	*http.Request
+	catalog  opdsCatalog
+	base     string
+	frontend string
+}
+
+// url returns the absolute URL of a path within the catalog.
+func (r opdsRequest) url(path string, qs url.Values) string {
+	u := r.base + r.catalog.prefix + path
+	if len(qs) > 0 {
+		u += "?" + qs.Encode()
+	}
+	return u
+}
+
+// opdsRoutes mounts the feeds of one rendering of the catalog.
+func (app *application) opdsRoutes(mux chi.Router, c opdsCatalog) {
+	mux.Get("/", app.opdsFeed(c, app.opdsRoot))
+	mux.Get("/books", app.opdsFeed(c, app.opdsBooks))
+	mux.Get("/new", app.opdsFeed(c, app.opdsNewBooks))
+	mux.Get("/genres", app.opdsFeed(c, app.opdsGenres))
+	mux.Get("/genres/{id}", app.opdsFeed(c, app.opdsGenreBooks))
+	mux.Get("/authors", app.opdsFeed(c, app.opdsAuthors))
+	mux.Get("/authors/{id}", app.opdsFeed(c, app.opdsAuthorBooks))
+	mux.Get("/search", app.opdsFeed(c, app.opdsSearch))
+}
+
+// opdsFeed turns a feed builder into a handler that writes the feed in c's
+// version, with the links every feed of the catalog carries.
+func (app *application) opdsFeed(c opdsCatalog, build func(opdsRequest) (*opds.Feed, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		or := opdsRequest{Request: r, catalog: c, base: requestBaseURL(r), frontend: app.config.frontendURL}
+
+		feed, err := build(or)
+		if err != nil {
+			// e-book readers show errors as they are, and don't read our JSON
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		feed.Links = append([]opds.Link{
+			{Rel: "self", Href: or.base + r.URL.RequestURI(), Kind: feed.Kind},
+			{Rel: "start", Href: or.url("", nil), Kind: opds.Navigation, Title: opdsTitle},
+			or.searchLink(),
+		}, feed.Links...)
+
+		if c.json {
+			w.Header().Set("Content-Type", opds.JSONType)
+			err = feed.WriteJSON(w)
+		} else {
+			contentType := opds.NavigationType
+			if feed.Kind == opds.Acquisition {
+				contentType = opds.AcquisitionType
+			}
+			w.Header().Set("Content-Type", contentType)
+			err = feed.WriteAtom(w, opdsTitle)
+		}
+		if err != nil {
+			app.errorLog.Println("writing OPDS feed:", err)
+		}
+	}
+}
+
+// searchLink points OPDS 1.2 readers at the OpenSearch description, and
+// OPDS 2.0 readers straight at a URI template.
+func (r opdsRequest) searchLink() opds.Link {
+	if r.catalog.json {
+		return opds.Link{Rel: "search", Href: r.url("/search", nil) + "{?query}", Type: opds.JSONType, Templated: true}
+	}
+	return opds.Link{Rel: "search", Href: r.url("/opensearch.xml", nil), Type: opds.OpenSearchType}
+}
+
+// OPDSOpenSearch describes the catalog's search for OPDS 1.2 readers.
+func (app *application) OPDSOpenSearch(w http.ResponseWriter, r *http.Request) {
+	or := opdsRequest{Request: r, catalog: opdsAtom, base: requestBaseURL(r)}
+
+	w.Header().Set("Content-Type", opds.OpenSearchType)
+	err := opds.WriteOpenSearch(w, opdsTitle, "Search the "+opdsTitle+" catalog by title, author or description",
+		or.url("/search", nil)+"?q={searchTerms}")
+	if err != nil {
+		app.errorLog.Println("writing OpenSearch description:", err)
+	}
+}
+
+func (app *application) opdsRoot(r opdsRequest) (*opds.Feed, error) {
+	return &opds.Feed{
+		ID:    "urn:literal:root",
+		Title: opdsTitle,
+		Kind:  opds.Navigation,
+		Navigation: []opds.NavigationEntry{
+			{ID: "urn:literal:books", Title: "All books", Href: r.url("/books", nil), Kind: opds.Acquisition},
+			{ID: "urn:literal:new", Title: "New books", Href: r.url("/new", nil), Kind: opds.Acquisition, Rel: opds.RelSortNew},
+			{ID: "urn:literal:genres", Title: "By genre", Href: r.url("/genres", nil), Kind: opds.Navigation},
+			{ID: "urn:literal:authors", Title: "By author", Href: r.url("/authors", nil), Kind: opds.Navigation},
+		},
+	}, nil
+}
+
+// opdsBooks lists the whole catalog by title. GetAllPaginated doesn't count
+// the books, so a full page is taken to mean there may be another.
+func (app *application) opdsBooks(r opdsRequest) (*opds.Feed, error) {
+	page, pageSize, err := app.readPage(r.URL.Query())
+	if err != nil {
+		return nil, err
+	}
+
+	books, err := app.models.Book.GetAllPaginated(r.Context(), page, pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	feed := r.acquisitionFeed("urn:literal:books", "All books", books)
+	feed.PerPage = pageSize
+	feed.Page = page
+	feed.Links = append(feed.Links, r.pageLinks(page, pageSize, 0, len(books) == pageSize)...)
+
+	return feed, nil
+}
+
+func (app *application) opdsNewBooks(r opdsRequest) (*opds.Feed, error) {
+	return app.opdsBookList(r, "urn:literal:new", "New books", data.BookFilter{Sort: "-created_at"})
+}
+
+func (app *application) opdsGenres(r opdsRequest) (*opds.Feed, error) {
+	genres, err := app.models.Genre.GetAll(r.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	feed := &opds.Feed{ID: "urn:literal:genres", Title: "By genre", Kind: opds.Navigation}
+	for _, g := range genres {
+		// an empty genre would only lead to an empty feed
+		if g.BookCount == 0 {
+			continue
+		}
+
+		feed.Navigation = append(feed.Navigation, opds.NavigationEntry{
+			ID:      fmt.Sprintf("urn:literal:genre:%d", g.ID),
+			Title:   g.GenreName,
+			Href:    r.url(fmt.Sprintf("/genres/%d", g.ID), nil),
+			Kind:    opds.Acquisition,
+			Count:   g.BookCount,
+			Updated: g.UpdatedAt,
+		})
+	}
+	feed.Links = append(feed.Links, opds.Link{Rel: "up", Href: r.url("", nil), Kind: opds.Navigation})
+
+	return feed, nil
+}
+
+func (app *application) opdsGenreBooks(r opdsRequest) (*opds.Feed, error) {
+	id, err := strconv.Atoi(chi.URLParam(r.Request, "id"))
+	if err != nil {
+		return nil, sql.ErrNoRows
+	}
+
+	genre, err := app.models.Genre.GetByID(r.Context(), id)
+	if err != nil {
+		return nil, err
+	}
+
+	feed, err := app.opdsBookList(r, fmt.Sprintf("urn:literal:genre:%d", id), genre.GenreName, data.BookFilter{GenreID: id})
+	if err != nil {
+		return nil, err
+	}
+	feed.Links = append(feed.Links, opds.Link{Rel: "up", Href: r.url("/genres", nil), Kind: opds.Navigation})
+
+	return feed, nil
+}
+
+func (app *application) opdsAuthors(r opdsRequest) (*opds.Feed, error) {
+	authors, err := app.models.Author.GetAllAuthors(r.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	feed := &opds.Feed{ID: "urn:literal:authors", Title: "By author", Kind: opds.Navigation}
+	for _, a := range authors {
+		feed.Navigation = append(feed.Navigation, opds.NavigationEntry{
+			ID:      fmt.Sprintf("urn:literal:author:%d", a.ID),
+			Title:   a.AuthorName,
+			Href:    r.url(fmt.Sprintf("/authors/%d", a.ID), nil),
+			Kind:    opds.Acquisition,
+			Updated: a.UpdatedAt,
+		})
+	}
+	feed.Links = append(feed.Links, opds.Link{Rel: "up", Href: r.url("", nil), Kind: opds.Navigation})
+
+	return feed, nil
+}
+
+func (app *application) opdsAuthorBooks(r opdsRequest) (*opds.Feed, error) {
+	id, err := strconv.Atoi(chi.URLParam(r.Request, "id"))
+	if err != nil {
+		return nil, sql.ErrNoRows
+	}
+
+	author, err := app.models.Author.GetByID(r.Context(), id)
+	if err != nil {
+		return nil, err
+	}
+
+	feed, err := app.opdsBookList(r, fmt.Sprintf("urn:literal:author:%d", id), author.AuthorName, data.BookFilter{AuthorID: id})
+	if err != nil {
+		return nil, err
+	}
+	feed.Links = append(feed.Links, opds.Link{Rel: "up", Href: r.url("/authors", nil), Kind: opds.Navigation})
+
+	return feed, nil
+}
+
+// opdsSearch takes the query as q, from the OpenSearch template, or query,
+// from the OPDS 2.0 one.
+func (app *application) opdsSearch(r opdsRequest) (*opds.Feed, error) {
+	qs := r.URL.Query()
+
+	q := strings.TrimSpace(qs.Get("q"))
+	if q == "" {
+		q = strings.TrimSpace(qs.Get("query"))
+	}
+	if q == "" {
+		return nil, errors.New("q must not be empty")
+	}
+
+	page, pageSize, err := app.readPage(qs)
+	if err != nil {
+		return nil, err
+	}
+
+	results, total, err := app.models.Book.Search(r.Context(), q, page, pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	books := make([]*data.Book, len(results))
+	for i := range results {
+		books[i] = &results[i].Book
+	}
+
+	feed := r.acquisitionFeed("urn:literal:search", fmt.Sprintf("Search results for %q", q), books)
+	feed.Total = total
+	feed.PerPage = pageSize
+	feed.Page = page
+	feed.Links = append(feed.Links, r.pageLinks(page, pageSize, total, false)...)
+
+	return feed, nil
+}
+
+// opdsBookList builds a counted, paged acquisition feed of the books
+// matching filter.
+func (app *application) opdsBookList(r opdsRequest, id, title string, filter data.BookFilter) (*opds.Feed, error) {
+	var err error
+	filter.Page, filter.PageSize, err = app.readPage(r.URL.Query())
+	if err != nil {
+		return nil, err
+	}
+
+	books, total, err := app.models.Book.List(r.Context(), filter)
+	if err != nil {
+		return nil, err
+	}
+
+	feed := r.acquisitionFeed(id, title, books)
+	feed.Total = total
+	feed.PerPage = filter.PageSize
+	feed.Page = filter.Page
+	feed.Links = append(feed.Links, r.pageLinks(filter.Page, filter.PageSize, total, false)...)
+
+	return feed, nil
+}
+
+func (r opdsRequest) acquisitionFeed(id, title string, books []*data.Book) *opds.Feed {
+	feed := &opds.Feed{ID: id, Title: title, Kind: opds.Acquisition}
+	for _, b := range books {
+		feed.Publications = append(feed.Publications, r.publication(b))
+	}
+	return feed
+}
+
+// publication describes a book. Literal holds no e-book files, so rather than
+// an acquisition link each entry links to the book's page on the site.
+func (r opdsRequest) publication(b *data.Book) opds.Publication {
+	p := opds.Publication{
+		ID:          fmt.Sprintf("urn:literal:book:%d", b.ID),
+		Title:       b.Title,
+		Description: b.Description,
+		Published:   b.PublicationYear,
+		Updated:     b.UpdatedAt,
+	}
+
+	// feeds only have room for authors, so editors and translators are left out
+	for _, c := range b.Authors {
+		if c.Role == data.ContributorAuthor {
+			p.Authors = append(p.Authors, c.AuthorName)
+		}
+	}
+	if len(p.Authors) == 0 && b.Author.AuthorName != "" {
+		p.Authors = []string{b.Author.AuthorName}
+	}
+	for _, g := range b.Genres {
+		p.Subjects = append(p.Subjects, g.GenreName)
+	}
+
+	if r.frontend != "" {
+		p.Links = append(p.Links, opds.Link{Rel: "alternate", Href: r.frontend + "/books/" + url.PathEscape(b.Slug), Type: "text/html", Title: b.Title})
+	}
+
+	var thumbnail *data.CoverRendition
+	for i, c := range b.Covers {
+		switch c.Name {
+		case "original":
+			p.Images = append(p.Images, r.coverLink(opds.RelImage, c))
+		case "medium":
+			thumbnail = &b.Covers[i]
+		case "small":
+			if thumbnail == nil {
+				thumbnail = &b.Covers[i]
+			}
+		}
+	}
+	if thumbnail != nil {
+		p.Images = append(p.Images, r.coverLink(opds.RelThumbnail, *thumbnail))
+	}
+
+	return p
+}
+
+func (r opdsRequest) coverLink(rel string, c data.CoverRendition) opds.Link {
+	return opds.Link{
+		Rel:    rel,
+		Href:   r.base + "/static/covers/" + c.Key,
+		Type:   "image/jpeg",
+		Width:  c.Width,
+		Height: c.Height,
+	}
+}
+
+// pageLinks links to the pages around the current one. With total unknown,
+// more says whether there may be a next page, and there is no last link.
+func (r opdsRequest) pageLinks(page, pageSize, total int, more bool) []opds.Link {
+	link := func(rel string, p int) opds.Link {
+		qs := r.URL.Query()
+		qs.Set("page", strconv.Itoa(p))
+		qs.Set("page_size", strconv.Itoa(pageSize))
+		u := *r.URL
+		u.RawQuery = qs.Encode()
+		return opds.Link{Rel: rel, Href: r.base + u.RequestURI(), Kind: opds.Acquisition}
+	}
+
+	last := 0
+	if total > 0 {
+		last = calculateMetadata(total, page, pageSize).LastPage
+		more = page < last
+	}
+
+	links := []opds.Link{link("first", 1)}
+	if page > 1 {
+		links = append(links, link("previous", page-1))
+	}
+	if more {
+		links = append(links, link("next", page+1))
+	}
+	if last > 0 {
+		links = append(links, link("last", last))
+	}
+
+	return links
+}
+
+// requestBaseURL is the scheme and host the client used to reach the API,
+// taking a proxy's X-Forwarded-Proto into account. Feeds use absolute links
+// because not every e-reader resolves relative ones.
+func requestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+		scheme = proto
+	}
+
+	return scheme + "://" + r.Host
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"literal/internal/data"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type stubOPDSBookRepository struct {
+	stubBookRepository
+}
+
+func (s stubOPDSBookRepository) GetAllPaginated(ctx context.Context, page, pageSize int) ([]*data.Book, error) {
+	books, _, err := s.List(ctx, data.BookFilter{Page: page, PageSize: pageSize})
+	return books, err
+}
+
+func TestApplication_OPDS(t *testing.T) {
+	books := []*data.Book{
+		{ID: 1, Title: "Dune", Slug: "dune", Author: data.Author{AuthorName: "Frank Herbert"}, PublicationYear: 1965,
+			Covers: data.CoverRenditions{
+				{Name: "original", Key: "1.jpg", Width: 800, Height: 1200},
+				{Name: "small", Key: "1-small.jpg", Width: 150, Height: 225},
+			}},
+		{ID: 2, Title: "Emma", Slug: "emma"},
+	}
+
+	app := testApp
+	app.config.frontendURL = "http://localhost:8080"
+	app.models.Book = stubOPDSBookRepository{stubBookRepository{books: books}}
+	app.models.Genre = stubGenreRepository{genres: []*data.Genre{{ID: 3, GenreName: "Romance", BookCount: 1}, {ID: 4, GenreName: "Empty"}}}
+
+	mux := chi.NewRouter()
+	mux.Route("/opds", func(mux chi.Router) {
+		app.opdsRoutes(mux, opdsAtom)
+		mux.Get("/opensearch.xml", app.OPDSOpenSearch)
+		mux.Route("/v2", func(mux chi.Router) {
+			app.opdsRoutes(mux, opdsJSON)
+		})
+	})
+
+	var tests = []struct {
+		name                string
+		url                 string
+		expectedCode        int
+		expectedContentType string
+		expectedBody        []string
+		unexpectedBody      string
+	}{
+		{"root without a slash", "/opds", http.StatusOK, "application/atom+xml;profile=opds-catalog;kind=navigation",
+			[]string{`rel="start" href="http://example.com/opds"`}, ""},
+		{"root", "/opds/", http.StatusOK, "application/atom+xml;profile=opds-catalog;kind=navigation",
+			[]string{`href="http://example.com/opds/books"`, `href="http://example.com/opds/opensearch.xml"`}, ""},
+		{"books page", "/opds/books?page_size=1", http.StatusOK, "application/atom+xml;profile=opds-catalog;kind=acquisition",
+			[]string{`rel="next" href="http://example.com/opds/books?page=2&amp;page_size=1"`,
+				`rel="http://opds-spec.org/image" href="http://example.com/static/covers/1.jpg"`,
+				`rel="http://opds-spec.org/image/thumbnail" href="http://example.com/static/covers/1-small.jpg"`,
+				`href="http://localhost:8080/books/dune" type="text/html"`}, "Emma"},
+		{"second books page", "/opds/books?page=2&page_size=1", http.StatusOK, "application/atom+xml;profile=opds-catalog;kind=acquisition",
+			[]string{"Emma", `rel="previous" href="http://example.com/opds/books?page=1&amp;page_size=1"`}, "Dune"},
+		{"short books page", "/opds/books?page_size=5", http.StatusOK, "application/atom+xml;profile=opds-catalog;kind=acquisition",
+			[]string{"Dune", "Emma"}, `rel="next"`},
+		{"genres", "/opds/genres", http.StatusOK, "application/atom+xml;profile=opds-catalog;kind=navigation",
+			[]string{`href="http://example.com/opds/genres/3"`, `thr:count="1"`}, "Empty"},
+		{"new books", "/opds/new", http.StatusOK, "application/atom+xml;profile=opds-catalog;kind=acquisition",
+			[]string{`<opensearch:totalResults>2</opensearch:totalResults>`}, ""},
+		{"search", "/opds/search?q=dune", http.StatusOK, "application/atom+xml;profile=opds-catalog;kind=acquisition",
+			[]string{"Search results for &#34;dune&#34;"}, ""},
+		{"search without a query", "/opds/search", http.StatusBadRequest, "text/plain; charset=utf-8", []string{"must not be empty"}, `"error"`},
+		{"bad genre id", "/opds/genres/x", http.StatusNotFound, "text/plain; charset=utf-8", []string{"not found"}, `"error"`},
+		{"json bad genre id", "/opds/v2/genres/x", http.StatusNotFound, "text/plain; charset=utf-8", []string{"not found"}, `"error"`},
+		{"opensearch", "/opds/opensearch.xml", http.StatusOK, "application/opensearchdescription+xml",
+			[]string{`template="http://example.com/opds/search?q={searchTerms}"`}, ""},
+		{"json root", "/opds/v2/", http.StatusOK, "application/opds+json",
+			[]string{`"href":"http://example.com/opds/v2/search{?query}"`, `"templated":true`}, ""},
+		{"json books", "/opds/v2/books", http.StatusOK, "application/opds+json",
+			[]string{`"@type":"http://schema.org/Book"`, `"title":"Emma"`}, ""},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "http://example.com"+e.url, nil)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected status %d, got %d: %s", e.name, e.expectedCode, rr.Code, rr.Body.String())
+			continue
+		}
+
+		if got := rr.Header().Get("Content-Type"); got != e.expectedContentType {
+			t.Errorf("%s: expected content type %q, got %q", e.name, e.expectedContentType, got)
+		}
+
+		for _, want := range e.expectedBody {
+			if !strings.Contains(rr.Body.String(), want) {
+				t.Errorf("%s: expected body to contain %s, got %s", e.name, want, rr.Body.String())
+			}
+		}
+
+		if e.unexpectedBody != "" && strings.Contains(rr.Body.String(), e.unexpectedBody) {
+			t.Errorf("%s: expected body not to contain %s, got %s", e.name, e.unexpectedBody, rr.Body.String())
+		}
+	}
+}
+
+func TestRequestBaseURL(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://books.example.com/opds/", nil)
+	req.Header.Set("X-Forwarded-Proto", "https")
+
+	if got := requestBaseURL(req); got != "https://books.example.com" {
+		t.Errorf("expected the forwarded scheme, got %s", got)
+	}
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"net/http"
 
+	"literal/internal/data"
+
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
@@ -20,29 +22,90 @@ func (app *application) routes() http.Handler {
 		MaxAge:           300,
 	}))
 
-	mux.Post("/users/login", app.Login)
+	mux.With(app.rateLimitByIP(app.loginLimit)).Post("/users/login", app.Login)
 	mux.Post("/users/logout", app.Logout)
+	mux.Post("/users/refresh", app.RefreshToken)
+	mux.Post("/users/forgot-password", app.ForgotPassword)
+	mux.Post("/users/reset-password", app.ResetPassword)
+	mux.Post("/users/register", app.Register)
+	mux.Post("/users/verify-email", app.VerifyEmail)
+
+	mux.Route("/users/me", func(mux chi.Router) {
+		mux.Use(app.AuthTokenMiddleware)
+		mux.Get("/sessions", app.MySessions)
+		mux.Post("/sessions/revoke", app.RevokeMySession)
+		mux.Post("/sessions/revoke-all", app.RevokeAllMySessions)
+	})
 
 	mux.Post("/books", app.AllBooks)
 	mux.Get("/books", app.AllBooks)
+	mux.Get("/books/search", app.SearchBooks)
+	mux.Get("/books/isbn/{isbn}", app.BookByISBN)
 	mux.Get("/books/{slug}", app.SingleBook)
 
+	mux.Get("/genres", app.AllGenres)
+
+	mux.Route("/opds", func(mux chi.Router) {
+		app.opdsRoutes(mux, opdsAtom)
+		mux.Get("/opensearch.xml", app.OPDSOpenSearch)
+		mux.Route("/v2", func(mux chi.Router) {
+			app.opdsRoutes(mux, opdsJSON)
+		})
+	})
+
 	mux.Post("/validate-token", app.ValidateToken)
 
 	mux.Route("/admin", func(mux chi.Router) {
 		mux.Use(app.AuthTokenMiddleware)
-		mux.Post("/users", app.AllUsers)
-		mux.Post("/users/save", app.EditUser)
-		mux.Post("/users/get/{id}", app.GetUser)
-		mux.Post("/users/delete", app.DeleteUser)
-		mux.Post("/log-out-user/{id}", app.LogoutUserAndSetInactive)
-
-		mux.Post("/authors/all", app.AllAuthors)
-		mux.Post("/books/save", app.EditBook)
-		mux.Post("/books/delete", app.DeleteBook)
-		mux.Post("/books/{id}", app.BookById)
+
+		can := func(perms ...data.Permission) chi.Router {
+			var checks []func(http.Handler) http.Handler
+			for _, p := range perms {
+				checks = append(checks, app.requirePermission(p))
+			}
+			return mux.With(checks...)
+		}
+
+		can(data.PermUsersRead).Post("/users", app.AllUsers)
+		can(data.PermUsersWrite).Post("/users/save", app.EditUser)
+		can(data.PermUsersRead).Post("/users/get/{id}", app.GetUser)
+		can(data.PermUsersWrite).Post("/users/delete", app.DeleteUser)
+		can(data.PermUsersWrite).Post("/log-out-user/{id}", app.LogoutUserAndSetInactive)
+		can(data.PermUsersWrite).Post("/users/unlock", app.UnlockUser)
+		can(data.PermUsersRead).Post("/users/sessions/{id}", app.UserSessions)
+		can(data.PermUsersWrite).Post("/users/sessions/revoke", app.RevokeUserSession)
+		can(data.PermUsersRead).Get("/settings/registration", app.RegistrationSettings)
+		can(data.PermUsersWrite).Post("/settings/registration", app.SetRegistration)
+
+		can(data.PermAuditRead).Get("/audit", app.AuditLog)
+
+		can(data.PermBooksRead).Post("/authors/all", app.AllAuthors)
+		can(data.PermAuthorsWrite).Post("/authors/save", app.EditAuthor)
+		can(data.PermAuthorsWrite).Post("/authors/delete", app.DeleteAuthor)
+		can(data.PermAuthorsWrite).Post("/authors/merge", app.MergeAuthors)
+		can(data.PermBooksRead).Post("/authors/get/{id}", app.AuthorByID)
+
+		can(data.PermGenresWrite).Post("/genres/save", app.EditGenre)
+		can(data.PermGenresWrite).Post("/genres/delete", app.DeleteGenre)
+		can(data.PermBooksRead).Post("/genres/get/{id}", app.GenreByID)
+
+		can(data.PermBooksWrite).Post("/books/save", app.EditBook)
+		can(data.PermBooksWrite).Post("/books/delete", app.DeleteBook)
+		can(data.PermBooksWrite, data.PermAuthorsWrite, data.PermGenresWrite).Post("/books/import", app.ImportBooks)
+		can(data.PermBooksWrite).Get("/books/lookup", app.LookupBook)
+		can(data.PermBooksWrite).Put("/books/{id}/cover", app.UploadCover)
+		can(data.PermBooksWrite).Delete("/books/{id}/cover", app.DeleteCover)
+		can(data.PermBooksRead).Post("/books/{id}", app.BookById)
+
+		can(data.PermBooksRead).Get("/export/books", app.ExportBooks)
+		can(data.PermBooksRead).Get("/export/authors", app.ExportAuthors)
+		can(data.PermBooksRead).Get("/export/genres", app.ExportGenres)
 	})
 
+	// covers come from the cover store, which need not be on this disk
+	mux.Get("/static/covers/*", app.ServeCover)
+	mux.Head("/static/covers/*", app.ServeCover)
+
 	fileServer := http.FileServer(http.Dir("./static/"))
 	mux.Handle("/static/*", http.StripPrefix("/static", fileServer))
 
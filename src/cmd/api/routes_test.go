@@ -13,9 +13,45 @@ func Test_If_Routes_Exist(t *testing.T) {
 
 	doesRouteExist(t, chiRoutes, "/users/login")
 	doesRouteExist(t, chiRoutes, "/users/logout")
+	doesRouteExist(t, chiRoutes, "/users/refresh")
+	doesRouteExist(t, chiRoutes, "/users/forgot-password")
+	doesRouteExist(t, chiRoutes, "/users/reset-password")
+	doesRouteExist(t, chiRoutes, "/users/register")
+	doesRouteExist(t, chiRoutes, "/users/verify-email")
+	doesRouteExist(t, chiRoutes, "/admin/settings/registration")
+	doesRouteExist(t, chiRoutes, "/admin/audit")
 	doesRouteExist(t, chiRoutes, "/admin/users/get/{id}")
 	doesRouteExist(t, chiRoutes, "/admin/users/save")
 	doesRouteExist(t, chiRoutes, "/admin/users/delete")
+	doesRouteExist(t, chiRoutes, "/admin/users/unlock")
+	doesRouteExist(t, chiRoutes, "/admin/users/sessions/{id}")
+	doesRouteExist(t, chiRoutes, "/admin/users/sessions/revoke")
+	doesRouteExist(t, chiRoutes, "/users/me/sessions")
+	doesRouteExist(t, chiRoutes, "/users/me/sessions/revoke")
+	doesRouteExist(t, chiRoutes, "/users/me/sessions/revoke-all")
+	doesRouteExist(t, chiRoutes, "/admin/authors/save")
+	doesRouteExist(t, chiRoutes, "/admin/authors/delete")
+	doesRouteExist(t, chiRoutes, "/admin/authors/merge")
+	doesRouteExist(t, chiRoutes, "/admin/authors/get/{id}")
+	doesRouteExist(t, chiRoutes, "/books/search")
+	doesRouteExist(t, chiRoutes, "/books/isbn/{isbn}")
+	doesRouteExist(t, chiRoutes, "/admin/books/{id}/cover")
+	doesRouteExist(t, chiRoutes, "/admin/books/import")
+	doesRouteExist(t, chiRoutes, "/admin/books/lookup")
+	doesRouteExist(t, chiRoutes, "/admin/export/books")
+	doesRouteExist(t, chiRoutes, "/admin/export/authors")
+	doesRouteExist(t, chiRoutes, "/admin/export/genres")
+	doesRouteExist(t, chiRoutes, "/genres")
+	doesRouteExist(t, chiRoutes, "/opds/")
+	doesRouteExist(t, chiRoutes, "/opds/books")
+	doesRouteExist(t, chiRoutes, "/opds/genres/{id}")
+	doesRouteExist(t, chiRoutes, "/opds/authors/{id}")
+	doesRouteExist(t, chiRoutes, "/opds/opensearch.xml")
+	doesRouteExist(t, chiRoutes, "/opds/v2/")
+	doesRouteExist(t, chiRoutes, "/opds/v2/search")
+	doesRouteExist(t, chiRoutes, "/admin/genres/save")
+	doesRouteExist(t, chiRoutes, "/admin/genres/delete")
+	doesRouteExist(t, chiRoutes, "/admin/genres/get/{id}")
 }
 
 func doesRouteExist(t *testing.T, routes chi.Router, route string) {
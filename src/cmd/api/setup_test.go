@@ -3,9 +3,12 @@ package main
 import (
 	"log"
 	"os"
+	"sync"
 	"testing"
 
 	"literal/internal/data"
+	"literal/internal/imaging"
+	"literal/internal/storage"
 
 	"github.com/DATA-DOG/go-sqlmock"
 )
@@ -23,11 +26,13 @@ func TestMain(m *testing.M) {
 	defer testDB.Close()
 
 	testApp = application{
-		config:      config{},
+		config:      config{coverLimits: imaging.DefaultLimits},
 		infoLog:     log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime),
 		errorLog:    log.New(os.Stdout, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile),
 		models:      data.New(testDB),
+		covers:      storage.NewMemory(),
 		environment: "development",
+		wg:          &sync.WaitGroup{},
 	}
 
 	os.Exit(m.Run())
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"literal/internal/catalog"
+	"literal/internal/data"
+	"literal/internal/driver"
+)
+
+func main() {
+	infoLog := log.New(os.Stderr, "INFO: ", log.Ldate|log.Ltime)
+	errorLog := log.New(os.Stderr, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile)
+
+	table := flag.String("table", "books", "what to export: books, authors or genres")
+	format := flag.String("format", "", "csv, json (JSON lines) or xlsx; by default taken from the -o extension, else csv")
+	output := flag.String("o", "-", "file to write, or - for stdout")
+
+	var filter data.BookFilter
+	flag.IntVar(&filter.AuthorID, "author-id", 0, "only books by this author")
+	flag.IntVar(&filter.GenreID, "genre-id", 0, "only books in this genre")
+	flag.IntVar(&filter.YearFrom, "year-from", 0, "only books published in or after this year")
+	flag.IntVar(&filter.YearTo, "year-to", 0, "only books published in or before this year")
+	flag.StringVar(&filter.Sort, "sort", "", "order books by title, year or created_at; prefix with - to reverse")
+	flag.Parse()
+
+	switch *table {
+	case "books", "authors", "genres":
+	default:
+		errorLog.Fatalf("unknown table %q", *table)
+	}
+
+	if *format == "" {
+		*format = catalog.FormatCSV
+		if ext := filepath.Ext(*output); ext == ".xlsx" {
+			*format = catalog.FormatXLSX
+		} else if f := catalog.FormatFor(ext); f != "" {
+			*format = f
+		}
+	}
+
+	rows, err := run(*table, *format, *output, filter)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	infoLog.Printf("Exported %d %s", rows, *table)
+}
+
+// run does the export and returns the number of rows written. A file is
+// written under a temporary name and only renamed to output once it is
+// complete, so a failed export leaves no truncated file behind, nor clobbers
+// an earlier one.
+func run(table, format, output string, filter data.BookFilter) (int, error) {
+	db, err := driver.ConnectPostgres(os.Getenv("DSN"))
+	if err != nil {
+		return 0, err
+	}
+	defer db.SQL.Close()
+
+	models := data.New(db.SQL)
+
+	if output == "-" {
+		return export(context.Background(), models, os.Stdout, table, format, filter)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(output), "."+filepath.Base(output)+".*")
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := export(context.Background(), models, f, table, format, filter)
+	if err == nil {
+		err = f.Chmod(0644)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), output)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return 0, err
+	}
+
+	return rows, nil
+}
+
+// export writes table to out in format.
+func export(ctx context.Context, models data.Models, out io.Writer, table, format string, filter data.BookFilter) (int, error) {
+	rows := 0
+	var w *catalog.Writer
+	var err error
+
+	switch table {
+	case "books":
+		w, err = catalog.NewWriter(out, format, catalog.Books)
+		if err == nil {
+			err = models.Book.Each(ctx, filter, func(b *data.Book) error {
+				rows++
+				return w.Write(catalog.BookRecord(b)...)
+			})
+		}
+	case "authors":
+		w, err = catalog.NewWriter(out, format, catalog.Authors)
+		if err == nil {
+			err = models.Author.Each(ctx, func(a *data.Author) error {
+				rows++
+				return w.Write(catalog.AuthorRecord(a)...)
+			})
+		}
+	case "genres":
+		w, err = catalog.NewWriter(out, format, catalog.Genres)
+		if err == nil {
+			err = models.Genre.Each(ctx, func(g *data.Genre) error {
+				rows++
+				return w.Write(catalog.GenreRecord(g)...)
+			})
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	err = w.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	return rows, nil
+}
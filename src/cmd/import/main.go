@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"literal/internal/catalog"
+	"literal/internal/data"
+	"literal/internal/driver"
+)
+
+func main() {
+	infoLog := log.New(os.Stdout, "INFO: ", log.Ldate|log.Ltime)
+	errorLog := log.New(os.Stderr, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile)
+
+	format := flag.String("format", "", "csv or json (JSON lines); by default taken from the file extension")
+	dryRun := flag.Bool("dry-run", false, "report what would change without saving anything")
+	skipExisting := flag.Bool("skip-existing", false, "leave books that are already in the catalog alone instead of updating them")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] file\n\nReads from stdin when file is -.\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	path := flag.Arg(0)
+
+	if *format == "" {
+		*format = catalog.FormatFor(filepath.Ext(path))
+	}
+
+	var in io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	rows, err := catalog.Read(in, *format)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	db, err := driver.ConnectPostgres(os.Getenv("DSN"))
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+	defer db.SQL.Close()
+
+	models := data.New(db.SQL)
+
+	report, err := models.Book.Import(context.Background(), rows, data.ImportOptions{DryRun: *dryRun, SkipExisting: *skipExisting})
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	for _, row := range report.Rows {
+		line := fmt.Sprintf("line %d: %s %s", row.Line, row.Status, row.Slug)
+		if row.Reason != "" {
+			line += " (" + row.Reason + ")"
+		}
+		fmt.Println(line)
+	}
+
+	summary := fmt.Sprintf("%d created, %d updated, %d skipped, %d failed", report.Created, report.Updated, report.Skipped, report.Failed)
+	if report.DryRun {
+		summary = "Dry run, nothing was saved: " + summary
+	}
+	infoLog.Println(summary)
+
+	if report.Failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"literal/internal/driver"
+	"literal/internal/migrations"
+)
+
+func main() {
+	infoLog := log.New(os.Stdout, "INFO: ", log.Ldate|log.Ltime)
+	errorLog := log.New(os.Stderr, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile)
+
+	down := flag.Int("down", 0, "roll back this many migrations instead of migrating up")
+	force := flag.Int("force", -1, "mark the schema as being at this version without running any SQL")
+	version := flag.Bool("version", false, "print the current schema version and exit")
+	flag.DurationVar(&migrations.Timeout, "timeout", migrations.Timeout, "how long each migration may run")
+	flag.Parse()
+
+	db, err := driver.OpenPostgres(os.Getenv("DSN"))
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+	defer db.SQL.Close()
+
+	switch {
+	case *version:
+	case *force >= 0:
+		err = migrations.Force(db.SQL, *force)
+	case *down > 0:
+		err = migrations.Down(db.SQL, *down)
+	default:
+		err = migrations.Up(db.SQL)
+	}
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	current, err := migrations.Current(db.SQL)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	infoLog.Println("Schema is at version", current)
+}